@@ -0,0 +1,55 @@
+package component
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// A11yPolicy enforces accessibility practices across every component's
+// markup. See Options.A11y.
+type A11yPolicy struct {
+	// RequireAlt fails compilation if any <img> lacks an alt attribute.
+	// Give decorative images an empty one, alt="", so screen readers
+	// skip them.
+	RequireAlt bool
+
+	// Defaults adds attributes to elements which don't set them, mapping
+	// tag names to attributes and their values, e.g.
+	// {"nav": {"aria-label": "Main"}} or {"table": {"role": "grid"}}.
+	Defaults map[string]map[string]string
+}
+
+// checkA11y fails if a component's markup violates the policy, listing every
+// violation. Elements with attributes written by template actions aren't
+// checked, since the actions might set the attribute.
+func checkA11y(name string, src []byte, policy A11yPolicy) error {
+	if !policy.RequireAlt {
+		return nil
+	}
+	toks, err := tokenizeMarkup(src)
+	if err != nil {
+		return err
+	}
+	masked := maskActions(src)
+	var violations []string
+tags:
+	for _, t := range toks {
+		if t.Data != "img" ||
+			(t.Type != html.StartTagToken && t.Type != html.SelfClosingTagToken) {
+			continue
+		}
+		for _, a := range scanAttrs(masked[t.start:t.end], src[t.start:t.end]) {
+			if a.name == "alt" || strings.Contains(a.name, "{{") {
+				continue tags
+			}
+		}
+		violations = append(violations, fmt.Sprintf("%s has no alt attribute",
+			truncate(string(src[t.start:t.end]))))
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s isn't accessible: %s", name, strings.Join(violations, "; "))
+}
@@ -0,0 +1,41 @@
+package component
+
+import (
+	"archive/tar"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ReadTar reads the components in a tar archive, i.e. its ".tmpl" files,
+// for CompileSources. Wrap gzipped archives with gzip.NewReader first.
+// Entry names are normalized like a directory's, so "./list/item.tmpl" and
+// "list\item.tmpl" both become "list/item". Only regular files are read, so
+// links and directories are skipped, and CompileSources rejects entries
+// outside the archive's root, e.g. "../page.tmpl".
+func ReadTar(r io.Reader) ([]Source, error) {
+	var sources []Source
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return sources, nil
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "read tar")
+		}
+		if hdr.Typeflag != tar.TypeReg || !strings.HasSuffix(hdr.Name, ".tmpl") {
+			continue
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "read %s", hdr.Name)
+		}
+		sources = append(sources, Source{
+			Name:    strings.ReplaceAll(hdr.Name, `\`, "/"),
+			Content: content,
+			File:    hdr.Name,
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package component
+
+import (
+	"archive/tar"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// tarEntry is an entry of an archive written by writeTar.
+type tarEntry struct {
+	hdr     tar.Header
+	content string
+}
+
+// tarFile is a regular file entry.
+func tarFile(name, content string) tarEntry {
+	return tarEntry{tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0o644}, content}
+}
+
+// writeTar returns a tar archive of the given entries.
+func writeTar(t *testing.T, entries ...tarEntry) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		e.hdr.Size = int64(len(e.content))
+		if err := tw.WriteHeader(&e.hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func TestReadTar(t *testing.T) {
+	archive := writeTar(t,
+		tarEntry{hdr: tar.Header{Name: "list/", Typeflag: tar.TypeDir, Mode: 0o755}},
+		tarFile("./page.tmpl", `<template>{{ template "./list/item" }}</template>`),
+		tarFile(`list\item.tmpl`, `<template><li>item</li></template>`),
+		tarFile("README.md", "not a component"),
+		tarEntry{hdr: tar.Header{Name: "link.tmpl", Typeflag: tar.TypeSymlink, Linkname: "page.tmpl"}},
+		tarEntry{hdr: tar.Header{Name: "dir.tmpl/", Typeflag: tar.TypeDir, Mode: 0o755}},
+	)
+	sources, err := ReadTar(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, src := range sources {
+		names = append(names, src.Name)
+	}
+	if got := strings.Join(names, " "); got != "./page.tmpl list/item.tmpl" {
+		t.Errorf("sources %s, want only the regular .tmpl files", got)
+	}
+	tmpl, err := CompileSources(sources, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page := render(t, tmpl, "page", nil); !strings.Contains(page, "<li>item</li>") {
+		t.Errorf("page:\n%s", page)
+	}
+
+	for _, name := range []string{"../evil.tmpl", "list/../../evil.tmpl", "/evil.tmpl"} {
+		sources, err := ReadTar(writeTar(t, tarFile(name, "<template>x</template>")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = CompileSources(sources, nil)
+		if err == nil || !strings.Contains(err.Error(), "escapes the template root") {
+			t.Errorf("%s: err = %v, want it rejected", name, err)
+		}
+	}
+}
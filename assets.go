@@ -0,0 +1,264 @@
+package component
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"net/url"
+	"sort"
+	"strings"
+	"text/template/parse"
+
+	"github.com/pkg/errors"
+)
+
+// Asset is a component's style or script compiled to a separate file. See
+// Options.ExternalAssets.
+type Asset struct {
+	// Path is the fingerprinted path of the file relative to the asset
+	// root, e.g. "list/item.1a2b3c4d.css".
+	Path string
+
+	// Component is the name of the component the asset came from. It's
+	// empty for the bundle of vendor scripts.
+	Component string
+
+	// ContentType is the MIME type to serve the asset with.
+	ContentType string
+
+	// Content is the asset's contents.
+	Content []byte
+
+	// Integrity is the asset's subresource integrity hash, e.g.
+	// "sha384-...". It's always computed, but only added to pages with
+	// Options.Integrity.
+	Integrity string
+
+	// Module reports whether the asset is the script of a component
+	// marked <script type="module">, which pages load as a module.
+	Module bool
+}
+
+// assetTypes maps sections to their file extension and content type.
+var assetTypes = map[string][2]string{
+	"style":  {".css", "text/css; charset=utf-8"},
+	"script": {".js", "text/javascript; charset=utf-8"},
+}
+
+// isStatic reports whether a parse tree contains only text, i.e. it renders
+// the same regardless of data.
+func isStatic(tree *parse.Tree) bool {
+	for _, n := range tree.Root.Nodes {
+		if n.Type() != parse.NodeText {
+			return false
+		}
+	}
+	return true
+}
+
+// addAsset records a static section to be compiled to an external file.
+func (b *builder) addAsset(name, section string, data []byte) {
+	a := newAsset(name, section, data)
+	a.Module = section == "script" && b.moduleScripts[name]
+	b.assets[name+"#"+section] = a
+}
+
+// newAsset returns the asset compiled from a section.
+func newAsset(name, section string, data []byte) *Asset {
+	sum := sha256.Sum256(data)
+	integrity := sha512.Sum384(data)
+	return &Asset{
+		Path:        fmt.Sprintf("%s.%x%s", name, sum[:4], assetTypes[section][0]),
+		Component:   name,
+		ContentType: assetTypes[section][1],
+		Content:     data,
+		Integrity:   "sha384-" + base64.StdEncoding.EncodeToString(integrity[:]),
+	}
+}
+
+// hashContent records the hash of a static style or script section for
+// DedupByContent. Sections included differently, e.g. with different media
+// conditions, never have the same hash.
+func (b *builder) hashContent(name, section string, data []byte) {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%t\x00", section, b.styleMedia[name], b.moduleScripts[name])
+	h.Write(data)
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+	b.contentHash[name+"#"+section] = sum
+}
+
+// dedupContent returns the named sections of a page without those identical
+// to an earlier one. See Options.DedupStrategy.
+func (b *builder) dedupContent(names []string) []string {
+	seen := map[[sha256.Size]byte]bool{}
+	kept := make([]string, 0, len(names))
+	for _, name := range names {
+		sum, ok := b.contentHash[name]
+		if ok && seen[sum] {
+			continue
+		}
+		if ok {
+			seen[sum] = true
+		}
+		kept = append(kept, name)
+	}
+	return kept
+}
+
+// assetTags returns the tags including the named style or script sections
+// in a page. Consecutive inline sections are grouped into one tag, and each
+// external asset gets its own tag, so the original order is kept. Deferred
+// external scripts are marked defer.
+func (b *builder) assetTags(section string, names []string, deferred bool) string {
+	var tags, inline []string
+	flush := func() {
+		if len(inline) == 0 {
+			return
+		}
+		tags = append(tags, b.inlineTag(section, inline))
+		inline = nil
+	}
+	for _, name := range names {
+		a := b.assets[name]
+		if a == nil {
+			inline = append(inline, name)
+			continue
+		}
+		flush()
+		tags = append(tags, b.externalTag(section, a, deferred))
+	}
+	flush()
+	if len(tags) == 0 {
+		return b.inlineTag(section, nil)
+	}
+	return strings.Join(tags, "\n")
+}
+
+// inlineTag returns a <style> or <script> tag including the named sections.
+func (b *builder) inlineTag(section string, names []string) string {
+	attrs := ""
+	if b.opts.Nonce != "" {
+		attrs = ` nonce="{{` + b.opts.Nonce + `}}"`
+	}
+	if section == "style" {
+		return "<style" + attrs + ">\n" + b.styleIncludes(names) + "\n</style>"
+	}
+	return "<" + section + attrs + ">\n" + includes(names) + "\n</" + section + ">"
+}
+
+// styleIncludes returns actions including each of the named style sections
+// like includes, wrapping those of components marked <style media="..."> in
+// an @media rule with the condition.
+func (b *builder) styleIncludes(names []string) string {
+	actions := make([]string, 0, len(names))
+	for _, name := range names {
+		action := includes([]string{name})
+		if media := b.styleMedia[strings.TrimSuffix(name, "#style")]; media != "" {
+			action = "@media " + media + " {\n" + action + "\n}"
+		}
+		actions = append(actions, action)
+	}
+	return strings.Join(actions, "\n")
+}
+
+// externalTag returns a <link> or <script> tag referencing an asset.
+func (b *builder) externalTag(section string, a *Asset, deferred bool) string {
+	attrs := ""
+	if b.opts.Integrity {
+		attrs = ` integrity="` + a.Integrity + `" crossorigin="anonymous"`
+	}
+	if deferred {
+		attrs += " defer"
+	}
+	url := assetURL(b.opts.AssetPrefix, a)
+	if section == "style" {
+		if media := b.styleMedia[a.Component]; media != "" {
+			attrs += ` media="` + html.EscapeString(media) + `"`
+		}
+		return `<link rel="stylesheet" href="` + url + `"` + attrs + `>`
+	}
+	if b.moduleScripts[a.Component] {
+		// modules are deferred already
+		return `<script type="module" src="` + url + `"` + strings.TrimSuffix(attrs, " defer") +
+			`></script>`
+	}
+	return `<script src="` + url + `"` + attrs + `></script>`
+}
+
+// assetURL returns the URL of an asset served under prefix, which defaults
+// to the site root.
+func assetURL(prefix string, a *Asset) string {
+	if prefix == "" {
+		prefix = "/"
+	} else if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return prefix + escapePath(a.Path)
+}
+
+// escapePath escapes each segment of a slash-separated path for use in a
+// URL, e.g. for components in directories with spaces.
+func escapePath(p string) string {
+	segs := strings.Split(p, "/")
+	for i, seg := range segs {
+		segs[i] = url.PathEscape(seg)
+	}
+	return strings.Join(segs, "/")
+}
+
+// vendorName is the name of the script bundling every static script marked
+// <script vendor>. See Options.ExternalAssets.
+const vendorName = "#vendor#script"
+
+// addVendorBundle compiles the vendor scripts recorded while adding
+// components into a single asset, in the order of their components' names
+// so its hash only changes when they do.
+func (b *builder) addVendorBundle() error {
+	names := make([]string, 0, len(b.vendor))
+	for name := range b.vendor {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var buf bytes.Buffer
+	for _, name := range names {
+		if buf.Len() > 0 {
+			// a script may omit its final semicolon
+			buf.WriteString("\n;\n")
+		}
+		buf.Write(b.vendor[name])
+		if b.critical[name] {
+			b.critical[strings.TrimSuffix(vendorName, "#script")] = true
+		}
+	}
+	data := buf.Bytes()
+	if err := b.addRawText(vendorName, string(data)); err != nil {
+		return errors.Wrap(err, "vendor bundle")
+	}
+	a := newAsset("vendor", "script", data)
+	a.Component = ""
+	b.assets[vendorName] = a
+	return nil
+}
+
+// vendorScripts returns the script sections of a page with those bundled as
+// vendor scripts replaced by the bundle, which comes first so the
+// components' own scripts may rely on it.
+func (b *builder) vendorScripts(names []string) []string {
+	out := make([]string, 0, len(names)+1)
+	bundled := false
+	for _, name := range names {
+		if b.vendor[strings.TrimSuffix(name, "#script")] != nil {
+			bundled = true
+			continue
+		}
+		out = append(out, name)
+	}
+	if !bundled {
+		return names
+	}
+	return append([]string{vendorName}, out...)
+}
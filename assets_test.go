@@ -0,0 +1,205 @@
+package component
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// assetTagRE matches the start tags of styles and scripts in a page.
+var assetTagRE = regexp.MustCompile(`<(?:style|script|link)\b[^>]*>`)
+
+func TestNonceAndIntegrity(t *testing.T) {
+	src := map[string]string{
+		// static, so compiled to files
+		"card": `<style>.card { color: red; }</style>
+<script>var card = 1;</script>
+<template><div class="card"></div></template>`,
+		// dynamic, so inlined
+		"page": `<style>body { color: {{ .Color }}; }</style>
+<script>var page = {{ .N }};</script>
+<template>{{ template "./card" . }}</template>`,
+	}
+	opts := Options{ExternalAssets: true, Integrity: true, Nonce: ".Nonce"}
+	tmpl, meta := compileMap(t, opts, src)
+	if len(meta.Assets) != 2 {
+		t.Fatalf("got %d assets, want the card's style and script", len(meta.Assets))
+	}
+	page := render(t, tmpl, "page", map[string]interface{}{
+		"Nonce": "n0nce", "Color": "blue", "N": 2,
+	})
+	var inline, external int
+	for _, tag := range assetTagRE.FindAllString(page, -1) {
+		hasNonce := strings.Contains(tag, `nonce="n0nce"`)
+		hasIntegrity := strings.Contains(tag, `integrity="sha384-`) &&
+			strings.Contains(tag, `crossorigin="anonymous"`)
+		if strings.Contains(tag, "src=") || strings.Contains(tag, "href=") {
+			external++
+			if hasNonce || !hasIntegrity {
+				t.Errorf("external tag should have integrity but no nonce: %s", tag)
+			}
+		} else {
+			inline++
+			if !hasNonce || strings.Contains(tag, "integrity") {
+				t.Errorf("inline tag should have a nonce but no integrity: %s", tag)
+			}
+		}
+	}
+	if inline != 2 || external != 2 {
+		t.Errorf("got %d inline and %d external tags, want 2 of each:\n%s",
+			inline, external, page)
+	}
+	for _, a := range meta.Assets {
+		if !strings.Contains(page, `integrity="`+a.Integrity+`"`) {
+			t.Errorf("page missing integrity of %s:\n%s", a.Path, page)
+		}
+	}
+}
+
+func TestAssetPrefix(t *testing.T) {
+	src := map[string]string{
+		"button": `<style>.button { color: red; }</style>
+<script>var button = 1;</script>
+<template><button class="button"></button></template>`,
+	}
+	opts := Options{
+		ExternalAssets: true,
+		Integrity:      true,
+		AssetPrefix:    "https://cdn.example.com",
+	}
+	tmpl, meta := compileMap(t, opts, src)
+	page := render(t, tmpl, "button", nil)
+	fingerprint := regexp.MustCompile(`^button\.[0-9a-f]{8}\.(css|js)$`)
+	for _, a := range meta.Assets {
+		if !fingerprint.MatchString(a.Path) {
+			t.Errorf("asset path %s isn't fingerprinted", a.Path)
+		}
+		url := "https://cdn.example.com/" + a.Path
+		var want string
+		if strings.HasSuffix(a.Path, ".css") {
+			want = `<link rel="stylesheet" href="` + url + `" integrity="` + a.Integrity +
+				`" crossorigin="anonymous">`
+		} else {
+			want = `<script src="` + url + `" integrity="` + a.Integrity +
+				`" crossorigin="anonymous"></script>`
+		}
+		if !strings.Contains(page, want) {
+			t.Errorf("page missing %s:\n%s", want, page)
+		}
+	}
+	for _, link := range meta.LinkHeaders("button") {
+		if !strings.HasPrefix(link, "<https://cdn.example.com/button.") ||
+			!strings.HasSuffix(link, "; crossorigin=anonymous") {
+			t.Errorf("link header %s should use the prefix and crossorigin", link)
+		}
+	}
+
+	// without a prefix, assets are served from the root
+	tmpl, _ = compileMap(t, Options{ExternalAssets: true}, src)
+	if page := render(t, tmpl, "button", nil); !strings.Contains(page, `href="/button.`) {
+		t.Errorf("page should reference assets from the root:\n%s", page)
+	}
+}
+
+func TestStyleMedia(t *testing.T) {
+	src := map[string]string{
+		"narrow": `<style media="(max-width: 600px)">.n { margin: 0; }</style><template>n</template>`,
+		"page":   `<style>p { margin: 0; }</style><template>{{ template "./narrow" }}</template>`,
+	}
+	tmpl, _ := compileMap(t, Options{}, src)
+	const inlined = "@media (max-width: 600px) {\n.n { margin: 0; }\n}\np { margin: 0; }"
+	if page := render(t, tmpl, "page", nil); !strings.Contains(page, inlined) {
+		t.Errorf("inlined page:\n%s\nwant:\n%s", page, inlined)
+	}
+	if css, _, err := PageAssets(tmpl, "page"); err != nil || css != inlined {
+		t.Errorf("PageAssets css %q, %v", css, err)
+	}
+
+	tmpl, _ = compileMap(t, Options{ExternalAssets: true}, src)
+	page := render(t, tmpl, "page", nil)
+	if !regexp.MustCompile(`<link rel="stylesheet" href="/narrow\.\w+\.css" media="\(max-width: 600px\)">`).MatchString(page) ||
+		!regexp.MustCompile(`<link rel="stylesheet" href="/page\.\w+\.css">`).MatchString(page) {
+		t.Errorf("external page:\n%s", page)
+	}
+
+	for _, media := range []string{"", "a { }", "{{ .Media }}"} {
+		_, _, err := NewCompiler(Options{}).Map(map[string][]byte{
+			"x": []byte(`<style media="` + media + `">p { margin: 0; }</style>`),
+		})
+		if err == nil || !strings.Contains(err.Error(), "invalid media directive") {
+			t.Errorf("media %q: err = %v", media, err)
+		}
+	}
+}
+
+func TestVendorBundle(t *testing.T) {
+	src := map[string]string{
+		"lib1":  `<script vendor>var lib1 = 1</script><template>1</template>`,
+		"lib2":  `<script vendor critical>var lib2 = 2;</script><template>2</template>`,
+		"app":   `<script>var app = lib1 + lib2;</script><template>{{ template "./lib1" }}{{ template "./lib2" }}</template>`,
+		"other": `<template>{{ template "./lib1" }}</template>`,
+	}
+	tmpl, meta := compileMap(t, Options{ExternalAssets: true, DeferNonCritical: true}, src)
+	var vendor *Asset
+	for _, a := range meta.Assets {
+		if strings.HasPrefix(a.Path, "vendor.") {
+			vendor = a
+		}
+	}
+	// scripts are bundled in the order of their components' names, and a
+	// semicolon separates scripts which may omit their last
+	if vendor == nil || vendor.Component != "" || string(vendor.Content) != "var lib1 = 1\n;\nvar lib2 = 2;" {
+		t.Fatalf("vendor asset %+v", vendor)
+	}
+	vendorTag := `<script src="/` + vendor.Path + `"></script>`
+	for _, page := range []string{"app", "other"} {
+		out := render(t, tmpl, page, nil)
+		if strings.Count(out, "<script src=") != strings.Count(out, "/app.")+1 {
+			t.Errorf("%s: scripts besides the bundle and app:\n%s", page, out)
+		}
+		// the bundle is critical since lib2 is, so it stays in the head
+		// rather than being deferred
+		if !strings.Contains(out, "</style>\n"+vendorTag) {
+			t.Errorf("%s: vendor bundle missing or deferred:\n%s", page, out)
+		}
+	}
+
+	// without ExternalAssets, vendor scripts are inlined like any other
+	tmpl, meta = compileMap(t, Options{}, src)
+	if len(meta.Assets) != 0 {
+		t.Errorf("assets %v, want none", meta.Assets)
+	}
+	if page := render(t, tmpl, "app", nil); !strings.Contains(page, "var lib1 = 1\nvar lib2 = 2;\nvar app") {
+		t.Errorf("inlined page:\n%s", page)
+	}
+}
+
+func TestDedupByContent(t *testing.T) {
+	src := map[string]string{
+		"a":       `<style>.shared { color: red; }</style><template>a</template>`,
+		"b":       `<style>.shared { color: red; }</style><template>b</template>`,
+		"print":   `<style media="print">.shared { color: red; }</style><template>print</template>`,
+		"classic": `<script>init();</script><template>classic</template>`,
+		"module":  `<script type="module">init();</script><template>module</template>`,
+		"page": `<template>{{ template "./a" }}{{ template "./b" }}{{ template "./print" }}` +
+			`{{ template "./classic" }}{{ template "./module" }}</template>`,
+	}
+	tmpl, _ := compileMap(t, Options{DedupStrategy: DedupByContent}, src)
+	page := render(t, tmpl, "page", nil)
+	// a's and print's styles differ by media, and the scripts by type
+	if n := strings.Count(page, ".shared { color: red; }"); n != 2 {
+		t.Errorf("shared style included %d times, want a's and print's:\n%s", n, page)
+	}
+	if !strings.Contains(page, "@media print") {
+		t.Errorf("print style lost its media:\n%s", page)
+	}
+	if n := strings.Count(page, "init();"); n != 2 {
+		t.Errorf("script included %d times, want the classic and module ones:\n%s", n, page)
+	}
+
+	tmpl, _ = compileMap(t, Options{}, src)
+	page = render(t, tmpl, "page", nil)
+	if n := strings.Count(page, ".shared { color: red; }"); n != 3 {
+		t.Errorf("shared style included %d times by component, want 3:\n%s", n, page)
+	}
+}
@@ -0,0 +1,124 @@
+package component
+
+import (
+	"container/list"
+	"html/template"
+	"sync"
+	"time"
+)
+
+// Cache is an in-memory LRU cache of the markup of rendered components.
+// Components opt in by declaring how long their output stays fresh with a
+// cache directive on their template section, e.g.
+//
+//	<template cache="5m">
+//
+// accepting any duration understood by time.ParseDuration. Rendering other
+// components through the cache executes them as usual.
+//
+// A Cache is safe for concurrent use.
+type Cache struct {
+	size int
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[cacheKey]*list.Element
+}
+
+type cacheKey struct {
+	t         *template.Template
+	name, key string
+}
+
+type cacheEntry struct {
+	key     cacheKey
+	out     template.HTML
+	expires time.Time
+}
+
+// NewCache returns a Cache holding at most size rendered components, evicting
+// the least recently used beyond that.
+func NewCache(size int) *Cache {
+	return &Cache{
+		size:    size,
+		order:   list.New(),
+		entries: map[cacheKey]*list.Element{},
+	}
+}
+
+// Render renders the markup of the named component like RenderHTML, using
+// cached output if the component declares a cache directive and was last
+// rendered with the same key within its TTL. The key identifies everything
+// the output depends on, e.g. a product ID, since data isn't compared.
+//
+// The result is a fragment for embedding in a page, e.g. passed as data to
+// another template, so it has no styles or scripts of its own. The page
+// must include them itself, e.g. by including the component elsewhere.
+func (c *Cache) Render(
+	t *template.Template,
+	name, key string,
+	data interface{},
+) (template.HTML, error) {
+	ttl := CacheTTL(t, name)
+	if ttl <= 0 {
+		return RenderHTML(t, name, data)
+	}
+	k := cacheKey{t: t, name: name, key: key}
+	if out, ok := c.get(k); ok {
+		return out, nil
+	}
+	out, err := RenderHTML(t, name, data)
+	if err != nil {
+		return "", err
+	}
+	c.put(k, out, ttl)
+	return out, nil
+}
+
+func (c *Cache) get(k cacheKey) (template.HTML, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[k]
+	if !ok {
+		return "", false
+	}
+	e := el.Value.(*cacheEntry)
+	if time.Now().After(e.expires) {
+		c.order.Remove(el)
+		delete(c.entries, k)
+		return "", false
+	}
+	c.order.MoveToFront(el)
+	return e.out, true
+}
+
+func (c *Cache) put(k cacheKey, out template.HTML, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := &cacheEntry{key: k, out: out, expires: time.Now().Add(ttl)}
+	if el, ok := c.entries[k]; ok {
+		el.Value = e
+		c.order.MoveToFront(el)
+		return
+	}
+	c.entries[k] = c.order.PushFront(e)
+	for c.order.Len() > c.size {
+		el := c.order.Back()
+		c.order.Remove(el)
+		delete(c.entries, el.Value.(*cacheEntry).key)
+	}
+}
+
+// CacheTTL returns how long the named component's output may be cached, as
+// declared by its cache directive, or zero if it has none.
+func CacheTTL(t *template.Template, name string) time.Duration {
+	tt := t.Lookup(name + "#cache")
+	if tt == nil {
+		return 0
+	}
+	ttl, err := time.ParseDuration(string(treeText(tt.Tree)))
+	if err != nil {
+		return 0
+	}
+	return ttl
+}
@@ -0,0 +1,61 @@
+package component
+
+import (
+	"html/template"
+	"strings"
+	"testing"
+)
+
+func TestCacheRender(t *testing.T) {
+	calls := 0
+	fns := template.FuncMap{
+		"count": func() int { calls++; return calls },
+	}
+	src := map[string]string{
+		"card": `<style>.card { color: red; }</style>
+<template cache="1m"><div class="card">{{ .Title }} {{ count }}</div></template>`,
+		"plain": `<template><p>{{ count }}</p></template>`,
+	}
+	tmpl, _ := compileMap(t, Options{Funcs: fns}, src)
+	c := NewCache(10)
+
+	out, err := c.Render(tmpl, "card", "a", map[string]string{"Title": "A"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := template.HTML(`<div class="card">A 1</div>`); out != want {
+		t.Errorf("got %q, want only the card's markup %q", out, want)
+	}
+	// cached, so rendered with the first data
+	out, err = c.Render(tmpl, "card", "a", map[string]string{"Title": "B"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := template.HTML(`<div class="card">A 1</div>`); out != want {
+		t.Errorf("second render = %q, want the cached %q", out, want)
+	}
+	out, err = c.Render(tmpl, "card", "b", map[string]string{"Title": "B"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := template.HTML(`<div class="card">B 2</div>`); out != want {
+		t.Errorf("render with another key = %q, want %q", out, want)
+	}
+
+	// components without a cache directive render every time
+	for i := 3; i <= 4; i++ {
+		out, err := c.Render(tmpl, "plain", "a", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(out), "<html>") || !strings.Contains(string(out), "<p>") {
+			t.Errorf("plain = %q, want its markup alone", out)
+		}
+		if calls != i {
+			t.Errorf("plain rendered %d times in total, want %d", calls, i)
+		}
+	}
+	if ttl := CacheTTL(tmpl, "card"); ttl.String() != "1m0s" {
+		t.Errorf("CacheTTL = %s, want 1m", ttl)
+	}
+}
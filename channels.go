@@ -0,0 +1,86 @@
+package component
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// Channels holds the same components compiled once per output channel, such
+// as "screen" and "print", each with its own Options.
+//
+// Transforms like scoped styles are baked into templates at compile time, so
+// a single compiled template can't produce different output per render.
+// Instead each channel is compiled up front from the same components, and
+// renders select a channel by name.
+type Channels map[string]*template.Template
+
+// CompileDirChannels compiles the components in a directory for each channel
+// with that channel's Options, e.g.
+//
+//	ch, err := component.CompileDirChannels("templates", fns,
+//		map[string]component.Options{
+//			"screen": {},
+//			"print":  {Unscoped: true},
+//		})
+//	err = ch.ExecuteTemplate(w, "print", "invoice", data)
+func CompileDirChannels(
+	dirname string,
+	fns template.FuncMap,
+	channels map[string]Options,
+) (Channels, error) {
+	out := make(Channels, len(channels))
+	for _, channel := range channelNames(channels) {
+		t, err := CompileDir(dirname, fns, channels[channel])
+		if err != nil {
+			return nil, errors.Wrapf(err, "channel %s", channel)
+		}
+		out[channel] = t
+	}
+	return out, nil
+}
+
+// CompileSourcesChannels is like CompileDirChannels for components already
+// in memory.
+func CompileSourcesChannels(
+	sources []Source,
+	fns template.FuncMap,
+	channels map[string]Options,
+) (Channels, error) {
+	out := make(Channels, len(channels))
+	for _, channel := range channelNames(channels) {
+		t, err := CompileSources(sources, fns, channels[channel])
+		if err != nil {
+			return nil, errors.Wrapf(err, "channel %s", channel)
+		}
+		out[channel] = t
+	}
+	return out, nil
+}
+
+// channelNames returns the names of channels in order, so they're compiled,
+// and the first failing one reported, deterministically.
+func channelNames(channels map[string]Options) []string {
+	names := make([]string, 0, len(channels))
+	for name := range channels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ExecuteTemplate renders the named template from the given channel.
+func (c Channels) ExecuteTemplate(
+	w io.Writer,
+	channel, name string,
+	data interface{},
+) error {
+	t, ok := c[channel]
+	if !ok {
+		return fmt.Errorf("unknown channel %s", channel)
+	}
+	return t.ExecuteTemplate(w, name, data)
+}
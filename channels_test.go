@@ -0,0 +1,62 @@
+package component
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestChannels(t *testing.T) {
+	src := map[string]string{
+		"page": `<script>init();</script><template><p>{{ . }}</p></template>`,
+	}
+	channels := map[string]Options{
+		"screen":  {},
+		"guarded": {ScriptGuard: true},
+	}
+	dir := writeDir(t, map[string]string{"page.tmpl": src["page"]})
+	fromDir, err := CompileDirChannels(dir, nil, channels)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromSources, err := CompileSourcesChannels(
+		[]Source{{Name: "page", Content: []byte(src["page"])}}, nil, channels)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, ch := range map[string]Channels{"dir": fromDir, "sources": fromSources} {
+		if len(ch) != len(channels) {
+			t.Errorf("%s: %d channels, want %d", name, len(ch), len(channels))
+		}
+		out := map[string]string{}
+		for channel := range channels {
+			var buf bytes.Buffer
+			if err := ch.ExecuteTemplate(&buf, channel, "page", "hi"); err != nil {
+				t.Fatalf("%s: %s: %v", name, channel, err)
+			}
+			out[channel] = buf.String()
+			if !strings.Contains(out[channel], "<p>hi</p>") {
+				t.Errorf("%s: %s missing markup:\n%s", name, channel, out[channel])
+			}
+		}
+		if strings.Contains(out["screen"], "window.__c_") ||
+			!strings.Contains(out["guarded"], "window.__c_") {
+			t.Errorf("%s: channels don't use their own options:\n%s\n%s",
+				name, out["screen"], out["guarded"])
+		}
+		if err := ch.ExecuteTemplate(&bytes.Buffer{}, "print", "page", nil); err == nil {
+			t.Errorf("%s: unknown channel rendered", name)
+		}
+	}
+
+	// of several failing channels, the first by name is reported
+	bad := Options{Tags: SectionTags{Template: "style"}}
+	for i := 0; i < 10; i++ {
+		_, err := CompileDirChannels(dir, nil, map[string]Options{
+			"b": bad, "a": bad, "c": bad,
+		})
+		if err == nil || !strings.HasPrefix(err.Error(), "channel a:") {
+			t.Fatalf("err = %v, want channel a's", err)
+		}
+	}
+}
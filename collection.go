@@ -0,0 +1,82 @@
+package component
+
+import (
+	"html/template"
+)
+
+// Collection is a set of components which grows over time, e.g. as plugins
+// contribute components after startup. Each addition recompiles the whole
+// set, so components added earlier may include those added later, and
+// returns a new template to replace the previous one.
+//
+// Added components are kept by a Compiler like those registered with
+// Compiler.AddComponent, so the same rules apply to names: a component with
+// the same name as one already in the collection is an error, in which case
+// nothing is added.
+//
+// A Collection isn't safe for concurrent use, but the templates it returns
+// are independent of it and of each other.
+type Collection struct {
+	c *Compiler
+
+	// err is the error from the Options given to NewCollection, returned
+	// by every addition.
+	err error
+}
+
+// NewCollection returns an empty Collection compiling components with fns
+// and opts. Passing more than one Options is an error, returned by each
+// addition.
+func NewCollection(fns template.FuncMap, opts ...Options) *Collection {
+	opt, err := getOptions(opts)
+	return &Collection{c: NewCompiler(withFuncs(opt, fns)), err: err}
+}
+
+// AddDir adds the components in a directory to the collection and compiles
+// it.
+func (c *Collection) AddDir(dirname string) (*template.Template, *Meta, error) {
+	if c.err != nil {
+		return nil, nil, c.err
+	}
+	comps, err := readDir(dirname, c.c.opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := c.c.checkFound(dirname, comps); err != nil {
+		return nil, nil, err
+	}
+	return c.add(comps)
+}
+
+// AddSources is like AddDir for components already in memory.
+func (c *Collection) AddSources(
+	sources []Source,
+) (*template.Template, *Meta, error) {
+	if c.err != nil {
+		return nil, nil, c.err
+	}
+	comps, err := readSources(sources, c.c.opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return c.add(comps)
+}
+
+// add compiles comps along with the components already in the collection,
+// keeping them only if that succeeds.
+func (c *Collection) add(comps []*component) (*template.Template, *Meta, error) {
+	compiled := make([]*component, 0, len(comps))
+	for _, comp := range comps {
+		// compiling transforms components, so keep the originals intact
+		// for the next addition
+		compiled = append(compiled, comp.clone())
+	}
+	t, meta, err := c.c.compile(compiled)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := c.c.addComponents(comps); err != nil {
+		return nil, nil, err
+	}
+	return t, meta, nil
+}
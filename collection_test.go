@@ -0,0 +1,74 @@
+package component
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCollection(t *testing.T) {
+	c := NewCollection(nil)
+	// the page includes a component a plugin adds later
+	base := writeDir(t, map[string]string{
+		"page.tmpl": `<template><main>{{ template "./plugin/card" . }}</main></template>`,
+	})
+	if _, _, err := c.AddDir(base); err != nil {
+		t.Fatal(err)
+	}
+	tmpl, _, err := c.AddSources([]Source{{
+		Name:    "plugin/card",
+		Content: []byte(`<style>.card { margin: 0; }</style><template><div class="card">{{ . }}</div></template>`),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := render(t, tmpl, "page", "hi")
+	if !strings.Contains(page, `<main><div class="card">hi</div></main>`) ||
+		!strings.Contains(page, ".card { margin: 0; }") {
+		t.Errorf("page doesn't include the added card:\n%s", page)
+	}
+
+	// a name already in the collection is an error, and nothing is added
+	_, _, err = c.AddSources([]Source{
+		{Name: "plugin/other", Content: []byte(`<template>other</template>`)},
+		{Name: "page", Content: []byte(`<template>replaced</template>`)},
+	})
+	if err == nil || !strings.Contains(err.Error(), "duplicate component page") {
+		t.Errorf("err = %v, want a duplicate component error", err)
+	}
+	// so is one which fails to compile
+	_, _, err = c.AddSources([]Source{
+		{Name: "plugin/broken", Content: []byte(`<template>{{ if }}</template>`)},
+	})
+	if err == nil {
+		t.Error("expected an error compiling a broken component")
+	}
+	tmpl, _, err = c.AddSources([]Source{
+		{Name: "plugin/other", Content: []byte(`<template>other</template>`)},
+	})
+	if err != nil {
+		t.Fatalf("components from failed additions were kept: %v", err)
+	}
+	if got := render(t, tmpl, "page#template", "hi"); !strings.Contains(got, "hi") {
+		t.Errorf("page = %q, want the original", got)
+	}
+	if tmpl.Lookup("plugin/broken") != nil {
+		t.Error("broken component was added")
+	}
+}
+
+func TestCollectionAddComponentNames(t *testing.T) {
+	// collisions are checked in one place, whichever way components are
+	// added
+	c := NewCompiler(Options{})
+	if err := c.AddComponent("card", map[string]string{"template": "x"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err := c.Map(map[string][]byte{"card": []byte("<template>y</template>")})
+	if err == nil || !strings.Contains(err.Error(), "duplicate component card") {
+		t.Errorf("err = %v, want a duplicate component error", err)
+	}
+	if err := c.AddComponent("card", map[string]string{"template": "y"}, nil); err == nil ||
+		!strings.Contains(err.Error(), "duplicate component card") {
+		t.Errorf("err = %v, want a duplicate component error", err)
+	}
+}
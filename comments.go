@@ -0,0 +1,59 @@
+package component
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// commentFunc is the name of the template function outputting a comment
+// kept by Options.StripComments.
+const commentFunc = "componentComment"
+
+// comment outputs an HTML comment as is. html/template drops comments from
+// templates, so those kept are output by this function instead. They're
+// written by a component's author, never taken from data.
+func comment(s string) template.HTML {
+	return template.HTML(s)
+}
+
+// keepComment reports whether a comment's text marks it to be kept by
+// Options.StripComments: a conditional comment like <!--[if IE]>, or one
+// beginning with "!" like <!--! license -->.
+func keepComment(text string) bool {
+	return strings.HasPrefix(text, "[if ") || strings.HasPrefix(text, "[endif]") ||
+		strings.HasPrefix(text, "<![endif]") || strings.HasPrefix(text, "!")
+}
+
+// stripComments removes the HTML comments from template section markup,
+// replacing those marked to be kept with calls to componentComment so they
+// survive rendering. See Options.StripComments.
+func stripComments(src []byte) ([]byte, error) {
+	toks, err := tokenizeMarkup(src)
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	last := 0
+	for _, t := range toks {
+		if t.Type != html.CommentToken {
+			continue
+		}
+		b.Write(src[last:t.start])
+		last = t.end
+		raw := string(src[t.start:t.end])
+		if !keepComment(t.Data) {
+			continue
+		}
+		if strings.Contains(raw, "{{") {
+			return nil, fmt.Errorf("kept comment %s uses actions", truncate(raw))
+		}
+		b.WriteString("{{ " + commentFunc + " " + strconv.Quote(raw) + " }}")
+	}
+	b.Write(src[last:])
+	return b.Bytes(), nil
+}
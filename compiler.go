@@ -0,0 +1,271 @@
+package component
+
+import (
+	"fmt"
+	"html/template"
+	"io/fs"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Compiler compiles components with a fixed set of Options. It's
+// equivalent to the Compile functions, which wrap it, but keeps
+// configuration in one place as it grows, e.g.
+//
+//	c := component.NewCompiler(component.Options{
+//		Funcs:              fns,
+//		CollapseWhitespace: true,
+//	})
+//	t, meta, err := c.Dir("templates")
+//
+// A Compiler is safe for concurrent use.
+type Compiler struct {
+	opts Options
+
+	mu    sync.Mutex
+	added []*component
+
+	// cur is the template last compiled by Dir or FS, and read compiles
+	// the same components again for Reload.
+	curMu sync.RWMutex
+	cur   *template.Template
+	read  func() ([]*component, error)
+}
+
+// NewCompiler returns a Compiler using opts.
+func NewCompiler(opts Options) *Compiler {
+	return &Compiler{opts: opts}
+}
+
+// Dir compiles the components in a directory. See CompileDir.
+func (c *Compiler) Dir(dirname string) (*template.Template, *Meta, error) {
+	return c.compileFrom(func() ([]*component, error) {
+		comps, err := readDir(dirname, c.opts)
+		if err != nil {
+			return nil, err
+		}
+		return comps, c.checkFound(dirname, comps)
+	})
+}
+
+// FS compiles the components in the root directory of fsys, e.g. "." for
+// all of them or "templates" for those under templates/. Component names
+// are relative to root. See CompileFS.
+func (c *Compiler) FS(fsys fs.FS, root string) (*template.Template, *Meta, error) {
+	if root != "." && root != "" {
+		sub, err := fs.Sub(fsys, root)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "sub fs")
+		}
+		fsys = sub
+	}
+	return c.compileFrom(func() ([]*component, error) {
+		comps, err := readFS(fsys, "", c.opts)
+		if err != nil {
+			return nil, err
+		}
+		if root == "" {
+			root = "."
+		}
+		return comps, c.checkFound(root, comps)
+	})
+}
+
+// checkFound is like requireComponents, but also accepts an empty dirname
+// if components were added with AddComponent.
+func (c *Compiler) checkFound(dirname string, comps []*component) error {
+	c.mu.Lock()
+	added := len(c.added)
+	c.mu.Unlock()
+	if added > 0 {
+		return nil
+	}
+	return requireComponents(dirname, comps)
+}
+
+// compileFrom compiles the components read, recording the result for
+// Template and how to read them again for Reload.
+func (c *Compiler) compileFrom(
+	read func() ([]*component, error),
+) (*template.Template, *Meta, error) {
+	comps, err := read()
+	if err != nil {
+		return nil, nil, err
+	}
+	t, meta, err := c.compile(comps)
+	if err != nil {
+		return nil, nil, err
+	}
+	c.curMu.Lock()
+	c.cur, c.read = t, read
+	c.curMu.Unlock()
+	return t, meta, nil
+}
+
+// Reload compiles the components last compiled by Dir or FS again and, if
+// that succeeds, replaces the template returned by Template, e.g. from a
+// signal handler or an admin endpoint to pick up changed templates without
+// restarting. If it fails, Template keeps returning the previous template.
+func (c *Compiler) Reload() error {
+	c.curMu.RLock()
+	read := c.read
+	c.curMu.RUnlock()
+	if read == nil {
+		return errors.New("nothing to reload: compile with Dir or FS first")
+	}
+	_, _, err := c.compileFrom(read)
+	return err
+}
+
+// Template returns the template last compiled by Dir, FS, or Reload, or nil
+// if there's none. Look it up for every render rather than keeping it, so
+// renders pick up reloads:
+//
+//	c.Template().ExecuteTemplate(w, "home", data)
+//
+// Renders already underway finish with the template they started with.
+func (c *Compiler) Template() *template.Template {
+	c.curMu.RLock()
+	defer c.curMu.RUnlock()
+	return c.cur
+}
+
+// Map compiles components from memory, mapping each component's name to its
+// content. See Source for how names are interpreted.
+func (c *Compiler) Map(sources map[string][]byte) (*template.Template, *Meta, error) {
+	names := make([]string, 0, len(sources))
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	srcs := make([]Source, 0, len(sources))
+	for _, name := range names {
+		srcs = append(srcs, Source{Name: name, Content: sources[name]})
+	}
+	return c.sources(srcs)
+}
+
+func (c *Compiler) sources(sources []Source) (*template.Template, *Meta, error) {
+	comps, err := readSources(sources, c.opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return c.compile(comps)
+}
+
+// AddComponent registers a component built in code rather than parsed from
+// a file, e.g. one which is generated, to be compiled along with the
+// components of every later call. Sections maps section names, "style",
+// "script", "template", and "jsonld", or those of Options.CustomSections,
+// to their content.
+//
+// Deps lists the components it includes, e.g. "forms/button", which are
+// used instead of those found in its template. This is useful when the
+// includes are known but can't be found by parsing, and the components
+// listed have their styles and scripts added to pages including this one.
+func (c *Compiler) AddComponent(
+	name string,
+	sections map[string]string,
+	deps []string,
+) error {
+	name, err := sourceName(name)
+	if err != nil {
+		return err
+	}
+	comp := &component{
+		name:     name,
+		sections: map[string][]byte{},
+		attrs:    map[string]map[string]string{},
+		file:     name,
+		offsets:  map[string]int{},
+		deps:     map[string]bool{},
+	}
+	for section, content := range sections {
+		switch section {
+		case "style", "script", "template", jsonLDSection:
+			comp.sections[section] = []byte(content)
+		default:
+			if _, ok := c.opts.CustomSections[section]; !ok {
+				return fmt.Errorf("unknown section %s in %s", section, name)
+			}
+			comp.sections[section] = []byte(content)
+		}
+	}
+	for _, dep := range deps {
+		dep, err := sourceName(dep)
+		if err != nil {
+			return errors.Wrapf(err, "dependency of %s", name)
+		}
+		comp.deps[dep] = true
+	}
+	return c.addComponents([]*component{comp})
+}
+
+// addComponents registers comps to be compiled along with the components of
+// every later call, failing if any has the name of one already registered.
+func (c *Compiler) addComponents(comps []*component) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := checkDuplicates(c.added, comps); err != nil {
+		return err
+	}
+	c.added = append(c.added, comps...)
+	return nil
+}
+
+// checkDuplicates fails if any of comps has the name of one of existing,
+// naming each such component.
+func checkDuplicates(existing, comps []*component) error {
+	names := make(map[string]bool, len(existing))
+	for _, comp := range existing {
+		names[comp.name] = true
+	}
+	var dupes []string
+	for _, comp := range comps {
+		if names[comp.name] {
+			dupes = append(dupes, comp.name)
+		}
+	}
+	switch len(dupes) {
+	case 0:
+		return nil
+	case 1:
+		return fmt.Errorf("duplicate component %s", dupes[0])
+	}
+	sort.Strings(dupes)
+	return fmt.Errorf("duplicate components %s", strings.Join(dupes, ", "))
+}
+
+// compile compiles comps along with the components added by AddComponent.
+func (c *Compiler) compile(comps []*component) (*template.Template, *Meta, error) {
+	c.mu.Lock()
+	added := make([]*component, 0, len(c.added))
+	for _, comp := range c.added {
+		added = append(added, comp.clone())
+	}
+	c.mu.Unlock()
+	if err := checkDuplicates(added, comps); err != nil {
+		return nil, nil, err
+	}
+	return compile(append(comps, added...), c.opts)
+}
+
+// withFuncs returns opt with fns added to its Funcs. Functions in fns take
+// precedence.
+func withFuncs(opt Options, fns template.FuncMap) Options {
+	if len(fns) == 0 {
+		return opt
+	}
+	all := make(template.FuncMap, len(opt.Funcs)+len(fns))
+	for k, v := range opt.Funcs {
+		all[k] = v
+	}
+	for k, v := range fns {
+		all[k] = v
+	}
+	opt.Funcs = all
+	return opt
+}
@@ -0,0 +1,58 @@
+package component
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompilerReload(t *testing.T) {
+	c := NewCompiler(Options{})
+	if c.Template() != nil {
+		t.Error("Template before compiling isn't nil")
+	}
+	if err := c.Reload(); err == nil {
+		t.Error("Reload before compiling succeeded")
+	}
+
+	dir := writeDir(t, map[string]string{"page.tmpl": "<template>v1</template>"})
+	if _, _, err := c.Dir(dir); err != nil {
+		t.Fatal(err)
+	}
+	first := c.Template()
+	if page := render(t, first, "page#template", nil); page != "v1" {
+		t.Fatalf("page = %q", page)
+	}
+	write := func(content string) {
+		t.Helper()
+		err := os.WriteFile(filepath.Join(dir, "page.tmpl"), []byte(content), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a failed reload keeps the template
+	write("<template>{{ if }}</template>")
+	if err := c.Reload(); err == nil {
+		t.Fatal("reloading a broken component succeeded")
+	}
+	if c.Template() != first {
+		t.Error("failed reload replaced the template")
+	}
+
+	write("<template>v2</template>")
+	if err := c.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if c.Template() == first {
+		t.Fatal("reload kept the old template")
+	}
+	if page := render(t, c.Template(), "page#template", nil); page != "v2" {
+		t.Errorf("reloaded page = %q", page)
+	}
+	// the old template still renders the old version
+	if page := render(t, first, "page#template", nil); !strings.Contains(page, "v1") {
+		t.Errorf("old template renders %q", page)
+	}
+}
@@ -1,160 +1,1262 @@
-// package component generates HTML templates from single-file components,
-// similar to Vue.js or Svbtle. Single-file components contain the style,
-// scripts, and structure to render a given component, rather than placing
-// styles and scripts in separate directories.
-//
-// Go's stdlib and HTML templates get us 90% of the way to single-file
-// components, but they have a drawback preventing their use for this purpose:
-// since single-file components embed style and script tags, including the same
-// template 100 times (such as for an item in a list) would include the
-// associated script and style tags 100 times and create tons of bloat.
-// Instead, for any template included as a partial, this package ensures only 1
-// copy of its script and style tags are included. For example, if the same
-// template is included twice, component excludes the second one's duplicated
-// style and script tags.
-//
-// To prevent namespace collisions, you should namespace each of your styles
-// and Javascript functions under a name matching the component, however this
-// is not enforced by the package.
 package component
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"fmt"
 	"html/template"
 	"io"
+	"io/fs"
 	"os"
 	"path"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"text/template/parse"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/pkg/errors"
 	"golang.org/x/net/html"
 )
 
 // CompileDir recursively walks the given directory to compile component
-// templates, which are identified by the ".tmpl" extension.
+// templates, which are identified by the ".tmpl" extension. Each is named by
+// its path relative to dirname, e.g. "templates/graphs/user.tmpl" becomes
+// "graphs/user", so rendering it is simply:
+//
+//	err := t.ExecuteTemplate(out, "graphs/user", nil)
+//
+// See the package documentation for how components are written and include
+// one another.
 //
-// Components may only have <style>, <script>, and <template> root tags. The
-// structure of the component, e.g. the text and divs that make it up, should
-// go in the <template> tag.
+// A directory without any components, e.g. one which is empty, fails with a
+// *DirError reporting ErrNoComponents rather than compiling a template with
+// nothing to render.
 //
-// To use the returned template, or render a specific page, simply call:
+// Compilation may be customized by passing Options. At most one Options may be
+// given, and passing more is an error.
 //
-//	err := t.ExecuteTemplate(out, "./homepage", nil).
+// The package keeps no mutable state between compilations, so CompileDir
+// and the other Compile functions may be called concurrently, even on the
+// same directory, and compiling the same components always gives the same
+// result. The only state shared by compiled templates is the counter
+// behind $instance IDs, which is atomic.
+func CompileDir(
+	dirname string,
+	fns template.FuncMap,
+	opts ...Options,
+) (*template.Template, error) {
+	t, _, err := CompileDirMeta(dirname, fns, opts...)
+	return t, err
+}
+
+// CompileDirMeta is like CompileDir but also returns metadata about the
+// compiled components, such as warnings found along the way.
+func CompileDirMeta(
+	dirname string,
+	fns template.FuncMap,
+	opts ...Options,
+) (*template.Template, *Meta, error) {
+	opt, err := getOptions(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return NewCompiler(withFuncs(opt, fns)).Dir(dirname)
+}
+
+// CompileFS is like CompileDir but reads components from fsys, e.g. an
+// embed.FS. Component names are relative to the root of fsys, so use fs.Sub
+// to compile a subdirectory.
 //
-// Note that we use a relative path with a forward slash (on any platform --
-// even on Windows). Names for templates are defined automatically based on the
-// name of the file it was drawn from. e.g. assume we have one file named
-// "templates/analytics.tmpl" and another named "templates/graphs/user.tmpl":
+// Archives implementing fs.FS work too, so a zip file of templates needn't
+// be extracted first:
 //
-//	// main.go
-//	t, err := component.CompileDir("templates")
+//	zr, err := zip.OpenReader("templates.zip")
 //	if err != nil {
 //		return err
 //	}
-//	err = t.ExecuteTemplate(out, "./analytics", nil)
-//	// Or...
-//	err = t.ExecuteTemplate(out, "./graphs/user", nil)
+//	defer zr.Close()
+//	t, err := component.CompileFS(zr, fns)
 //
-// to render our analytics page on its own. Rendering one template within
-// another as a partial stays the same, although we use a relative path, such
-// as in the following example:
-//
-//	// analytics.tmpl
-//	<template>
-//		<h1>Analytics</h1>
-//		{{ template "./analytics/graphs/users" . }}
-//	</template>
-//
-// Again, note the leading "./" in the path.
-//
-// You can also define and re-use templates locally within a component. For
-// locally defined templates only used within a single component, do not
-// prepend "./", e.g.:
-//
-//	// analytics.tmpl
-//	{{ define "local" }}<p>Local Template!</p>{{ end }}
-//	<template>
-//		<h1>Analytics</h1>
-//		{{ template "local" }}
-//	</template>
-//
-// You'll find more examples in the package's templates/ directory.
-func CompileDir(
-	dirname string,
+// archive/zip normalizes entry names, including Windows path separators.
+// See ReadTar for tar archives.
+func CompileFS(
+	fsys fs.FS,
 	fns template.FuncMap,
+	opts ...Options,
 ) (*template.Template, error) {
-	all := template.New("").Funcs(fns)
-	dependencies := map[string]map[string]bool{}
-	allNames := map[string]bool{}
-	err := filepath.Walk(dirname, func(fpath string, info os.FileInfo, err error) error {
-		if info == nil {
+	t, _, err := CompileFSMeta(fsys, fns, opts...)
+	return t, err
+}
+
+// CompileFSMeta is like CompileFS but also returns metadata about the
+// compiled components.
+func CompileFSMeta(
+	fsys fs.FS,
+	fns template.FuncMap,
+	opts ...Options,
+) (*template.Template, *Meta, error) {
+	opt, err := getOptions(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return NewCompiler(withFuncs(opt, fns)).FS(fsys, ".")
+}
+
+// Validate checks the components in a directory without building the final
+// template, which makes it a fast correctness gate, e.g. in a pre-commit
+// hook. It runs the same parsing, dependency, and cycle checks as
+// CompileDir, and additionally treats references to undefined templates as
+// errors, returning the first problem found.
+func Validate(dirname string, fns template.FuncMap, opts ...Options) error {
+	opt, err := getOptions(opts)
+	if err != nil {
+		return err
+	}
+	opt = withFuncs(opt, fns)
+	comps, err := readDir(dirname, opt)
+	if err != nil {
+		return err
+	}
+	if err := requireComponents(dirname, comps); err != nil {
+		return err
+	}
+	b := newBuilder(opt)
+	if err := b.addAll(comps); err != nil {
+		return err
+	}
+	if err := b.check(); err != nil {
+		return err
+	}
+	for _, w := range b.meta.Warnings {
+		if w.Kind == WarnUndefinedTemplate {
+			log(opt.Logger, Event{
+				Kind:      EventCheckFailed,
+				Component: w.Component,
+				Message:   w.Message,
+			})
+			return errors.New(w.String())
+		}
+	}
+	return nil
+}
+
+// readDir recursively reads and parses the components in a directory.
+func readDir(dirname string, opt Options) ([]*component, error) {
+	if err := checkDir(dirname); err != nil {
+		return nil, err
+	}
+	if !opt.FollowSymlinks {
+		return readFS(os.DirFS(dirname), dirname, opt)
+	}
+	real, err := filepath.EvalSymlinks(dirname)
+	if err != nil {
+		return nil, &DirError{Dir: dirname, Err: err}
+	}
+	r := &fsReader{opt: opt, followLinks: true}
+	if err := r.walk(os.DirFS(dirname), dirname, "", []string{real}); err != nil {
+		return nil, errors.Wrap(err, "walk directory")
+	}
+	return r.comps, nil
+}
+
+// ErrNotDir is the DirError.Err reported when the path to compile is a file.
+var ErrNotDir = errors.New("not a directory")
+
+// ErrNoComponents is the DirError.Err reported when the directory to compile
+// has no components, e.g. because it's empty or has no ".tmpl" files. Every
+// function reading components from a directory reports it, including
+// Validate and SelectorReport.
+var ErrNoComponents = errors.New("no components found")
+
+// requireComponents returns a *DirError reporting ErrNoComponents if no
+// components were read from dirname, since rendering from the empty
+// template would only fail later.
+func requireComponents(dirname string, comps []*component) error {
+	if len(comps) == 0 {
+		return &DirError{Dir: dirname, Err: ErrNoComponents}
+	}
+	return nil
+}
+
+// DirError is returned when the directory to compile can't be read, e.g.
+// because it doesn't exist, isn't a directory, or permission is denied, or
+// has no components. Err is ErrNotDir, ErrNoComponents, or the error from
+// opening the directory, so use errors.Is to check for fs.ErrNotExist or
+// fs.ErrPermission.
+type DirError struct {
+	Dir string
+	Err error
+}
+
+func (e *DirError) Error() string {
+	return fmt.Sprintf("component directory %q: %v", e.Dir, e.Err)
+}
+
+func (e *DirError) Unwrap() error { return e.Err }
+
+// checkDir returns a *DirError unless dirname is a readable directory.
+func checkDir(dirname string) error {
+	if dirname == "" {
+		// os.DirFS("") is the filesystem root, not the working directory
+		return &DirError{Dir: dirname, Err: fs.ErrNotExist}
+	}
+	f, err := os.Open(dirname)
+	if err != nil {
+		return &DirError{Dir: dirname, Err: err}
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return &DirError{Dir: dirname, Err: err}
+	}
+	if !fi.IsDir() {
+		return &DirError{Dir: dirname, Err: ErrNotDir}
+	}
+	return nil
+}
+
+// readFS recursively reads and parses the components in fsys. Paths in
+// errors and events are reported within root, if given.
+func readFS(fsys fs.FS, root string, opt Options) ([]*component, error) {
+	r := &fsReader{opt: opt}
+	if err := r.walk(fsys, root, "", nil); err != nil {
+		return nil, errors.Wrap(err, "walk directory")
+	}
+	return r.comps, nil
+}
+
+// fsReader reads the components in a directory tree.
+type fsReader struct {
+	opt   Options
+	comps []*component
+
+	// files maps the name of each component read to its path, to catch
+	// names shared by several files. See Options.NameFunc.
+	files map[string]string
+
+	// followLinks follows symlinks to directories, which only works for
+	// directories on disk. See Options.FollowSymlinks.
+	followLinks bool
+}
+
+// walk reads the components in fsys, which is the directory prefix within
+// the compiled directory. Paths in errors and events are reported within
+// root, if given. Ancestors are the real paths of the directories being
+// walked, to detect symlink cycles.
+func (r *fsReader) walk(fsys fs.FS, root, prefix string, ancestors []string) error {
+	opt := r.opt
+	return fs.WalkDir(fsys, ".", func(rel string, d fs.DirEntry, err error) error {
+		fpath := rel
+		if root != "" {
+			fpath = filepath.Join(root, filepath.FromSlash(rel))
+		}
+		if d == nil {
 			return fmt.Errorf("%s does not exist", fpath)
 		}
-		if info.IsDir() || !strings.HasSuffix(fpath, ".tmpl") {
+		full := path.Join(prefix, rel)
+		if opt.Skip != nil && rel != "." && opt.Skip(full, d) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
 			return nil
 		}
-		rel, err := filepath.Rel(dirname, fpath)
+		if r.followLinks && d.Type()&fs.ModeSymlink != 0 {
+			target, err := filepath.EvalSymlinks(fpath)
+			if err != nil {
+				return err
+			}
+			fi, err := os.Stat(target)
+			if err != nil {
+				return err
+			}
+			if fi.IsDir() {
+				for _, a := range ancestors {
+					if a == target || strings.HasPrefix(a, target+string(filepath.Separator)) {
+						return fmt.Errorf("symlink cycle: %s links to %s, which contains it",
+							fpath, target)
+					}
+				}
+				linked := append(ancestors[:len(ancestors):len(ancestors)], target)
+				return r.walk(os.DirFS(target), fpath, full, linked)
+			}
+		}
+		if d.IsDir() {
+			return nil
+		}
+		nameFunc := opt.NameFunc
+		if nameFunc == nil {
+			nameFunc = pathName
+		}
+		name, ok := nameFunc(full)
+		if !ok {
+			return nil
+		}
+		if err := checkName(name); err != nil {
+			return errors.Wrap(err, fpath)
+		}
+		if other, ok := r.files[name]; ok {
+			return fmt.Errorf("%s and %s are both named %s", other, fpath, name)
+		}
+		if r.files == nil {
+			r.files = map[string]string{}
+		}
+		r.files[name] = fpath
+		log(opt.Logger, Event{
+			Kind:      EventFile,
+			Component: name,
+			Path:      fpath,
+			Message:   "found component",
+		})
+		var src io.Reader
+		if opt.ReadTimeout > 0 {
+			data, err := readTimeout(fsys, rel, opt.ReadTimeout)
+			if err != nil {
+				return errors.Wrap(err, fpath)
+			}
+			src = bytes.NewReader(data)
+		} else {
+			f, err := fsys.Open(rel)
+			if err != nil {
+				return errors.Wrap(err, "open file")
+			}
+			defer f.Close()
+			src = f
+		}
+		c, err := parseComponent(name, fpath, src, opt)
 		if err != nil {
-			return errors.Wrap(err, "filepath rel")
+			return errors.Wrap(err, fpath)
 		}
-		rel = strings.Replace(rel, string(os.PathSeparator), "/", -1)
-		name := strings.TrimSuffix(rel, ".tmpl")
-		rel = path.Dir(rel)
-		f, err := os.Open(fpath)
+		c.fsys, c.path = fsys, rel
+		r.comps = append(r.comps, c)
+		return nil
+	})
+}
+
+// pathName names a component by its path within the compiled directory
+// without its ".tmpl" extension, skipping any other files. See
+// Options.NameFunc.
+func pathName(rel string) (string, bool) {
+	if !strings.HasSuffix(rel, ".tmpl") {
+		return "", false
+	}
+	return strings.TrimSuffix(rel, ".tmpl"), true
+}
+
+// readTimeout opens and reads a file, failing if it takes longer than d. A
+// read which never returns is abandoned rather than canceled, since fs.FS
+// has no way to interrupt it.
+func readTimeout(fsys fs.FS, name string, d time.Duration) ([]byte, error) {
+	type result struct {
+		data []byte
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		data, err := fs.ReadFile(fsys, name)
+		done <- result{data, err}
+	}()
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case res := <-done:
+		return res.data, res.err
+	case <-timer.C:
+		return nil, fmt.Errorf("read timed out after %s", d)
+	}
+}
+
+// Source is the content of a single component, for compiling components
+// which have already been loaded into memory.
+type Source struct {
+	// Name identifies the component. It's the path of the component
+	// relative to the root of the template directory, using forward
+	// slashes and without the ".tmpl" extension, e.g. "graphs/user".
+	//
+	// Name determines how other components refer to this one, exactly as if
+	// it were a file on disk: "analytics" includes it with
+	// {{ template "./graphs/user" . }}, and "graphs/chart" includes it with
+	// {{ template "./user" . }}. Pages are rendered by Name.
+	//
+	// Name may contain spaces and any Unicode, e.g. "icons/star@2x", but not
+	// "#", "~", or control characters.
+	Name string
+
+	// Content is the component's single-file source, containing its
+	// <style>, <script>, and <template> tags.
+	Content []byte
+
+	// File optionally records where the source came from, e.g. a path or
+	// a git object, for use in error messages.
+	File string
+}
+
+// CompileSources compiles components from sources already in memory,
+// following the same rules as CompileDir. This lets integrations which load
+// templates from somewhere other than disk, such as a database or git
+// object store, skip a round trip through the filesystem.
+func CompileSources(
+	sources []Source,
+	fns template.FuncMap,
+	opts ...Options,
+) (*template.Template, error) {
+	t, _, err := CompileSourcesMeta(sources, fns, opts...)
+	return t, err
+}
+
+// CompileSourcesMeta is like CompileSources but also returns metadata about
+// the compiled components.
+func CompileSourcesMeta(
+	sources []Source,
+	fns template.FuncMap,
+	opts ...Options,
+) (*template.Template, *Meta, error) {
+	opt, err := getOptions(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return NewCompiler(withFuncs(opt, fns)).sources(sources)
+}
+
+// readSources parses components from sources.
+func readSources(sources []Source, opt Options) ([]*component, error) {
+	comps := make([]*component, 0, len(sources))
+	seen := map[string]bool{}
+	for _, src := range sources {
+		name, err := sourceName(src.Name)
 		if err != nil {
-			return errors.Wrap(err, "open file")
+			return nil, err
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate component %s", name)
 		}
-		sectionData, scopedStyle, err := splitTemplate(f)
+		seen[name] = true
+		file := src.File
+		if file == "" {
+			file = name
+		}
+		c, err := parseComponent(name, file, bytes.NewReader(src.Content), opt)
 		if err != nil {
-			f.Close()
+			return nil, errors.Wrap(err, file)
+		}
+		comps = append(comps, c)
+	}
+	return comps, nil
+}
+
+// sourceName validates and normalizes the name of a Source.
+func sourceName(name string) (string, error) {
+	clean := strings.TrimSuffix(path.Clean(name), ".tmpl")
+	switch {
+	case name == "", clean == ".":
+		return "", errors.New("source missing name")
+	case path.IsAbs(clean), clean == "..", strings.HasPrefix(clean, "../"):
+		return "", fmt.Errorf("source name %s escapes the template root", name)
+	}
+	if err := checkName(clean); err != nil {
+		return "", err
+	}
+	return clean, nil
+}
+
+// checkName reports an error for component names which can't be referred
+// to reliably. Names may contain spaces and any Unicode, but "#" and "~"
+// delimit the internal names of sections and local templates. Templates
+// generated while compiling are named with a leading "#", e.g. "#themes", so
+// they can't collide with a component.
+func checkName(name string) error {
+	if !utf8.ValidString(name) {
+		return fmt.Errorf("component name %q is not valid UTF-8", name)
+	}
+	if i := strings.IndexAny(name, "#~"); i >= 0 {
+		return fmt.Errorf("component name %q may not contain %q",
+			name, name[i])
+	}
+	for _, r := range name {
+		if unicode.IsControl(r) {
+			return fmt.Errorf("component name %q may not contain control characters",
+				name)
+		}
+	}
+	return nil
+}
+
+// component is a single parsed component.
+type component struct {
+	name     string
+	sections map[string][]byte
+
+	// attrs holds the attributes of each section's tag.
+	attrs map[string]map[string]string
+
+	// file is where the component was read from, and offsets holds the
+	// number of lines in the file preceding each section's content.
+	file    string
+	offsets map[string]int
+
+	// fsys and path locate the component's file within the directory tree
+	// it was read from, if any, to read the files it references.
+	fsys fs.FS
+	path string
+
+	// deps, if set, are the components this one includes, given rather
+	// than found in its template. See Compiler.AddComponent.
+	deps map[string]bool
+}
+
+func parseComponent(
+	name, file string,
+	r io.Reader,
+	opt Options,
+) (*component, error) {
+	tags, err := opt.sectionTags()
+	if err != nil {
+		return nil, err
+	}
+	if opt.StrictSections {
+		src, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkSections(src, tags); err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(src)
+	}
+	sections, attrs, offsets, order, err := splitTemplate(r, tags, sourceSize(r))
+	if err != nil {
+		return nil, err
+	}
+	if len(opt.EnforceSectionOrder) > 0 {
+		if err := checkSectionOrder(order, opt.EnforceSectionOrder); err != nil {
+			return nil, err
+		}
+	}
+	return &component{
+		name:     name,
+		sections: sections,
+		attrs:    attrs,
+		file:     file,
+		offsets:  offsets,
+	}, nil
+}
+
+// clone returns a copy of c which may be compiled without modifying c.
+func (c *component) clone() *component {
+	cp := *c
+	cp.sections = make(map[string][]byte, len(c.sections))
+	for k, v := range c.sections {
+		cp.sections[k] = v
+	}
+	return &cp
+}
+
+// hasAttr reports whether the tag of the given section has an attribute,
+// e.g. c.hasAttr("style", "scoped") for <style scoped>.
+func (c *component) hasAttr(section, key string) bool {
+	_, ok := c.attrs[section][key]
+	return ok
+}
+
+// builder holds the state of a single compilation. Compiling happens in
+// phases: add parses each component's sections, check verifies the
+// components fit together, and link assembles the final template. Validate
+// stops before linking.
+type builder struct {
+	fns   template.FuncMap
+	opts  Options
+	meta  *Meta
+	comps []*component
+
+	// trees are the parsed sections and local templates of every
+	// component, and markup is the subset parsed from <template> sections.
+	trees  []*parse.Tree
+	markup []*parse.Tree
+
+	// dependencies maps each component to the components it includes.
+	dependencies map[string]map[string]bool
+
+	// allNames holds every section name either defined or referenced, and
+	// defined holds every template name actually defined.
+	allNames map[string]bool
+	defined  map[string]bool
+
+	// refs maps each component to the templates it references.
+	refs map[string]map[string]bool
+
+	// pure holds the names of components marked <template pure>.
+	pure map[string]bool
+
+	// sorted holds each component's dependencies in the order their
+	// assets should be included.
+	sorted map[string][]string
+
+	// assets holds the sections compiled to external files, keyed by
+	// section name, e.g. "list/item#style".
+	assets map[string]*Asset
+
+	// atRules maps each component to the names of the templates holding
+	// the at-rules hoisted out of its style by Options.DedupAtRules.
+	atRules map[string][]string
+
+	// media maps each component to its rules for each media query,
+	// hoisted out of its style by Options.GroupMedia.
+	media map[string][]mediaGroup
+
+	// elements maps the custom element names and symbol IDs derived from
+	// component names back to the component using each.
+	elements map[string]string
+
+	// progressive maps each component marked <template progressive> to
+	// the number of parts its markup was split into.
+	progressive map[string]int
+
+	// after maps each component to the components its assets must follow,
+	// as declared by <style after="...">.
+	after map[string][]string
+
+	// known holds the name of every component compiled together, and set
+	// is the linked template, which renders slots.
+	known map[string]bool
+	set   *template.Template
+
+	// exists, if set, reports whether a component not yet known exists,
+	// for finding components as they're included. See CompilePage.
+	exists func(name string) bool
+
+	// critical holds the names of components marked <script critical>.
+	critical map[string]bool
+
+	// extends maps each component marked <template extends="..."> to the
+	// component it extends.
+	extends map[string]string
+
+	// modules maps each component whose module script is bundled, and
+	// each file imported by one, to what it imports. See
+	// Options.BundleModules.
+	modules map[string]*moduleInfo
+
+	// moduleScripts holds the names of components marked
+	// <script type="module">.
+	moduleScripts map[string]bool
+
+	// sectionRefs maps each component to the sections of others it
+	// includes explicitly, e.g. "card#style" for "./card#style".
+	sectionRefs map[string]map[string]bool
+
+	// styleMedia maps each component marked <style media="..."> to its
+	// style's media condition.
+	styleMedia map[string]string
+
+	// contentHash maps static style and script sections to a hash of
+	// their content and how they're included, for
+	// Options.DedupStrategy.
+	contentHash map[string][sha256.Size]byte
+
+	// vendor maps each component marked <script vendor> whose script is
+	// bundled with the others to the script. See Options.ExternalAssets.
+	vendor map[string][]byte
+
+	// rawSizes maps each section to its size as written, and pageParts
+	// each page to the templates it inlines, for Meta.PageSizes.
+	rawSizes  map[string]int
+	pageParts map[string]pageParts
+}
+
+func newBuilder(opts Options) *builder {
+	b := &builder{
+		opts: opts,
+		meta: &Meta{
+			Sources:     map[string]SourceLocation{},
+			Pages:       map[string][]*Asset{},
+			DataFields:  map[string][]string{},
+			PageSizes:   map[string]PageSize{},
+			crossOrigin: opts.Integrity,
+			assetPrefix: opts.AssetPrefix,
+		},
+		dependencies:  map[string]map[string]bool{},
+		allNames:      map[string]bool{},
+		defined:       map[string]bool{},
+		refs:          map[string]map[string]bool{},
+		pure:          map[string]bool{},
+		sorted:        map[string][]string{},
+		assets:        map[string]*Asset{},
+		atRules:       map[string][]string{},
+		media:         map[string][]mediaGroup{},
+		elements:      map[string]string{},
+		progressive:   map[string]int{},
+		after:         map[string][]string{},
+		known:         map[string]bool{},
+		extends:       map[string]string{},
+		critical:      map[string]bool{},
+		modules:       map[string]*moduleInfo{},
+		moduleScripts: map[string]bool{},
+		sectionRefs:   map[string]map[string]bool{},
+		styleMedia:    map[string]string{},
+		contentHash:   map[string][sha256.Size]byte{},
+		vendor:        map[string][]byte{},
+		rawSizes:      map[string]int{},
+		pageParts:     map[string]pageParts{},
+	}
+	b.fns = template.FuncMap{
+		instanceFunc: nextInstance,
+		setupFunc:    once,
+		propsFunc:    props,
+		slotFunc:     b.slot,
+		variantFunc:  variantOf,
+		includeFunc:  b.include,
+		"include":    b.include,
+		"jsonScript": jsonScript,
+		commentFunc:  comment,
+	}
+	for k, v := range opts.Funcs {
+		b.fns[k] = v
+	}
+	return b
+}
+
+// compile builds the final template from parsed components.
+func compile(comps []*component, opts Options) (*template.Template, *Meta, error) {
+	b := newBuilder(opts)
+	if err := b.addAll(comps); err != nil {
+		return nil, nil, err
+	}
+	if err := b.check(); err != nil {
+		return nil, nil, err
+	}
+	if opts.DefaultPage != "" {
+		if !isPage(opts.DefaultPage) || !b.known[opts.DefaultPage] {
+			return nil, nil, fmt.Errorf("default page %s doesn't exist",
+				opts.DefaultPage)
+		}
+		if err := b.addRawText(defaultPageName, opts.DefaultPage); err != nil {
+			return nil, nil, err
+		}
+	}
+	if opts.DevReload != "" {
+		if err := b.addText(reloadName, reloadScript(opts.DevReload)); err != nil {
+			return nil, nil, err
+		}
+	}
+	t, err := b.link()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, a := range b.assets {
+		b.meta.Assets = append(b.meta.Assets, a)
+	}
+	sort.Slice(b.meta.Assets, func(i, j int) bool {
+		return b.meta.Assets[i].Path < b.meta.Assets[j].Path
+	})
+	return t, b.meta, nil
+}
+
+// addAll adds each of the components compiled together.
+func (b *builder) addAll(comps []*component) error {
+	if err := checkTransforms(b.opts.Transforms); err != nil {
+		return err
+	}
+	for _, c := range comps {
+		b.known[c.name] = true
+	}
+	for _, c := range comps {
+		if err := b.add(c); err != nil {
 			return err
 		}
-		deps := map[string]bool{}
-		for section, data := range sectionData {
-			if len(data) == 0 {
-				continue
+	}
+	if len(b.vendor) > 0 {
+		return b.addVendorBundle()
+	}
+	return nil
+}
+
+// add transforms and parses the sections of a component.
+func (b *builder) add(c *component) error {
+	b.comps = append(b.comps, c)
+	for section, data := range c.sections {
+		b.rawSizes[c.name+"#"+section] = textSize(string(data))
+	}
+	if len(b.opts.Transforms) > 0 {
+		if err := b.transform(c); err != nil {
+			return err
+		}
+	}
+	if c.hasAttr("template", "pure") {
+		b.pure[c.name] = true
+	}
+	if c.hasAttr("script", "critical") {
+		b.critical[c.name] = true
+	}
+	if c.hasAttr("template", "cache") {
+		// record the TTL as a template for Cache to look up at render time
+		ttl, err := time.ParseDuration(c.attrs["template"]["cache"])
+		if err != nil || ttl <= 0 {
+			return fmt.Errorf("invalid cache directive in %s: %q",
+				c.name, c.attrs["template"]["cache"])
+		}
+		c.sections["cache"] = []byte(ttl.String())
+	}
+	if c.hasAttr("style", "after") {
+		for _, ref := range strings.Fields(c.attrs["style"]["after"]) {
+			if ref[0] != '.' && ref[0] != '/' {
+				return fmt.Errorf("invalid after directive in %s: %q isn't a path like ./base",
+					c.name, ref)
+			}
+			b.after[c.name] = append(b.after[c.name], resolveRef(path.Dir(c.name), ref))
+		}
+	}
+	if c.hasAttr("style", "media") && len(c.sections["style"]) > 0 {
+		media := strings.TrimSpace(c.attrs["style"]["media"])
+		if media == "" || strings.ContainsAny(media, "{};") || strings.Contains(media, "{{") {
+			return fmt.Errorf("invalid media directive in %s: %q", c.name,
+				c.attrs["style"]["media"])
+		}
+		b.styleMedia[c.name] = media
+	}
+	if c.attrs["script"]["type"] == "module" && len(c.sections["script"]) > 0 {
+		b.moduleScripts[c.name] = true
+	}
+	for _, bt := range builtinTransforms {
+		if bt.enabled != nil && !bt.enabled(b, c) {
+			continue
+		}
+		if err := bt.apply(b, c); err != nil {
+			return err
+		}
+	}
+	deps := map[string]bool{}
+	b.refs[c.name] = map[string]bool{}
+	dir := path.Dir(c.name)
+	sections := make([]string, 0, len(c.sections))
+	for section := range c.sections {
+		sections = append(sections, section)
+	}
+	// compile in a fixed order so events are logged consistently
+	sort.Strings(sections)
+	for _, section := range sections {
+		data := c.sections[section]
+		if len(data) == 0 {
+			continue
+		}
+		if b.opts.MaxSectionSize > 0 && len(data) > b.opts.MaxSectionSize {
+			b.meta.Warnings = append(b.meta.Warnings, Warning{
+				Component: c.name,
+				Kind:      WarnSectionSize,
+				Message: fmt.Sprintf("%s section is %d bytes, over the limit of %d",
+					section, len(data), b.opts.MaxSectionSize),
+			})
+		}
+		t, err := compileSection(c.name, section, string(data), deps, b.allNames,
+			b.sectionRefs, b.fns)
+		if err != nil {
+			return err
+		}
+		if section == "template" {
+			if fields := dataFields(t.Tree); len(fields) > 0 {
+				b.meta.DataFields[c.name] = fields
+			}
+		}
+		if b.opts.Optimize {
+			o := &optimizer{}
+			if section == "template" {
+				if o.text, err = htmlTextRanges(data); err != nil {
+					return errors.Wrapf(err, "optimize %s", c.name)
+				}
 			}
-			t := compileSection(name, section, string(data), rel, deps, allNames, scopedStyle, fns)
 			for _, tt := range t.Templates() {
-				all.AddParseTree(tt.Tree.Name, tt.Tree)
+				o.fold(tt.Tree.Root)
 			}
 		}
-		dependencies[name] = deps
-		f.Close()
-		return nil
-	})
+		if _, ok := b.opts.Funcs["include"]; !ok {
+			if err := b.resolveIncludes(c.name, section, t, deps); err != nil {
+				return err
+			}
+		}
+		if section == "template" && c.hasAttr("template", "progressive") {
+			if c.hasAttr("template", "setup") {
+				return fmt.Errorf("progressive %s can't have a setup directive",
+					c.name)
+			}
+			parts, err := splitProgressive(c.name, t.Tree)
+			if err != nil {
+				return err
+			}
+			for _, part := range parts {
+				b.trees = append(b.trees, part)
+				b.meta.Sources[part.Name] = SourceLocation{
+					File:       c.file,
+					LineOffset: c.offsets[section],
+				}
+			}
+			b.progressive[c.name] = len(parts)
+		}
+		if section == jsonLDSection && !rendersValue(t.Tree.Root) {
+			return fmt.Errorf("JSON-LD in %s may render nothing, which would leave "+
+				"the page's @graph invalid; add {{ else }}{} to its if, with, and range actions",
+				c.name)
+		}
+		if section == "template" && c.hasAttr("template", "extends") {
+			if err := checkExtends(c.name, t.Tree); err != nil {
+				return err
+			}
+		}
+		if vs := variants(c.name, t); section == "template" && len(vs) > 0 {
+			if c.hasAttr("template", "progressive") {
+				return fmt.Errorf("progressive %s can't have variants", c.name)
+			}
+			if err := wrapVariants(t.Tree, c.name, vs); err != nil {
+				return errors.Wrap(err, c.name)
+			}
+		}
+		if section == "template" && c.hasAttr("template", "setup") {
+			err := wrapSetup(t.Tree, c.attrs["template"]["setup"], b.fns)
+			if err != nil {
+				return errors.Wrapf(err, "setup %s", c.name)
+			}
+		}
+		log(b.opts.Logger, Event{
+			Kind:      EventSection,
+			Component: c.name,
+			Section:   section,
+			Path:      c.file,
+			Message:   fmt.Sprintf("compiled %d bytes", len(data)),
+		})
+		for _, tt := range Templates(t) {
+			b.trees = append(b.trees, tt.Tree)
+			b.defined[tt.Tree.Name] = true
+			b.meta.Sources[tt.Tree.Name] = SourceLocation{
+				File:       c.file,
+				LineOffset: c.offsets[section],
+			}
+			if section == "template" {
+				b.markup = append(b.markup, tt.Tree)
+			}
+			for _, ref := range getTemplateNodes(tt).template {
+				b.refs[c.name][ref] = true
+			}
+		}
+		isAsset := section == "style" || section == "script"
+		switch {
+		case !isAsset:
+		case b.opts.NoAssetBundling && !isStatic(t.Tree):
+			b.meta.Warnings = append(b.meta.Warnings, Warning{
+				Component: c.name,
+				Kind:      WarnDynamicAsset,
+				Message: fmt.Sprintf("%s section uses template actions, so it was discarded",
+					section),
+			})
+		case b.opts.ExternalAssets && isStatic(t.Tree) && section == "script" &&
+			c.hasAttr("script", "vendor") && !b.moduleScripts[c.name] && !b.opts.NoAssetBundling:
+			b.vendor[c.name] = data
+		case b.opts.ExternalAssets && isStatic(t.Tree) && !b.isModule(c.name),
+			b.opts.NoAssetBundling:
+			b.addAsset(c.name, section, data)
+		}
+		if isAsset && b.opts.DedupStrategy != DedupByComponent && isStatic(t.Tree) {
+			b.hashContent(c.name, section, data)
+		}
+	}
+	if c.hasAttr("template", "extends") {
+		ref := c.attrs["template"]["extends"]
+		if ref == "" || (ref[0] != '.' && ref[0] != '/') {
+			return fmt.Errorf("invalid extends directive in %s: %q isn't a path like ./base",
+				c.name, ref)
+		}
+		base := resolveRef(dir, ref)
+		b.extends[c.name] = base
+		// the base's markup and so its includes become the component's
+		deps[base] = true
+	}
+	if c.hasAttr("template", "requires") {
+		if err := b.addRequires(c); err != nil {
+			return err
+		}
+	}
+	if c.deps != nil {
+		deps = c.deps
+	}
+	b.dependencies[c.name] = deps
+	return nil
+}
+
+// check reports references to undefined templates as warnings and orders
+// each component's dependencies, failing on cycles.
+func (b *builder) check() error {
+	if len(b.extends) > 0 {
+		if err := b.resolveExtends(); err != nil {
+			return err
+		}
+	}
+	for _, c := range b.comps {
+		refs := make([]string, 0, len(b.sectionRefs[c.name]))
+		for ref := range b.sectionRefs[c.name] {
+			refs = append(refs, ref)
+		}
+		sort.Strings(refs)
+		for _, ref := range refs {
+			if b.defined[ref] {
+				continue
+			}
+			i := strings.IndexByte(ref, '#')
+			base, section := ref[:i], ref[i+1:]
+			if !b.known[base] {
+				return fmt.Errorf("%s includes %s, which doesn't exist", c.name, base)
+			}
+			return fmt.Errorf("%s includes the %s section of %s, which doesn't have one",
+				c.name, section, base)
+		}
+	}
+	for _, c := range b.comps {
+		for ref := range b.refs[c.name] {
+			if !b.defined[ref] {
+				b.meta.Warnings = append(b.meta.Warnings, Warning{
+					Component: c.name,
+					Kind:      WarnUndefinedTemplate,
+					Message:   fmt.Sprintf("references undefined %s", displayName(ref)),
+				})
+			}
+		}
+	}
+	if b.opts.WarnNoAssets {
+		b.warnNoAssets()
+	}
+	if len(b.opts.Themes) > 0 {
+		if err := b.addThemes(); err != nil {
+			return err
+		}
+	}
+	sortWarnings(b.meta.Warnings)
+	for _, page := range sortedKeys(b.opts.ExcludeAssets) {
+		if _, ok := b.dependencies[page]; !ok {
+			return fmt.Errorf("ExcludeAssets names %s, which isn't a component", page)
+		}
+	}
+	for _, name := range sortedKeys(b.after) {
+		for _, other := range b.after[name] {
+			if _, ok := b.dependencies[other]; !ok || other == name {
+				return fmt.Errorf("%s: after directive names %s, which isn't another component",
+					name, other)
+			}
+		}
+	}
+	for _, name := range b.componentNames() {
+		deps, err := sortedDeps(name, b.dependencies)
+		if err != nil {
+			log(b.opts.Logger, Event{
+				Kind:      EventCycle,
+				Component: name,
+				Message:   err.Error(),
+			})
+			return errors.Wrap(err, name)
+		}
+		if len(b.after) > 0 {
+			if deps, err = b.orderAfter(name, deps); err != nil {
+				return errors.Wrap(err, name)
+			}
+		}
+		b.sorted[name] = deps
+	}
+	if b.opts.MaxDepth > 0 {
+		return b.checkDepth()
+	}
+	return nil
+}
+
+// checkDepth fails if any chain of includes is longer than
+// Options.MaxDepth, naming the deepest chain.
+func (b *builder) checkDepth() error {
+	// chains memoizes the longest chain of includes starting at each
+	// component. Cycles were already ruled out by sorting.
+	chains := map[string][]string{}
+	var longest func(name string) []string
+	longest = func(name string) []string {
+		if chain, ok := chains[name]; ok {
+			return chain
+		}
+		var deepest []string
+		deps := make([]string, 0, len(b.dependencies[name]))
+		for dep := range b.dependencies[name] {
+			deps = append(deps, dep)
+		}
+		sort.Strings(deps)
+		for _, dep := range deps {
+			if chain := longest(dep); len(chain) > len(deepest) {
+				deepest = chain
+			}
+		}
+		chain := append([]string{name}, deepest...)
+		chains[name] = chain
+		return chain
+	}
+	var deepest []string
+	for _, name := range b.componentNames() {
+		if chain := longest(name); len(chain) > len(deepest) {
+			deepest = chain
+		}
+	}
+	if depth := len(deepest) - 1; depth > b.opts.MaxDepth {
+		return fmt.Errorf("includes nest %d deep, over the limit of %d: %s",
+			depth, b.opts.MaxDepth, strings.Join(deepest, " > "))
+	}
+	return nil
+}
+
+// componentNames returns the name of every component in order.
+func (b *builder) componentNames() []string {
+	names := make([]string, 0, len(b.dependencies))
+	for name := range b.dependencies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// orderAfter reorders a page's sorted dependencies so each component's
+// assets follow those of the components named by its after directive,
+// wherever both are on the page.
+func (b *builder) orderAfter(name string, deps []string) ([]string, error) {
+	onPage := make(map[string]bool, len(deps))
+	for _, dep := range deps {
+		onPage[dep] = true
+	}
+	graph := make(map[string]map[string]bool, len(deps))
+	ordered := false
+	for _, dep := range deps {
+		edges := map[string]bool{}
+		for d := range b.dependencies[dep] {
+			edges[d] = true
+		}
+		for _, other := range b.after[dep] {
+			if onPage[other] {
+				edges[other] = true
+				ordered = true
+			}
+		}
+		graph[dep] = edges
+	}
+	if !ordered {
+		return deps, nil
+	}
+	sorted, err := sortedDeps(name, graph)
 	if err != nil {
-		return nil, errors.Wrap(err, "walk directory")
+		return nil, errors.Wrap(err, "after directives conflict with includes")
+	}
+	return sorted, nil
+}
+
+// warnNoAssets reports components included by others which contribute no
+// styles or scripts to pages. See Options.WarnNoAssets.
+func (b *builder) warnNoAssets() {
+	includers := map[string][]string{}
+	for name, deps := range b.dependencies {
+		for dep := range deps {
+			includers[dep] = append(includers[dep], name)
+		}
+	}
+	for dep, names := range includers {
+		if !b.defined[dep+"#template"] {
+			// undefined components are reported separately
+			continue
+		}
+		if b.allNames[dep+"#style"] || b.allNames[dep+"#script"] ||
+			len(b.atRules[dep]) > 0 || len(b.media[dep]) > 0 {
+			continue
+		}
+		sort.Strings(names)
+		b.meta.Warnings = append(b.meta.Warnings, Warning{
+			Component: dep,
+			Kind:      WarnNoAssets,
+			Message: fmt.Sprintf("has no style or script, so including it from %s adds none",
+				strings.Join(names, ", ")),
+		})
+	}
+}
+
+// link assembles every parsed section into a single template and adds a
+// root template for each component.
+func (b *builder) link() (*template.Template, error) {
+	all := template.New("").Funcs(b.fns)
+	for _, tree := range b.trees {
+		if _, err := all.AddParseTree(tree.Name, tree); err != nil {
+			return nil, errors.Wrap(err, "add parse tree")
+		}
+	}
+	if b.opts.InlineStatic {
+		if err := inlineStatic(all, b.markup, b.pure); err != nil {
+			return nil, err
+		}
+	}
+	// register roots in order so the set, and any error, is the same
+	// every compile
+	for _, name := range sortedKeys(b.sorted) {
+		t, err := b.compileRoot(name, b.sorted[name])
+		if err != nil {
+			return nil, err
+		}
+		for _, tt := range Templates(t) {
+			if _, err := all.AddParseTree(tt.Tree.Name, tt.Tree); err != nil {
+				return nil, errors.Wrap(err, "add parse tree")
+			}
+		}
+		b.meta.PageSizes[name] = b.measurePage(all, name)
 	}
-	for name := range dependencies {
-		deps := sortedDeps(name, dependencies)
-		t := compileRoot(name, deps, allNames, fns)
-		for _, tt := range t.Templates() {
-			all.AddParseTree(tt.Tree.Name, tt.Tree)
+	if b.opts.FlattenIncludes {
+		if err := flattenIncludes(all); err != nil {
+			return nil, err
 		}
 	}
+	b.set = all
 	return all, nil
 }
 
 func compileSection(
-	name, section, data, dir string,
+	name, section, data string,
 	deps, all map[string]bool,
-	scopedStyle bool,
+	explicit map[string]map[string]bool,
 	fns template.FuncMap,
-) *template.Template {
+) (*template.Template, error) {
 	finalName := name + "#" + section
 	all[finalName] = true
-	t := template.Must(template.New(".<section>.").Funcs(fns).Parse(data))
-	tns := getTemplateNodes(t)
-	for templateNode, refName := range tns.template {
-		if refName[0] == '.' {
+	t, err := template.New(".<section>.").Funcs(fns).Parse(data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse %s", displayName(finalName))
+	}
+	refs := map[*parse.TemplateNode]string{}
+	for _, tt := range t.Templates() {
+		// includes within local templates need renaming too
+		for n, refName := range getTemplateNodes(tt).template {
+			refs[n] = refName
+		}
+	}
+	nodes := make([]*parse.TemplateNode, 0, len(refs))
+	for n := range refs {
+		nodes = append(nodes, n)
+	}
+	// resolve in source order so the first invalid reference is reported
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Pos < nodes[j].Pos })
+	for _, templateNode := range nodes {
+		ref := refs[templateNode]
+		refName, local := ResolveRef(name, ref)
+		if i := strings.IndexByte(refName, '#'); i >= 0 && !local {
+			// an explicit reference to a section, e.g. "./card#style",
+			// which doesn't make the component a dependency
+			if i == 0 || i == len(refName)-1 || strings.ContainsAny(refName[i+1:], "#~") {
+				return nil, fmt.Errorf("%s: invalid reference to a section %q",
+					displayName(finalName), ref)
+			}
+			if explicit[name] == nil {
+				explicit[name] = map[string]bool{}
+			}
+			explicit[name][refName] = true
+			all[refName] = true
+			templateNode.Name = refName
+			continue
+		}
+		if !local {
 			// external reference
-			// determine absolute "path"
-			refName = path.Clean(path.Join(dir, refName))
 			if section == "template" {
 				// if this reference is in the "template" section we'll need to
 				// include the references "style" and "script" sections as well
@@ -166,13 +1268,15 @@ func compileSection(
 			// templates were actually defined
 			all[refName] = true
 		} else {
-			// local reference
 			refName = name + "~" + refName
 		}
 		// rename the *parse.TemplateNode to point to the canonical name
 		templateNode.Name = refName
 	}
 	for _, tt := range t.Templates() {
+		// errors report locations relative to the parsed section, so name
+		// it rather than the placeholder
+		tt.Tree.ParseName = finalName
 		tmplName := tt.Name()
 		if tmplName == ".<section>." {
 			// we used '.<section>.' as the name when compiling so it wasn't
@@ -182,40 +1286,302 @@ func compileSection(
 			tt.Tree.Name = name + "~" + tmplName
 		}
 	}
-	return t
+	return t, nil
+}
+
+// ResolveRef resolves a reference to a template from within the named
+// component exactly as compiling does, for tools such as editor plugins and
+// link checkers. A path, e.g. "./button" from "forms/login", or
+// "/components/button" from anywhere, names another component, here
+// "forms/button" or "components/button", whether or not it exists. Any
+// other reference is to a template defined locally within the component,
+// in which case ref is returned as is and local is true.
+func ResolveRef(from, ref string) (name string, local bool) {
+	if ref == "" || (ref[0] != '.' && ref[0] != '/') {
+		return ref, true
+	}
+	return resolveRef(path.Dir(from), ref), false
 }
 
-func compileRoot(
+// resolveRef returns the name of the component a path refers to from a
+// component in dir, e.g. "./button" or "/components/button".
+func resolveRef(dir, ref string) string {
+	if ref[0] == '/' {
+		// relative to the template root
+		return strings.TrimPrefix(path.Clean(ref), "/")
+	}
+	return path.Clean(path.Join(dir, ref))
+}
+
+// Templates returns the templates associated with t sorted by name. Unlike
+// t.Templates(), whose order varies from call to call, the order is stable,
+// e.g. for golden tests serializing every template compiled.
+func Templates(t *template.Template) []*template.Template {
+	ts := t.Templates()
+	sort.Slice(ts, func(i, j int) bool {
+		return ts[i].Name() < ts[j].Name()
+	})
+	return ts
+}
+
+// sortedKeys returns the keys of m in order, for iterating over it
+// deterministically.
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// excludeDeps returns the dependencies of a page without those excluded by
+// Options.ExcludeAssets. The page itself is never excluded.
+func excludeDeps(page string, deps, excluded []string) []string {
+	kept := make([]string, 0, len(deps))
+	for _, dep := range deps {
+		drop := false
+		for _, prefix := range excluded {
+			prefix = strings.TrimSuffix(prefix, "/")
+			if dep == prefix || strings.HasPrefix(dep, prefix+"/") {
+				drop = true
+			}
+		}
+		if !drop || dep == page {
+			kept = append(kept, dep)
+		}
+	}
+	return kept
+}
+
+// compileRoot builds the root template for a component, which renders the
+// component as a full page along with the styles and scripts of everything
+// it depends on.
+func (b *builder) compileRoot(
 	name string,
 	deps []string,
-	all map[string]bool,
-	fns template.FuncMap,
-) *template.Template {
-	parts := map[string][]string{"style": nil, "script": nil, "template": nil}
+) (*template.Template, error) {
+	parts := map[string][]string{
+		"style":    nil,
+		"script":   nil,
+		"symbol":   nil,
+		"template": nil,
+	}
+	if excluded := b.opts.ExcludeAssets[name]; len(excluded) > 0 {
+		deps = excludeDeps(name, deps, excluded)
+	}
 	// check if a given template/section is available
 	chk := func(name, section string) {
-		if all[name+"#"+section] {
-			parts[section] = append(parts[section], `{{template "`+name+"#"+section+`" .}}`)
+		if b.allNames[name+"#"+section] {
+			parts[section] = append(parts[section], name+"#"+section)
+		}
+	}
+	hoisted := map[string]bool{}
+	for _, dep := range deps {
+		for _, at := range b.atRules[dep] {
+			if !hoisted[at] {
+				hoisted[at] = true
+				parts["style"] = append(parts["style"], at)
+			}
 		}
 	}
+	if b.defined[themesName] {
+		parts["style"] = append(parts["style"], themesName)
+	}
 	for _, dep := range deps {
 		chk(dep, "style")
 		chk(dep, "script")
+		chk(dep, "symbol")
 		if dep == name {
 			chk(name, "template")
 		}
 	}
-	html := "<!DOCTYPE html>\n" +
-		"<html>\n" +
-		"<style>\n" + strings.Join(parts["style"], "\n") + "\n</style>\n" +
-		"<script>\n" + strings.Join(parts["script"], "\n") + "\n</script>\n" +
-		strings.Join(parts["template"], "\n") + "\n" +
-		"</html>\n"
-	return template.Must(template.New(name).Funcs(fns).Parse(html))
+	if len(b.vendor) > 0 {
+		parts["script"] = b.vendorScripts(parts["script"])
+	}
+	if b.opts.DedupStrategy != DedupByComponent {
+		parts["style"] = b.dedupContent(parts["style"])
+		parts["script"] = b.dedupContent(parts["script"])
+	}
+	// group the rules for each media query in the order the queries first
+	// appear
+	var queries []string
+	grouped := map[string][]string{}
+	for _, dep := range deps {
+		for _, g := range b.media[dep] {
+			if _, ok := grouped[g.open]; !ok {
+				queries = append(queries, g.open)
+			}
+			grouped[g.open] = append(grouped[g.open], g.name)
+		}
+	}
+	for _, open := range queries {
+		parts["style"] = append(parts["style"], open)
+		parts["style"] = append(parts["style"], grouped[open]...)
+		parts["style"] = append(parts["style"], mediaClose)
+	}
+	// bundled module scripts are included in a <script type="module"> of
+	// their own, and other inlined module scripts in one each
+	var modules, inlineModules []string
+	scripts := parts["script"][:0]
+	for _, part := range parts["script"] {
+		comp := strings.TrimSuffix(part, "#script")
+		switch {
+		case b.isModule(comp):
+			modules = append(modules, part)
+		case b.moduleScripts[comp] && b.assets[part] == nil:
+			inlineModules = append(inlineModules, part)
+		default:
+			scripts = append(scripts, part)
+		}
+	}
+	parts["script"] = scripts
+	if b.opts.DevReload != "" {
+		parts["script"] = append(parts["script"], reloadName)
+	}
+	if !b.opts.NoAssetBundling {
+		for _, section := range []string{"style", "script"} {
+			for _, part := range parts[section] {
+				if a := b.assets[part]; a != nil {
+					b.meta.Pages[name] = append(b.meta.Pages[name], a)
+				}
+			}
+		}
+	}
+	var symbols string
+	// add custom sections like styles, in a fixed order
+	custom := make([]string, 0, len(b.opts.CustomSections))
+	for section := range b.opts.CustomSections {
+		custom = append(custom, section)
+	}
+	sort.Strings(custom)
+	var headCustom, endCustom []string
+	for _, section := range custom {
+		for _, dep := range deps {
+			if !b.allNames[dep+"#"+section] {
+				continue
+			}
+			if b.opts.CustomSections[section] == PlaceEnd {
+				endCustom = append(endCustom, dep+"#"+section)
+			} else {
+				headCustom = append(headCustom, dep+"#"+section)
+			}
+		}
+	}
+	var jsonLD []string
+	for _, dep := range deps {
+		if b.allNames[dep+"#"+jsonLDSection] {
+			jsonLD = append(jsonLD, dep+"#"+jsonLDSection)
+		}
+	}
+	if len(parts["symbol"]) > 0 {
+		symbols = `<svg xmlns="http://www.w3.org/2000/svg" style="display:none">` +
+			includes(parts["symbol"]) + "</svg>\n"
+	}
+	head, tail := symbols, ""
+	if !b.opts.NoAssetBundling {
+		scripts, deferred := parts["script"], []string(nil)
+		if b.opts.DeferNonCritical {
+			scripts = nil
+			for _, part := range parts["script"] {
+				if b.critical[strings.TrimSuffix(part, "#script")] {
+					scripts = append(scripts, part)
+				} else {
+					deferred = append(deferred, part)
+				}
+			}
+		}
+		head = "<!DOCTYPE html>\n" +
+			"<html>\n"
+		if b.opts.ModulePreload {
+			head += b.modulePreloads(parts["script"], modules)
+		}
+		head += b.assetTags("style", parts["style"], false) + "\n" +
+			b.assetTags("script", scripts, false) + "\n"
+		if len(modules) > 0 {
+			head += b.moduleTag(modules) + "\n"
+		}
+		for _, part := range inlineModules {
+			head += b.inlineModuleTag(part) + "\n"
+		}
+		if len(headCustom) > 0 {
+			head += includes(headCustom) + "\n"
+		}
+		if len(jsonLD) > 0 {
+			head += jsonLDTag(jsonLD) + "\n"
+		}
+		head += symbols
+		tail = "\n"
+		if len(deferred) > 0 {
+			// inline scripts run as soon as they're parsed, so mark
+			// external ones defer only if that keeps them in order
+			external := true
+			for _, part := range deferred {
+				external = external && b.assets[part] != nil
+			}
+			tail += b.assetTags("script", deferred, external) + "\n"
+		}
+		if len(endCustom) > 0 {
+			tail += includes(endCustom) + "\n"
+		}
+		tail += "</html>\n"
+	}
+	measured := pageParts{markup: parts["template"]}
+	if !b.opts.NoAssetBundling {
+		for _, part := range parts["style"] {
+			if b.assets[part] == nil {
+				measured.css = append(measured.css, part)
+			}
+		}
+		for _, part := range append(append(parts["script"], modules...), inlineModules...) {
+			if b.assets[part] == nil {
+				measured.js = append(measured.js, part)
+			}
+		}
+	}
+	b.pageParts[name] = measured
+	html := head + includes(parts["template"]) + tail
+	if n := b.progressive[name]; n > 0 {
+		// define the page around its markup on its own for
+		// ProgressiveRender, which executes the markup in parts
+		html += `{{define "` + name + `#progressive"}}` + strconv.Itoa(n) +
+			`{{end}}` +
+			`{{define "` + name + `#progressive-head"}}` + head + `{{end}}` +
+			`{{define "` + name + `#progressive-tail"}}` + tail + `{{end}}`
+	}
+	// define the page's styles and scripts on their own for PageAssets.
+	// They're wrapped in their tags so they're escaped in the right
+	// context. Module scripts compiled to files are left out like those
+	// inlined, since they can't run as classic scripts.
+	var classic []string
+	for _, part := range parts["script"] {
+		if !b.moduleScripts[strings.TrimSuffix(part, "#script")] {
+			classic = append(classic, part)
+		}
+	}
+	html += `{{define "` + name + `#css"}}<style>` + b.styleIncludes(parts["style"]) +
+		`</style>{{end}}` +
+		`{{define "` + name + `#js"}}<script>` + includes(classic) +
+		`</script>{{end}}`
+	t, err := template.New(name).Funcs(b.fns).Parse(html)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse root %s", name)
+	}
+	return t, nil
+}
+
+// includes returns actions including each of the named templates on its own
+// line.
+func includes(names []string) string {
+	actions := make([]string, 0, len(names))
+	for _, name := range names {
+		actions = append(actions, `{{template `+strconv.Quote(name)+` .}}`)
+	}
+	return strings.Join(actions, "\n")
 }
 
 // kahn algo
-func sortedDeps(name string, deps map[string]map[string]bool) []string {
+func sortedDeps(name string, deps map[string]map[string]bool) ([]string, error) {
 	reversed, leaves := reverseDeps(name, deps)
 	sorted := []string{}
 	for len(leaves) > 0 {
@@ -242,9 +1608,15 @@ func sortedDeps(name string, deps map[string]map[string]bool) []string {
 		}
 	}
 	if len(reversed) > 0 {
-		panic("cycles")
+		cycle := make([]string, 0, len(reversed))
+		for n := range reversed {
+			cycle = append(cycle, n)
+		}
+		sort.Strings(cycle)
+		return nil, fmt.Errorf("dependency cycle among %s",
+			strings.Join(cycle, ", "))
 	}
-	return sorted
+	return sorted, nil
 }
 
 func reverseDeps(
@@ -253,12 +1625,13 @@ func reverseDeps(
 ) (map[string]map[string]bool, []string) {
 	reversed := map[string]map[string]bool{}
 	parents := []string{name}
-	processed := map[string]bool{}
+	// queued holds every component added to parents, so components shared
+	// by several others are only processed once
+	queued := map[string]bool{name: true}
 	leaves := []string{}
 	var parent string
 	for len(parents) > 0 {
 		parent, parents = parents[0], parents[1:]
-		processed[parent] = true
 		if len(deps[parent]) == 0 {
 			leaves = append(leaves, parent)
 		}
@@ -267,7 +1640,8 @@ func reverseDeps(
 				reversed[dep] = map[string]bool{}
 			}
 			reversed[dep][parent] = true
-			if !processed[dep] {
+			if !queued[dep] {
+				queued[dep] = true
 				parents = append(parents, dep)
 			}
 		}
@@ -288,64 +1662,212 @@ func expandDependencies(
 	}
 }
 
-func splitTemplate(r io.Reader) (map[string][]byte, bool, error) {
+// splitTemplate splits a component into its sections. It also returns the
+// attributes of each section's tag, e.g. "scoped" in <style scoped>, the
+// line each section starts on, and the order the sections appear in.
+//
+// size is the length of the component's source if known, or else zero. It's
+// used to size each section's buffer once, so sections of large components
+// aren't copied repeatedly as they grow.
+func splitTemplate(
+	r io.Reader,
+	tags map[string]string,
+	size int,
+) (map[string][]byte, map[string]map[string]string, map[string]int, []string, error) {
 	z := html.NewTokenizer(r)
 	cur := ""
-	sections := map[string][]byte{"script": nil, "style": nil, "template": nil}
-	depth := 0
-	scopedStyle := false
+	bufs := map[string]*bytes.Buffer{}
+	attrs := map[string]map[string]string{}
+	offsets := map[string]int{}
+	var order []string
+	depth, line, read := 0, 0, 0
 	for t := z.Next(); t != html.ErrorToken; t = z.Next() {
+		// TagName lowercases the raw token in place, so add it to the
+		// current section first to keep the case of nested tags, e.g.
+		// <UserCard>. It's removed again if it ends the section.
+		raw := z.Raw()
+		read += len(raw)
+		line += bytes.Count(raw, []byte{'\n'})
+		mark := -1
+		if cur != "" {
+			mark = bufs[cur].Len()
+			bufs[cur].Write(raw)
+		}
 		tn, _ := z.TagName()
-		if _, ok := sections[string(tn)]; ok {
+		// Section tags may also appear within a section, e.g. a <template>
+		// element meant for the browser within the component's <template>.
+		// Track their depth so only the outermost tags delimit sections.
+		if section, ok := tags[string(tn)]; ok {
 			if t == html.StartTagToken {
-				if string(tn) == "style" {
-					k, _, a := z.TagAttr()
-					for {
-						if string(k) == "scoped" {
-							scopedStyle = true
-							break
-						}
-						if !a {
-							break
+				if depth == 0 {
+					if attrs[section] == nil {
+						attrs[section] = map[string]string{}
+					}
+					for more := true; more; {
+						var k, v []byte
+						k, v, more = z.TagAttr()
+						if len(k) > 0 {
+							attrs[section][string(k)] = string(v)
 						}
-						k, _, a = z.TagAttr()
 					}
 				}
-
 				depth++
 				if depth == 1 {
-					cur = string(tn)
+					cur = section
+					if _, ok := offsets[cur]; !ok {
+						offsets[cur] = line
+						order = append(order, cur)
+					}
+					if bufs[cur] == nil {
+						// the rest of the source bounds the section
+						bufs[cur] = &bytes.Buffer{}
+						if size > read {
+							bufs[cur].Grow(size - read)
+						}
+					}
 					continue
 				}
 			} else if t == html.EndTagToken {
 				depth--
 				if depth == 0 {
+					bufs[cur].Truncate(mark)
 					cur = ""
 					continue
 				}
 			}
 		}
-		if cur != "" {
-			sections[cur] = append(sections[cur], z.Raw()...)
-		}
 	}
 	if err := z.Err(); err != io.EOF {
-		return nil, false, err
+		return nil, nil, nil, nil, err
+	}
+	sections := map[string][]byte{"script": nil, "style": nil, "template": nil}
+	for s, buf := range bufs {
+		if buf.Len() > 0 {
+			sections[s] = buf.Bytes()
+		}
 	}
 	for s, d := range sections {
+		offsets[s] += len(d) - len(bytes.TrimLeft(d, "\n"))
 		d = bytes.Trim(d, "\n")
 		diff := len(d) - len(bytes.TrimLeft(d, " \t"))
 		if diff > 0 {
-			pfx := d[:diff]
-			lines := bytes.Split(d, []byte{'\n'})
-			for i, line := range lines {
-				lines[i] = bytes.TrimPrefix(line, pfx)
-			}
-			d = bytes.Join(lines, []byte{'\n'})
+			d = dedent(d, d[:diff])
 		}
 		sections[s] = d
 	}
-	return sections, scopedStyle, nil
+	return sections, attrs, offsets, order, nil
+}
+
+// dedent removes prefix from the start of each line of d, reusing d's
+// memory.
+func dedent(d, prefix []byte) []byte {
+	// prefix may alias d, which is overwritten
+	prefix = append([]byte(nil), prefix...)
+	out := d[:0]
+	for start := 0; start <= len(d); {
+		end := bytes.IndexByte(d[start:], '\n')
+		if end < 0 {
+			end = len(d)
+		} else {
+			end += start
+		}
+		out = append(out, bytes.TrimPrefix(d[start:end], prefix)...)
+		if end < len(d) {
+			out = append(out, '\n')
+		}
+		start = end + 1
+	}
+	return out
+}
+
+// sourceSize returns the length of a component's source read from r, or zero
+// if it's unknown.
+func sourceSize(r io.Reader) int {
+	switch r := r.(type) {
+	case interface{ Len() int }:
+		return r.Len()
+	case fs.File:
+		if fi, err := r.Stat(); err == nil {
+			return int(fi.Size())
+		}
+	}
+	return 0
+}
+
+// checkSectionOrder fails if sections appear in an order other than want,
+// ignoring sections not listed in it. See Options.EnforceSectionOrder.
+func checkSectionOrder(order, want []string) error {
+	rank := make(map[string]int, len(want))
+	for i, section := range want {
+		rank[section] = i
+	}
+	prev := ""
+	for _, section := range order {
+		r, ok := rank[section]
+		if !ok {
+			continue
+		}
+		if prev != "" && r < rank[prev] {
+			return fmt.Errorf("%s section comes after %s section, but the order is %s",
+				section, prev, strings.Join(want, ", "))
+		}
+		prev = section
+	}
+	return nil
+}
+
+// checkSections fails if a component has anything at the top level besides
+// its sections, each appearing once, and comments. See
+// Options.StrictSections.
+func checkSections(src []byte, tags map[string]string) error {
+	z := html.NewTokenizer(bytes.NewReader(src))
+	seen := map[string]bool{}
+	depth, line := 0, 1
+	for t := z.Next(); t != html.ErrorToken; t = z.Next() {
+		raw := string(z.Raw())
+		start := line
+		line += strings.Count(raw, "\n")
+		tn, _ := z.TagName()
+		section, isSection := tags[string(tn)]
+		switch {
+		case isSection && t == html.StartTagToken:
+			if depth == 0 && seen[section] {
+				return fmt.Errorf("line %d: second %s section %q", start, section,
+					truncate(raw))
+			}
+			seen[section] = true
+			depth++
+			continue
+		case isSection && t == html.EndTagToken && depth > 0:
+			depth--
+			continue
+		}
+		if depth > 0 || t == html.CommentToken ||
+			(t == html.TextToken && strings.TrimSpace(raw) == "") {
+			continue
+		}
+		if t == html.TextToken {
+			// report the line of the content itself
+			start += strings.Count(raw[:len(raw)-len(strings.TrimLeft(raw, spaceChars))], "\n")
+		}
+		return fmt.Errorf("line %d: stray content outside sections %q", start,
+			truncate(strings.TrimSpace(raw)))
+	}
+	if err := z.Err(); err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+// truncate shortens s for quoting in an error.
+func truncate(s string) string {
+	const max = 40
+	for i := range s {
+		if i >= max {
+			return s[:i] + "..."
+		}
+	}
+	return s
 }
 
 func getTemplateNodes(t *template.Template) *tnodes {
@@ -354,9 +1876,40 @@ func getTemplateNodes(t *template.Template) *tnodes {
 	return tns
 }
 
+// templateRefs returns the names of the templates t renders, whether
+// included with {{ template }} or by name through the include and slot
+// functions, sorted and each once.
+func templateRefs(t *template.Template) []string {
+	tns := getTemplateNodes(t)
+	seen := make(map[string]bool, len(tns.template)+len(tns.named))
+	refs := make([]string, 0, len(seen))
+	add := func(ref string) {
+		if !seen[ref] {
+			seen[ref] = true
+			refs = append(refs, ref)
+		}
+	}
+	for _, ref := range tns.template {
+		add(ref)
+	}
+	for _, ref := range tns.named {
+		add(ref)
+	}
+	sort.Strings(refs)
+	return refs
+}
+
 type tnodes struct {
 	template map[*parse.TemplateNode]string
 	text     []*parse.TextNode
+
+	// include holds calls to the include function. See
+	// builder.resolveIncludes.
+	include []*parse.CommandNode
+
+	// named holds the templates rendered by name through the include and
+	// slot functions once includes are resolved, e.g. "card#template".
+	named []string
 }
 
 func (tns *tnodes) checkListNode(ln *parse.ListNode) {
@@ -379,6 +1932,18 @@ func (tns *tnodes) checkCommandNode(cn *parse.CommandNode) {
 	if cn == nil || len(cn.Args) == 0 {
 		return
 	}
+	if id, ok := cn.Args[0].(*parse.IdentifierNode); ok {
+		switch id.Ident {
+		case "include":
+			tns.include = append(tns.include, cn)
+		case includeFunc, slotFunc:
+			if len(cn.Args) > 1 {
+				if sn, ok := cn.Args[1].(*parse.StringNode); ok {
+					tns.named = append(tns.named, sn.Text)
+				}
+			}
+		}
+	}
 	for _, n := range cn.Args {
 		tns.checkNode(n)
 	}
@@ -423,6 +1988,7 @@ func (tns *tnodes) checkNode(n parse.Node) {
 		tns.checkPipeNode(t)
 	case *parse.TemplateNode:
 		tns.template[t] = t.Name
+		tns.checkPipeNode(t.Pipe)
 	case *parse.TextNode:
 		tns.text = append(tns.text, t)
 	}
@@ -0,0 +1,869 @@
+package component
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// compileMap compiles components from memory, failing the test on error.
+func compileMap(
+	t *testing.T,
+	opts Options,
+	sources map[string]string,
+) (*template.Template, *Meta) {
+	t.Helper()
+	srcs := make(map[string][]byte, len(sources))
+	for name, src := range sources {
+		srcs[name] = []byte(src)
+	}
+	tmpl, meta, err := NewCompiler(opts).Map(srcs)
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	return tmpl, meta
+}
+
+// render executes the named template, failing the test on error.
+func render(t *testing.T, tmpl *template.Template, name string, data interface{}) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, name, data); err != nil {
+		t.Fatalf("render %s: %v", name, err)
+	}
+	return buf.String()
+}
+
+// split splits a component's source into its sections, failing the test on
+// error.
+func split(t *testing.T, src string) map[string][]byte {
+	t.Helper()
+	tags, err := Options{}.sectionTags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sections, _, _, _, err := splitTemplate(strings.NewReader(src), tags, len(src))
+	if err != nil {
+		t.Fatalf("split: %v", err)
+	}
+	return sections
+}
+
+func TestNestedTemplateElement(t *testing.T) {
+	const src = `<script>
+	function addRow() {
+		document.getElementById("row").content.cloneNode(true);
+	}
+</script>
+<template>
+	<table><tbody></tbody></table>
+	<template id="row">
+		<tr><td>{{ .Name }}</td></tr>
+	</template>
+	<p>after</p>
+</template>
+`
+	sections := split(t, src)
+	want := `<table><tbody></tbody></table>
+<template id="row">
+	<tr><td>{{ .Name }}</td></tr>
+</template>
+<p>after</p>`
+	if got := string(sections["template"]); got != want {
+		t.Errorf("template section:\n%s\nwant:\n%s", got, want)
+	}
+	if !strings.Contains(string(sections["script"]), "cloneNode") {
+		t.Errorf("script section lost: %q", sections["script"])
+	}
+
+	tmpl, _ := compileMap(t, Options{}, map[string]string{"table": src})
+	got := render(t, tmpl, "table", map[string]string{"Name": "Ada"})
+	for _, want := range []string{
+		`<template id="row">`,
+		`<tr><td>Ada</td></tr>`,
+		`</template>`,
+		`<p>after</p>`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("page missing %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestNestedTemplateElementDepth(t *testing.T) {
+	// nested elements close in order, so the component's template only
+	// ends at the outermost end tag
+	const src = `<template>
+	<template id="outer"><template id="inner">x</template></template>
+	<p>still markup</p>
+</template>
+<style>p { color: red; }</style>
+`
+	sections := split(t, src)
+	want := `<template id="outer"><template id="inner">x</template></template>
+<p>still markup</p>`
+	if got := string(sections["template"]); got != want {
+		t.Errorf("template section:\n%s\nwant:\n%s", got, want)
+	}
+	if got := string(sections["style"]); got != "p { color: red; }" {
+		t.Errorf("style section = %q", got)
+	}
+}
+
+func TestTooManyOptions(t *testing.T) {
+	srcs := []Source{{Name: "page", Content: []byte("<template>x</template>")}}
+	_, err := CompileSources(srcs, nil, Options{}, Options{Optimize: true})
+	if err == nil || !strings.Contains(err.Error(), "at most one") {
+		t.Errorf("err = %v, want an error for the extra Options", err)
+	}
+}
+
+func TestLocalTemplateOrder(t *testing.T) {
+	const src = `<template>
+	{{ define "d" }}d{{ end }}
+	{{ define "b" }}b{{ end }}
+	{{ define "e" }}e{{ end }}
+	{{ define "a" }}a{{ end }}
+	{{ define "c" }}c{{ end }}
+	{{ template "a" }}{{ template "b" }}{{ template "c" }}{{ template "d" }}{{ template "e" }}
+</template>`
+	want := []string{"page#template", "page~a", "page~b", "page~c", "page~d", "page~e"}
+	// map iteration order varies, so compile repeatedly to catch it
+	for i := 0; i < 20; i++ {
+		comps, err := readSources([]Source{{Name: "page", Content: []byte(src)}}, Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		b := newBuilder(Options{})
+		if err := b.addAll(comps); err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, tree := range b.trees {
+			got = append(got, tree.Name)
+		}
+		if strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Fatalf("registered %v, want %v", got, want)
+		}
+	}
+}
+
+// writeDir writes files to a new temporary directory, returning its path.
+func writeDir(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		fpath := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fpath), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fpath, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestSpacedAndUnicodePaths(t *testing.T) {
+	dir := writeDir(t, map[string]string{
+		"my dir/café.tmpl": `<style>.cafe { color: brown; }</style>
+<template><p class="cafe">{{ . }}</p></template>`,
+		"my dir/menu.tmpl": `<template>{{ template "./café" "latte" }}</template>`,
+		"page.tmpl":        `<template>{{ template "./my dir/menu" . }}{{ template "/my dir/café" "mocha" }}</template>`,
+	})
+	tmpl, err := CompileDir(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := render(t, tmpl, "page", nil)
+	for _, want := range []string{
+		`<p class="cafe">latte</p>`,
+		`<p class="cafe">mocha</p>`,
+		`.cafe { color: brown; }`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("page missing %q:\n%s", want, page)
+		}
+	}
+	if n := strings.Count(page, ".cafe {"); n != 1 {
+		t.Errorf("style included %d times, want once", n)
+	}
+	render(t, tmpl, "my dir/café", "espresso")
+}
+
+func TestReservedNameCharacters(t *testing.T) {
+	for _, name := range []string{"a#b", "a~b", "bad\tname"} {
+		dir := writeDir(t, map[string]string{name + ".tmpl": "<template>x</template>"})
+		_, err := CompileDir(dir, nil)
+		if err == nil || !strings.Contains(err.Error(), "may not contain") {
+			t.Errorf("%q: err = %v, want a reserved character error", name, err)
+		}
+	}
+}
+
+func TestAtInNames(t *testing.T) {
+	// generated templates begin with "#", leaving "@" free for names,
+	// even one matching a generated template's
+	opts := Options{Themes: []Theme{{Tokens: map[string]string{"fg": "#222"}}}}
+	tmpl, _ := compileMap(t, opts, map[string]string{
+		"icons/star@2x": `<template><img src="star@2x.png"></template>`,
+		"@themes":       `<template>not the themes</template>`,
+		"page":          `<template>{{ template "./icons/star@2x" }}|{{ template "./@themes" }}</template>`,
+	})
+	page := render(t, tmpl, "page", nil)
+	for _, want := range []string{`<img src="star@2x.png">|not the themes`, "--fg: #222"} {
+		if !strings.Contains(page, want) {
+			t.Errorf("page missing %s:\n%s", want, page)
+		}
+	}
+	if !isPage("icons/star@2x") || isPage(themesName) {
+		t.Error("isPage confuses a component with a generated template")
+	}
+
+	// the same goes for the templates grouping @media rules
+	opts = Options{GroupMedia: true}
+	tmpl, _ = compileMap(t, opts, map[string]string{
+		"@media-end": `<template>not the media end</template>`,
+		"card": `<style>@media (max-width: 600px) { .card { color: red; } }</style>
+<template><div class="card">{{ template "./@media-end" }}</div></template>`,
+	})
+	page = render(t, tmpl, "card", nil)
+	for _, want := range []string{"@media (max-width: 600px) {", "not the media end"} {
+		if !strings.Contains(page, want) {
+			t.Errorf("page missing %s:\n%s", want, page)
+		}
+	}
+	for _, tt := range tmpl.Templates() {
+		if name := tt.Name(); name != "@media-end" && strings.Contains(name, "media-") && isPage(name) {
+			t.Errorf("media group %q is a page", name)
+		}
+	}
+}
+
+func TestDirErrors(t *testing.T) {
+	dir := writeDir(t, map[string]string{
+		"file.tmpl":         "<template>x</template>",
+		"private/page.tmpl": "<template>x</template>",
+	})
+	check := func(dirname string, target error) {
+		t.Helper()
+		_, err := CompileDir(dirname, nil)
+		var dirErr *DirError
+		if !errors.As(err, &dirErr) || dirErr.Dir != dirname {
+			t.Fatalf("err = %v, want a *DirError for %s", err, dirname)
+		}
+		if !errors.Is(err, target) {
+			t.Errorf("err = %v, want %v", err, target)
+		}
+	}
+	check(filepath.Join(dir, "missing"), fs.ErrNotExist)
+	check(filepath.Join(dir, "file.tmpl"), ErrNotDir)
+
+	if os.Geteuid() == 0 {
+		t.Skip("root can read any directory")
+	}
+	private := filepath.Join(dir, "private")
+	if err := os.Chmod(private, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(private, 0o755)
+	check(private, fs.ErrPermission)
+}
+
+func TestNoComponents(t *testing.T) {
+	dir := writeDir(t, map[string]string{"notes.txt": "not a component"})
+	entries := map[string]func() error{
+		"CompileDir": func() error {
+			_, err := CompileDir(dir, nil)
+			return err
+		},
+		"Validate": func() error { return Validate(dir, nil) },
+		"Collection.AddDir": func() error {
+			_, _, err := NewCollection(nil).AddDir(dir)
+			return err
+		},
+		"SelectorReport": func() error {
+			_, err := SelectorReport(dir)
+			return err
+		},
+		"CompileExperiments": func() error {
+			_, err := CompileExperiments(dir, nil)
+			return err
+		},
+		"CompileFS": func() error {
+			_, err := CompileFS(os.DirFS(dir), nil)
+			return err
+		},
+	}
+	for name, fn := range entries {
+		if err := fn(); !errors.Is(err, ErrNoComponents) {
+			t.Errorf("%s: err = %v, want ErrNoComponents", name, err)
+		}
+	}
+
+	// components added to a Compiler make up for an empty directory
+	c := NewCompiler(Options{})
+	if err := c.AddComponent("page", map[string]string{"template": "x"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := c.Dir(dir); err != nil {
+		t.Errorf("Dir with added components: %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := map[string]string{
+		"page.tmpl":       `<template>{{ template "./parts/nav" . }}</template>`,
+		"parts/nav.tmpl":  `<style>nav { color: red; }</style><template><nav>{{ template "./link" }}</nav></template>`,
+		"parts/link.tmpl": `<template><a href="/">home</a></template>`,
+	}
+	if err := Validate(writeDir(t, valid), nil); err != nil {
+		t.Errorf("valid components: %v", err)
+	}
+
+	for _, tc := range []struct {
+		files map[string]string
+		want  string
+	}{{
+		files: map[string]string{
+			"page.tmpl": `<template>{{ template "./missing" . }}</template>`,
+		},
+		want: "undefined template section of missing",
+	}, {
+		files: map[string]string{
+			"a.tmpl": `<template>{{ template "./b" }}</template>`,
+			"b.tmpl": `<template>{{ template "./a" }}</template>`,
+		},
+		want: "cycle",
+	}} {
+		err := Validate(writeDir(t, tc.files), nil)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("err = %v, want it to mention %s", err, tc.want)
+		}
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	src := map[string][]byte{
+		"page": []byte(`<template>{{ template "./a" }}{{ template "./c" }}</template>`),
+		"a":    []byte(`<template>{{ template "./b" }}</template>`),
+		"b":    []byte(`<template>{{ template "./c" }}</template>`),
+		"c":    []byte(`<template>c</template>`),
+	}
+	for _, depth := range []int{0, 3, 4} {
+		if _, _, err := NewCompiler(Options{MaxDepth: depth}).Map(src); err != nil {
+			t.Errorf("MaxDepth %d: %v", depth, err)
+		}
+	}
+	_, _, err := NewCompiler(Options{MaxDepth: 2}).Map(src)
+	want := "includes nest 3 deep, over the limit of 2: page > a > b > c"
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("err = %v, want %q", err, want)
+	}
+}
+
+func TestFollowSymlinks(t *testing.T) {
+	shared := writeDir(t, map[string]string{
+		"button.tmpl": `<template><button>ok</button></template>`,
+	})
+	dir := writeDir(t, map[string]string{
+		"page.tmpl": `<template>{{ template "./lib/button" }}</template>`,
+	})
+	if err := os.Symlink(shared, filepath.Join(dir, "lib")); err != nil {
+		t.Skipf("symlinks unsupported: %v", err)
+	}
+
+	tmpl, err := CompileDir(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tmpl.Lookup("lib/button") != nil {
+		t.Error("symlinked directory walked without FollowSymlinks")
+	}
+	tmpl, err = CompileDir(dir, nil, Options{FollowSymlinks: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page := render(t, tmpl, "page", nil); !strings.Contains(page, "<button>ok</button>") {
+		t.Errorf("page missing the linked component:\n%s", page)
+	}
+
+	// a link back up the tree fails rather than walking forever
+	if err := os.Symlink(dir, filepath.Join(shared, "loop")); err != nil {
+		t.Fatal(err)
+	}
+	_, err = CompileDir(dir, nil, Options{FollowSymlinks: true})
+	if err == nil || !strings.Contains(err.Error(), "symlink cycle") {
+		t.Errorf("err = %v, want a symlink cycle", err)
+	}
+}
+
+// blockingFS is a filesystem whose file named block doesn't finish opening
+// until release is closed.
+type blockingFS struct {
+	files   fstest.MapFS
+	block   string
+	release chan struct{}
+}
+
+func (f *blockingFS) Open(name string) (fs.File, error) {
+	if name == f.block {
+		<-f.release
+	}
+	return f.files.Open(name)
+}
+
+func TestReadTimeout(t *testing.T) {
+	fsys := &blockingFS{
+		files: fstest.MapFS{
+			"page.tmpl": {Data: []byte(`<template>{{ template "./slow" }}</template>`)},
+			"slow.tmpl": {Data: []byte(`<template>slow</template>`)},
+		},
+		block:   "slow.tmpl",
+		release: make(chan struct{}),
+	}
+	defer close(fsys.release)
+
+	start := time.Now()
+	_, err := CompileFS(fsys, nil, Options{ReadTimeout: 20 * time.Millisecond})
+	if err == nil || !strings.Contains(err.Error(), "slow.tmpl: read timed out after 20ms") {
+		t.Errorf("err = %v, want slow.tmpl to time out", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("compile took %s despite the timeout", elapsed)
+	}
+
+	if _, err := CompileFS(fsys.files, nil, Options{ReadTimeout: time.Second}); err != nil {
+		t.Errorf("files read in time: %v", err)
+	}
+}
+
+func TestStrictSections(t *testing.T) {
+	opts := Options{StrictSections: true}
+	tmpl, _ := compileMap(t, opts, map[string]string{
+		"page": `<!-- the page -->
+<style>p { color: red; }</style>
+<template><p>hi</p></template>
+`,
+	})
+	if page := render(t, tmpl, "page", nil); !strings.Contains(page, "<p>hi</p>") {
+		t.Errorf("page:\n%s", page)
+	}
+
+	_, _, err := NewCompiler(opts).Map(map[string][]byte{
+		"page": []byte("<template><p>hi</p></template>\nstray text\n"),
+	})
+	if err == nil || !strings.Contains(err.Error(), `line 2`) ||
+		!strings.Contains(err.Error(), "stray text") {
+		t.Errorf("err = %v, want the stray text quoted with its line", err)
+	}
+}
+
+func TestCustomSections(t *testing.T) {
+	opts := Options{CustomSections: map[string]Placement{
+		"head-meta": PlaceHead,
+		"modals":    PlaceEnd,
+	}}
+	tmpl, _ := compileMap(t, opts, map[string]string{
+		"card": `<head-meta><meta name="card" content="{{ .Title }}"></head-meta>
+<modals><dialog id="card-modal"></dialog></modals>
+<template><div class="card"></div></template>`,
+		"page": `<template><main>{{ template "./card" . }}{{ template "./card" . }}</main></template>`,
+	})
+	page := render(t, tmpl, "page", map[string]string{"Title": "Hi"})
+	meta := strings.Index(page, `<meta name="card" content="Hi">`)
+	main := strings.Index(page, "<main>")
+	modal := strings.Index(page, `<dialog id="card-modal"></dialog>`)
+	if meta < 0 || main < 0 || modal < 0 || !(meta < main && main < modal) {
+		t.Errorf("want the meta in the head and the modal after the markup:\n%s", page)
+	}
+	if strings.Count(page, "<dialog") != 1 || strings.Count(page, "<meta") != 1 {
+		t.Errorf("custom sections repeated for a repeated component:\n%s", page)
+	}
+
+	_, _, err := NewCompiler(Options{CustomSections: map[string]Placement{
+		"style": PlaceHead,
+	}}).Map(map[string][]byte{"page": []byte("<template>x</template>")})
+	if err == nil || !strings.Contains(err.Error(), `invalid custom section "style"`) {
+		t.Errorf("err = %v, want a reserved section rejected", err)
+	}
+}
+
+func TestEnforceSectionOrder(t *testing.T) {
+	opts := Options{EnforceSectionOrder: []string{"template", "style", "script"}}
+	tmpl, _ := compileMap(t, opts, map[string]string{
+		// unlisted sections may go anywhere, and missing ones are fine
+		"page": `<jsonld>{"@type": "WebPage"}</jsonld>
+<template><p>hi</p></template>
+<script>init();</script>`,
+	})
+	if page := render(t, tmpl, "page", nil); !strings.Contains(page, "<p>hi</p>") {
+		t.Errorf("page:\n%s", page)
+	}
+
+	_, _, err := NewCompiler(opts).Map(map[string][]byte{
+		"page": []byte("<style>p { color: red; }</style><template><p>hi</p></template>"),
+	})
+	want := "template section comes after style section, but the order is template, style, script"
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("err = %v, want %q", err, want)
+	}
+}
+
+func TestRootRelativeReferences(t *testing.T) {
+	src := map[string]string{
+		"components/button": `<style>.button { color: red; }</style>
+<template><button class="button">{{ . }}</button></template>`,
+		"pages/account/settings/profile": `<template>
+	{{ template "/components/button" "Save" }}
+	{{ template "../../../components/button" "Cancel" }}
+</template>`,
+	}
+	tmpl, _ := compileMap(t, Options{}, src)
+	page := render(t, tmpl, "pages/account/settings/profile", nil)
+	for _, want := range []string{
+		`<button class="button">Save</button>`,
+		`<button class="button">Cancel</button>`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("page missing %q:\n%s", want, page)
+		}
+	}
+	if n := strings.Count(page, ".button {"); n != 1 {
+		t.Errorf("button style included %d times, want once:\n%s", n, page)
+	}
+}
+
+func TestResolveRef(t *testing.T) {
+	tests := []struct {
+		from, ref, want string
+		local           bool
+	}{
+		{"forms/login", "./button", "forms/button", false},
+		{"forms/login", "../button", "button", false},
+		{"a/b/c/d", "/components/button", "components/button", false},
+		{"login", "/components/../button", "button", false},
+		{"forms/login", "row", "row", true},
+	}
+	for _, tt := range tests {
+		got, local := ResolveRef(tt.from, tt.ref)
+		if got != tt.want || local != tt.local {
+			t.Errorf("ResolveRef(%q, %q) = %q, %t; want %q, %t",
+				tt.from, tt.ref, got, local, tt.want, tt.local)
+		}
+	}
+}
+
+func TestComponentNamedLikeDirectory(t *testing.T) {
+	dir := writeDir(t, map[string]string{
+		"widgets.tmpl": `<style>.widgets { margin: 0; }</style>
+<template><div class="widgets">{{ template "./widgets/foo" . }}</div></template>`,
+		"widgets/foo.tmpl": `<style>.foo { margin: 0; }</style>
+<template><span class="foo">{{ template "./bar" . }}</span></template>`,
+		"widgets/bar.tmpl": `<style>.bar { margin: 0; }</style>
+<template><b class="bar">{{ . }}</b></template>`,
+		"page.tmpl": `<template>{{ template "./widgets" . }}{{ template "./widgets/bar" . }}</template>`,
+	})
+	tmpl, err := CompileDir(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := render(t, tmpl, "page", "x")
+	want := `<div class="widgets"><span class="foo"><b class="bar">x</b></span></div><b class="bar">x</b>`
+	if !strings.Contains(page, want) {
+		t.Errorf("page markup:\n%s\nwant:\n%s", page, want)
+	}
+	// each style once, after the styles of what it includes
+	bar, foo, widgets := strings.Index(page, ".bar {"), strings.Index(page, ".foo {"),
+		strings.Index(page, ".widgets {")
+	if bar < 0 || !(bar < foo && foo < widgets) {
+		t.Errorf("styles out of order:\n%s", page)
+	}
+	for _, style := range []string{".bar {", ".foo {", ".widgets {"} {
+		if n := strings.Count(page, style); n != 1 {
+			t.Errorf("%s appears %d times, want once", style, n)
+		}
+	}
+	if got := render(t, tmpl, "widgets/foo#template", "y"); got != `<span class="foo"><b class="bar">y</b></span>` {
+		t.Errorf("widgets/foo = %q", got)
+	}
+}
+
+func TestElementNameCollision(t *testing.T) {
+	src := map[string]string{
+		"widgets/foo": `<style scoped>p { margin: 0; }</style><template><p>a</p></template>`,
+		"widgets-foo": `<style scoped>p { margin: 0; }</style><template><p>b</p></template>`,
+	}
+	_, _, err := NewCompiler(Options{Mode: ModeWebComponents}).Map(map[string][]byte{
+		"widgets/foo": []byte(src["widgets/foo"]),
+		"widgets-foo": []byte(src["widgets-foo"]),
+	})
+	if err == nil || !strings.Contains(err.Error(), "are both named c-widgets-foo") {
+		t.Errorf("err = %v, want an element name collision", err)
+	}
+	// without custom elements, the names don't matter
+	compileMap(t, Options{}, src)
+}
+
+func TestSharedDependencyAssetsOnce(t *testing.T) {
+	// a and b both include shared, which was queued, and so included,
+	// once for each
+	src := map[string]string{
+		"shared": `<style>.shared { margin: 0; }</style><script>var shared = 1;</script>
+<template>s</template>`,
+		"a":    `<style>.a { margin: 0; }</style><template>{{ template "./shared" }}</template>`,
+		"b":    `<style>.b { margin: 0; }</style><template>{{ template "./shared" }}</template>`,
+		"page": `<template>{{ template "./a" }}{{ template "./b" }}</template>`,
+	}
+	tmpl, _ := compileMap(t, Options{}, src)
+	page := render(t, tmpl, "page", nil)
+	for _, asset := range []string{".shared {", "var shared"} {
+		if n := strings.Count(page, asset); n != 1 {
+			t.Errorf("%q appears %d times, want once:\n%s", asset, n, page)
+		}
+	}
+
+	deps := map[string]map[string]bool{
+		"page":   {"a": true, "b": true},
+		"a":      {"shared": true},
+		"b":      {"shared": true},
+		"shared": {},
+	}
+	sorted, err := sortedDeps("page", deps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(sorted, " "); got != "shared a b page" {
+		t.Errorf("sorted %q, want %q", got, "shared a b page")
+	}
+}
+
+func TestSplitKeepsTagCase(t *testing.T) {
+	const src = `<TEMPLATE>
+	<svg viewBox="0 0 8 8"><linearGradient id="g"></linearGradient></svg>
+	<My-Element></My-Element>
+</TEMPLATE>`
+	sections := split(t, src)
+	want := `<svg viewBox="0 0 8 8"><linearGradient id="g"></linearGradient></svg>
+<My-Element></My-Element>`
+	if got := string(sections["template"]); got != want {
+		t.Errorf("template section:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestIncludeWithinLocalTemplate(t *testing.T) {
+	src := map[string]string{
+		"icon": `<style>.icon { margin: 0; }</style><template><i class="icon">{{ . }}</i></template>`,
+		"list": `<template>
+	{{ define "row" }}<li>{{ template "./icon" . }}</li>{{ end }}
+	<ul>{{ range . }}{{ template "row" . }}{{ end }}</ul>
+</template>`,
+	}
+	tmpl, _ := compileMap(t, Options{}, src)
+	page := render(t, tmpl, "list", []string{"a", "b"})
+	if !strings.Contains(page, `<ul><li><i class="icon">a</i></li><li><i class="icon">b</i></li></ul>`) {
+		t.Errorf("page doesn't render the include within row:\n%s", page)
+	}
+	if !strings.Contains(page, ".icon { margin: 0; }") {
+		t.Errorf("page missing the style of the component row includes:\n%s", page)
+	}
+}
+
+func TestDeferNonCritical(t *testing.T) {
+	src := map[string]string{
+		"crit": `<script critical>var crit = 1;</script><template>c</template>`,
+		"lazy": `<script>var lazy = 1;</script><template>l</template>`,
+		"page": `<template>{{ template "./crit" }}{{ template "./lazy" }}<p>body</p></template>`,
+	}
+	for _, tc := range []struct {
+		opts       Options
+		crit, lazy string
+	}{
+		{Options{DeferNonCritical: true}, "var crit", "var lazy"},
+		{Options{DeferNonCritical: true, ExternalAssets: true}, `<script src="/crit.`, `<script src="/lazy.`},
+	} {
+		tmpl, _ := compileMap(t, tc.opts, src)
+		page := render(t, tmpl, "page", nil)
+		body := strings.Index(page, "<p>body</p>")
+		if i := strings.Index(page, tc.crit); i < 0 || i > body {
+			t.Errorf("%+v: critical script missing or after markup:\n%s", tc.opts, page)
+		}
+		if i := strings.Index(page, tc.lazy); i < body {
+			t.Errorf("%+v: script not moved after markup:\n%s", tc.opts, page)
+		}
+		deferred := strings.Contains(page, `.js" defer>`)
+		if deferred != tc.opts.ExternalAssets {
+			t.Errorf("%+v: deferred = %t:\n%s", tc.opts, deferred, page)
+		}
+	}
+}
+
+// TestSplitTemplateFixtures compares the sections of each component in
+// testdata/split with its .golden file, which holds the output of the
+// implementation before section buffers were presized.
+func TestSplitTemplateFixtures(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "split", "*.tmpl"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no fixtures: %v", err)
+	}
+	tags, err := Options{}.sectionTags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := os.ReadFile(strings.TrimSuffix(file, ".tmpl") + ".golden")
+		if err != nil {
+			t.Fatal(err)
+		}
+		sections, attrs, lines, order, err := splitTemplate(bytes.NewReader(src), tags, len(src))
+		if err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		var got strings.Builder
+		for _, section := range order {
+			var as []string
+			for k, v := range attrs[section] {
+				as = append(as, fmt.Sprintf(" %s=%q", k, v))
+			}
+			sort.Strings(as)
+			fmt.Fprintf(&got, "-- %s%s line %d --\n%s\n",
+				section, strings.Join(as, ""), lines[section], sections[section])
+		}
+		if got.String() != string(want) {
+			t.Errorf("%s:\n%s\nwant:\n%s", file, got.String(), want)
+		}
+	}
+}
+
+func BenchmarkSplitTemplate(b *testing.B) {
+	// a large component, e.g. one with a long inline script and a big
+	// table, so buffer growth dominates
+	var src strings.Builder
+	src.WriteString("<style>\n")
+	for i := 0; i < 2000; i++ {
+		fmt.Fprintf(&src, "\t.row-%d { padding: %dpx; }\n", i, i%16)
+	}
+	src.WriteString("</style>\n<script>\n")
+	for i := 0; i < 2000; i++ {
+		fmt.Fprintf(&src, "\tfunction f%d(a, b) { return a < b ? %d : 0; }\n", i, i)
+	}
+	src.WriteString("</script>\n<template>\n\t<table>\n")
+	for i := 0; i < 5000; i++ {
+		fmt.Fprintf(&src, "\t\t<tr class=\"row-%d\"><td>{{ .Name }}</td><td>%d</td></tr>\n", i, i)
+	}
+	src.WriteString("\t</table>\n</template>\n")
+	data := src.String()
+	tags, err := Options{}.sectionTags()
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _, _, _, err := splitTemplate(strings.NewReader(data), tags, len(data))
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// TestCompileDirConcurrent compiles the same directory from several
+// goroutines. Run it with -race to check compilations share no state.
+func TestCompileDirConcurrent(t *testing.T) {
+	dir := writeDir(t, map[string]string{
+		"card.tmpl": `<style scoped>.card { margin: 0; }</style>
+<script>function card() {}</script>
+<template><div class="card">{{ .Title }}{{ template "./icon" }}</div></template>`,
+		"icon.tmpl": `<style>.icon { width: 1em; }</style><template><i class="icon"></i></template>`,
+		"list.tmpl": `<template>{{ range .Items }}<Card :title="."></Card>{{ end }}</template>`,
+		"page.tmpl": `<template extends="./base">{{ define "body" }}{{ template "./list" . }}{{ end }}</template>`,
+		"base.tmpl": `<template><main>{{ block "body" . }}{{ end }}</main></template>`,
+	})
+	opts := Options{Optimize: true, CollapseWhitespace: true, DedupAtRules: true}
+	data := map[string][]string{"Items": {"a", "b"}}
+	const n = 8
+	out := make([]string, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tmpl, err := CompileDir(dir, nil, opts)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			var buf bytes.Buffer
+			errs[i] = tmpl.ExecuteTemplate(&buf, "page", data)
+			out[i] = buf.String()
+		}(i)
+	}
+	wg.Wait()
+	for i := range out {
+		if errs[i] != nil {
+			t.Fatalf("compile %d: %v", i, errs[i])
+		}
+		if out[i] != out[0] {
+			t.Errorf("compile %d:\n%s\nwant, as compile 0:\n%s", i, out[i], out[0])
+		}
+	}
+	if !strings.Contains(out[0], "<i class=\"icon\">") {
+		t.Errorf("page:\n%s", out[0])
+	}
+}
+
+func TestDeterministicCompile(t *testing.T) {
+	src := map[string]string{
+		"a":    `<style>.a { margin: 0; }</style><template>{{ template "./b" }}{{ template "./c" }}</template>`,
+		"b":    `<style after="./c">.b { margin: 0; }</style><template>b{{ template "./d" }}</template>`,
+		"c":    `<style>.c { margin: 0; }</style><template>c{{ template "./d" }}</template>`,
+		"d":    `<style>.d { margin: 0; }</style><template>d</template>`,
+		"page": `<template>{{ template "./a" }}</template>`,
+	}
+	var names, pages []string
+	for i := 0; i < 5; i++ {
+		tmpl, _ := compileMap(t, Options{}, src)
+		var got []string
+		for _, tt := range Templates(tmpl) {
+			got = append(got, tt.Name())
+		}
+		if !sort.StringsAreSorted(got) {
+			t.Fatalf("Templates not sorted: %v", got)
+		}
+		names = append(names, strings.Join(got, " "))
+		pages = append(pages, render(t, tmpl, "page", nil))
+	}
+	for i := range names {
+		if names[i] != names[0] || pages[i] != pages[0] {
+			t.Fatalf("compile %d differs:\n%s\n%s\nwant:\n%s\n%s",
+				i, names[i], pages[i], names[0], pages[0])
+		}
+	}
+
+	// the first invalid reference in source order is always reported
+	bad := map[string][]byte{
+		"x": []byte(`<template>{{ template "./m1#" }}{{ template "./m2#" }}{{ template "./m3#" }}</template>`),
+	}
+	for i := 0; i < 5; i++ {
+		_, _, err := NewCompiler(Options{}).Map(bad)
+		if err == nil || !strings.Contains(err.Error(), "m1") {
+			t.Fatalf("err = %v, want one about m1", err)
+		}
+	}
+}
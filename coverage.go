@@ -0,0 +1,159 @@
+package component
+
+import (
+	"bytes"
+	"html/template"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template/parse"
+
+	"github.com/pkg/errors"
+)
+
+// coverFunc is the name of the template function recording that a
+// component was rendered.
+const coverFunc = "componentCovered"
+
+// Coverage records which pages and components are rendered, e.g. to check
+// that snapshot tests exercise every page:
+//
+//	cov, err := component.NewCoverage(t)
+//	// ... render each page with cov.ExecuteTemplate
+//	pages, comps := cov.Unexecuted()
+//	if len(pages) > 0 || len(comps) > 0 {
+//		t.Errorf("not rendered: pages %v, components %v", pages, comps)
+//	}
+//
+// A component counts as rendered once its template section is executed,
+// whether as a page or included by another. A Coverage is safe for
+// concurrent use.
+type Coverage struct {
+	t *template.Template
+
+	mu    sync.Mutex
+	pages map[string]bool
+	comps map[string]bool
+}
+
+// NewCoverage returns a Coverage rendering an instrumented copy of t. Since
+// templates can't be copied once executed, create it before executing t.
+func NewCoverage(t *template.Template) (*Coverage, error) {
+	cov := &Coverage{pages: map[string]bool{}, comps: map[string]bool{}}
+	c, err := t.Clone()
+	if err != nil {
+		return nil, errors.Wrap(err, "clone")
+	}
+	c.Funcs(template.FuncMap{coverFunc: cov.cover, slotFunc: cov.slot, includeFunc: cov.include})
+	for _, tt := range t.Templates() {
+		name := tt.Name()
+		if tt.Tree == nil {
+			continue
+		}
+		if isPage(name) {
+			cov.pages[name] = false
+		}
+		if !strings.HasSuffix(name, "#template") {
+			continue
+		}
+		comp := strings.TrimSuffix(name, "#template")
+		cov.comps[comp] = false
+		mark, err := template.New(name).Funcs(template.FuncMap{coverFunc: cov.cover}).
+			Parse(`{{ ` + coverFunc + ` ` + strconv.Quote(comp) + ` }}`)
+		if err != nil {
+			return nil, err
+		}
+		tree := tt.Tree.Copy()
+		tree.Root.Nodes = append([]parse.Node{mark.Tree.Root.Nodes[0]}, tree.Root.Nodes...)
+		if _, err := c.AddParseTree(name, tree); err != nil {
+			return nil, errors.Wrapf(err, "instrument %s", comp)
+		}
+	}
+	cov.t = c
+	return cov, nil
+}
+
+// isPage reports whether name is that of a page rather than a section, local
+// template, or template generated while compiling, all of which contain "#"
+// or "~".
+func isPage(name string) bool {
+	return name != "" && !strings.ContainsAny(name, "#~")
+}
+
+// cover records that a component was rendered.
+func (cov *Coverage) cover(comp string) string {
+	cov.mu.Lock()
+	cov.comps[comp] = true
+	cov.mu.Unlock()
+	return ""
+}
+
+// slot renders the children of an element including a component from the
+// instrumented template, so components within them are recorded too.
+func (cov *Coverage) slot(name string, data interface{}) (template.HTML, error) {
+	var buf bytes.Buffer
+	if err := cov.t.ExecuteTemplate(&buf, name, data); err != nil {
+		return "", err
+	}
+	return template.HTML(buf.String()), nil
+}
+
+// include renders a component included by the include function from the
+// instrumented template, so it's recorded too.
+func (cov *Coverage) include(name string, data ...interface{}) (template.HTML, error) {
+	var d interface{}
+	if len(data) > 0 {
+		d = data[0]
+	}
+	return cov.slot(name, d)
+}
+
+// Template returns the instrumented template, for rendering other than with
+// ExecuteTemplate, e.g. in a Handler. Only components are recorded when
+// rendering it directly, since pages are recorded by ExecuteTemplate.
+func (cov *Coverage) Template() *template.Template {
+	return cov.t
+}
+
+// ExecuteTemplate renders the named page or template like
+// template.ExecuteTemplate, recording it and the components it renders.
+func (cov *Coverage) ExecuteTemplate(w io.Writer, name string, data interface{}) error {
+	cov.mu.Lock()
+	if _, ok := cov.pages[name]; ok {
+		cov.pages[name] = true
+	}
+	cov.mu.Unlock()
+	return cov.t.ExecuteTemplate(w, name, data)
+}
+
+// Executed returns the sorted names of the pages rendered by
+// ExecuteTemplate and of the components rendered either way.
+func (cov *Coverage) Executed() (pages, comps []string) {
+	return cov.list(true)
+}
+
+// Unexecuted returns the sorted names of the pages and components not yet
+// rendered.
+func (cov *Coverage) Unexecuted() (pages, comps []string) {
+	return cov.list(false)
+}
+
+func (cov *Coverage) list(executed bool) (pages, comps []string) {
+	cov.mu.Lock()
+	defer cov.mu.Unlock()
+	for name, ok := range cov.pages {
+		if ok == executed {
+			pages = append(pages, name)
+		}
+	}
+	for name, ok := range cov.comps {
+		if ok == executed {
+			comps = append(comps, name)
+		}
+	}
+	sort.Strings(pages)
+	sort.Strings(comps)
+	return pages, comps
+}
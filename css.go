@@ -0,0 +1,577 @@
+package component
+
+import (
+	"fmt"
+	"hash/fnv"
+	"html/template"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// cssKind identifies the type of a parsed cssRule.
+type cssKind int
+
+const (
+	// cssQualified is a style rule, e.g. "a:hover { color: red; }"
+	cssQualified cssKind = iota
+
+	// cssAtBlock is an at-rule with an opaque block, e.g. @font-face or
+	// @keyframes, whose body we never look inside.
+	cssAtBlock
+
+	// cssAtGroup is a conditional group at-rule such as @media whose block
+	// contains nested rules.
+	cssAtGroup
+
+	// cssStatement is an at-rule without a block, e.g. @import.
+	cssStatement
+
+	// cssAction is a template action, e.g. {{ if .Dark }}, found between
+	// rules. It's kept verbatim.
+	cssAction
+)
+
+// groupAtRules have blocks containing other rules rather than declarations.
+var groupAtRules = map[string]bool{
+	"media":     true,
+	"supports":  true,
+	"document":  true,
+	"layer":     true,
+	"container": true,
+}
+
+// cssRule is a single node in a parsed style section. It's deliberately
+// lightweight: we only understand enough CSS to find selectors and at-rules,
+// and the contents of declaration blocks are kept as-is.
+type cssRule struct {
+	kind    cssKind
+	prelude string
+	body    string
+	rules   []*cssRule
+}
+
+// atName returns the lowercase name of an at-rule, e.g. "media", or "" if
+// the rule isn't an at-rule.
+func (r *cssRule) atName() string {
+	if !strings.HasPrefix(r.prelude, "@") {
+		return ""
+	}
+	name := r.prelude[1:]
+	if i := strings.IndexAny(name, " \t\r\n({;"); i >= 0 {
+		name = name[:i]
+	}
+	return strings.ToLower(name)
+}
+
+// parseCSS parses a style section into rules. Template actions are treated
+// as opaque, so "{{" and "}}" never affect block nesting.
+func parseCSS(src string) []*cssRule {
+	p := &cssParser{src: src}
+	return p.rules(false)
+}
+
+type cssParser struct {
+	src string
+	pos int
+}
+
+func (p *cssParser) rules(nested bool) []*cssRule {
+	var rules []*cssRule
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.src) {
+			return rules
+		}
+		if p.src[p.pos] == '}' {
+			p.pos++
+			if nested {
+				return rules
+			}
+			// stray closing brace, ignore it
+			continue
+		}
+		if strings.HasPrefix(p.src[p.pos:], "{{") {
+			start := p.pos
+			p.pos = skipAction(p.src, p.pos)
+			rules = append(rules, &cssRule{
+				kind:    cssAction,
+				prelude: p.src[start:p.pos],
+			})
+			continue
+		}
+		start := p.pos
+		end := p.scanUntil("{;}")
+		rule := &cssRule{prelude: strings.TrimSpace(p.src[start:end])}
+		if end >= len(p.src) || p.src[end] != '{' {
+			// statement at-rules (or garbage) end at a semicolon
+			if end < len(p.src) && p.src[end] == ';' {
+				end++
+			}
+			p.pos = end
+			if rule.prelude != "" {
+				rule.kind = cssStatement
+				rules = append(rules, rule)
+			}
+			continue
+		}
+		p.pos = end + 1
+		if groupAtRules[rule.atName()] {
+			rule.kind = cssAtGroup
+			rule.rules = p.rules(true)
+		} else {
+			if rule.atName() != "" {
+				rule.kind = cssAtBlock
+			}
+			bodyStart := p.pos
+			bodyEnd := p.scanBlock()
+			rule.body = p.src[bodyStart:bodyEnd]
+		}
+		rules = append(rules, rule)
+	}
+}
+
+// skipSpace skips whitespace and comments.
+func (p *cssParser) skipSpace() {
+	for p.pos < len(p.src) {
+		switch {
+		case strings.ContainsRune(" \t\r\n\f", rune(p.src[p.pos])):
+			p.pos++
+		case strings.HasPrefix(p.src[p.pos:], "/*"):
+			p.pos = skipComment(p.src, p.pos)
+		default:
+			return
+		}
+	}
+}
+
+// scanUntil returns the position of the first byte in stop outside of
+// strings, comments, parentheses, brackets, and template actions.
+func (p *cssParser) scanUntil(stop string) int {
+	depth := 0
+	for i := p.pos; i < len(p.src); {
+		c := p.src[i]
+		switch {
+		case strings.HasPrefix(p.src[i:], "{{"):
+			i = skipAction(p.src, i)
+			continue
+		case strings.HasPrefix(p.src[i:], "/*"):
+			i = skipComment(p.src, i)
+			continue
+		case c == '"' || c == '\'':
+			i = skipString(p.src, i)
+			continue
+		case c == '\\':
+			i += 2
+			continue
+		case c == '(' || c == '[':
+			depth++
+		case c == ')' || c == ']':
+			if depth > 0 {
+				depth--
+			}
+		case depth == 0 && strings.IndexByte(stop, c) >= 0:
+			return i
+		}
+		i++
+	}
+	return len(p.src)
+}
+
+// scanBlock advances past the closing brace matching an already consumed
+// opening brace, returning the position of the closing brace.
+func (p *cssParser) scanBlock() int {
+	depth := 1
+	for i := p.pos; i < len(p.src); {
+		c := p.src[i]
+		switch {
+		case strings.HasPrefix(p.src[i:], "{{"):
+			i = skipAction(p.src, i)
+			continue
+		case strings.HasPrefix(p.src[i:], "/*"):
+			i = skipComment(p.src, i)
+			continue
+		case c == '"' || c == '\'':
+			i = skipString(p.src, i)
+			continue
+		case c == '\\':
+			i += 2
+			continue
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+			if depth == 0 {
+				p.pos = i + 1
+				return i
+			}
+		}
+		i++
+	}
+	p.pos = len(p.src)
+	return len(p.src)
+}
+
+func skipComment(s string, i int) int {
+	end := strings.Index(s[i+2:], "*/")
+	if end < 0 {
+		return len(s)
+	}
+	return i + 2 + end + 2
+}
+
+func skipString(s string, i int) int {
+	q := s[i]
+	for i++; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case q, '\n':
+			return i + 1
+		}
+	}
+	return len(s)
+}
+
+// skipAction returns the position after the template action starting at i,
+// accounting for "}}" appearing within quoted arguments.
+func skipAction(s string, i int) int {
+	for i += 2; i < len(s); i++ {
+		switch s[i] {
+		case '"', '\'':
+			i = skipString(s, i) - 1
+		case '`':
+			end := strings.IndexByte(s[i+1:], '`')
+			if end < 0 {
+				return len(s)
+			}
+			i += end + 1
+		case '}':
+			if strings.HasPrefix(s[i:], "}}") {
+				return i + 2
+			}
+		}
+	}
+	return len(s)
+}
+
+// printCSS serializes rules back into a stylesheet.
+func printCSS(rules []*cssRule) string {
+	var b strings.Builder
+	writeCSS(&b, rules)
+	return b.String()
+}
+
+func writeCSS(b *strings.Builder, rules []*cssRule) {
+	for _, r := range rules {
+		switch r.kind {
+		case cssAction:
+			b.WriteString(r.prelude)
+		case cssStatement:
+			b.WriteString(r.prelude)
+			b.WriteString(";")
+		case cssAtGroup:
+			b.WriteString(r.prelude)
+			b.WriteString(" {\n")
+			writeCSS(b, r.rules)
+			b.WriteString("}")
+		default:
+			b.WriteString(r.prelude)
+			b.WriteString(" {")
+			b.WriteString(r.body)
+			b.WriteString("}")
+		}
+		b.WriteString("\n")
+	}
+}
+
+// splitSelectors splits a selector list on top-level commas.
+func splitSelectors(list string) []string {
+	var sels []string
+	depth := 0
+	start := 0
+	for i := 0; i < len(list); i++ {
+		switch c := list[i]; {
+		case c == '"' || c == '\'':
+			i = skipString(list, i) - 1
+		case c == '\\':
+			i++
+		case strings.HasPrefix(list[i:], "{{"):
+			i = skipAction(list, i) - 1
+		case c == '(' || c == '[':
+			depth++
+		case c == ')' || c == ']':
+			if depth > 0 {
+				depth--
+			}
+		case c == ',' && depth == 0:
+			sels = append(sels, strings.TrimSpace(list[start:i]))
+			start = i + 1
+		}
+	}
+	return append(sels, strings.TrimSpace(list[start:]))
+}
+
+// firstCompound returns the length of the first compound selector in sel,
+// i.e. everything up to the first combinator, and the position within it
+// where attribute selectors should be inserted (before any pseudo-classes
+// or pseudo-elements).
+func firstCompound(sel string) (end, insert int) {
+	depth := 0
+	insert = -1
+	for i := 0; i < len(sel); i++ {
+		switch c := sel[i]; {
+		case c == '"' || c == '\'':
+			i = skipString(sel, i) - 1
+		case c == '\\':
+			i++
+		case c == '(' || c == '[':
+			depth++
+		case c == ')' || c == ']':
+			if depth > 0 {
+				depth--
+			}
+		case depth > 0:
+		case c == ':' && insert < 0:
+			insert = i
+		case strings.IndexByte(" \t\r\n>+~", c) >= 0:
+			if insert < 0 {
+				insert = i
+			}
+			return i, insert
+		}
+	}
+	if insert < 0 {
+		insert = len(sel)
+	}
+	return len(sel), insert
+}
+
+// globalSelectors match document-level elements, so they can't be confined
+// to a component.
+var globalSelectors = map[string]bool{
+	"html": true,
+	"body": true,
+}
+
+// isGlobalCompound reports whether a compound selector targets the document
+// rather than anything within a component.
+func isGlobalCompound(compound string) bool {
+	if compound == "*" || strings.HasPrefix(compound, ":root") {
+		return true
+	}
+	i := strings.IndexAny(compound, ".#[:")
+	if i < 0 {
+		i = len(compound)
+	}
+	return globalSelectors[strings.ToLower(compound[:i])]
+}
+
+// scopeID returns a short identifier unique to the named component, used to
+// confine its scoped styles.
+func scopeID(name string) string {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return fmt.Sprintf("%08x", h.Sum32())
+}
+
+// scopeAttr returns the attribute added to a scoped component's top-level
+// elements.
+func scopeAttr(name string) string {
+	return "data-c-" + scopeID(name)
+}
+
+// scopeStyle rewrites the selectors in a scoped style section so they only
+// match elements within the component. Each selector S becomes both
+// "S[attr]" (the component's top-level elements) and "[attr] S" (their
+// descendants). Selectors wrapped in :global(...) are unwrapped and left
+// unscoped.
+//
+// Selectors which target the document itself, like "body" or ":root", can
+// never match within a component, so those are reported as warnings.
+func scopeStyle(name string, style []byte) ([]byte, []Warning) {
+	attr := "[" + scopeAttr(name) + "]"
+	rules := parseCSS(string(style))
+	var warnings []Warning
+	var scope func(rules []*cssRule)
+	scope = func(rules []*cssRule) {
+		for _, r := range rules {
+			switch r.kind {
+			case cssAtGroup:
+				scope(r.rules)
+			case cssQualified:
+				var sels []string
+				for _, sel := range splitSelectors(r.prelude) {
+					if sel == "" {
+						continue
+					}
+					if strings.Contains(sel, ":global(") {
+						sels = append(sels, unwrapGlobal(sel))
+						continue
+					}
+					end, insert := firstCompound(sel)
+					if isGlobalCompound(sel[:end]) {
+						warnings = append(warnings, Warning{
+							Component: name,
+							Kind:      WarnGlobalSelector,
+							Message: fmt.Sprintf(
+								"selector %q in scoped style targets the document, not the component; use :global(%s) if intended",
+								sel, sel),
+						})
+					}
+					if end == 0 {
+						// selector starts with a combinator
+						sels = append(sels, attr+" "+sel)
+						continue
+					}
+					sels = append(sels,
+						sel[:insert]+attr+sel[insert:],
+						attr+" "+sel)
+				}
+				r.prelude = strings.Join(sels, ", ")
+			}
+		}
+	}
+	scope(rules)
+	return []byte(printCSS(rules)), warnings
+}
+
+// unwrapGlobal replaces each ":global(X)" in a selector with X.
+func unwrapGlobal(sel string) string {
+	for {
+		i := strings.Index(sel, ":global(")
+		if i < 0 {
+			return sel
+		}
+		start := i + len(":global(")
+		depth := 1
+		j := start
+		for ; j < len(sel) && depth > 0; j++ {
+			switch sel[j] {
+			case '(':
+				depth++
+			case ')':
+				depth--
+			}
+		}
+		if depth > 0 {
+			return sel
+		}
+		sel = sel[:i] + sel[start:j-1] + sel[j:]
+	}
+}
+
+// hoistedAtRules are at-rules which may be moved and deduplicated without
+// affecting the cascade.
+var hoistedAtRules = map[string]bool{
+	"keyframes":         true,
+	"-webkit-keyframes": true,
+	"font-face":         true,
+}
+
+// hoistAtRules moves a component's top-level @keyframes and @font-face rules
+// out of its style and into templates shared by every component declaring
+// an identical rule. See Options.DedupAtRules.
+func (b *builder) hoistAtRules(c *component) error {
+	rules := parseCSS(string(c.sections["style"]))
+	kept := rules[:0]
+	for _, r := range rules {
+		if r.kind != cssAtBlock || !hoistedAtRules[r.atName()] {
+			kept = append(kept, r)
+			continue
+		}
+		text := printCSS([]*cssRule{r})
+		key := strings.Join(strings.Fields(text), " ")
+		h := fnv.New64a()
+		h.Write([]byte(key))
+		name := fmt.Sprintf("#%s-%016x", r.atName(), h.Sum64())
+		if !b.defined[name] {
+			t, err := template.New(name).Funcs(b.fns).Parse(text)
+			if err != nil {
+				return errors.Wrapf(err, "parse %s in %s", r.atName(), c.name)
+			}
+			b.trees = append(b.trees, t.Tree)
+			b.defined[name] = true
+		}
+		b.atRules[c.name] = append(b.atRules[c.name], name)
+	}
+	if len(kept) < len(rules) {
+		c.sections["style"] = []byte(printCSS(kept))
+	}
+	return nil
+}
+
+// mediaGroup is a component's rules for a single media query, hoisted out of
+// its style by Options.GroupMedia.
+type mediaGroup struct {
+	// open is the name of the template opening the @media block shared by
+	// every component using the same query, and name holds the
+	// component's rules within it.
+	open, name string
+}
+
+// mediaClose is the name of the template closing a grouped @media block.
+const mediaClose = "#media-end"
+
+// groupMedia moves a component's top-level @media rules into templates so
+// pages can group the rules of every component sharing a query into one
+// block. See Options.GroupMedia.
+func (b *builder) groupMedia(c *component) error {
+	style := c.sections["style"]
+	if strings.Contains(string(style), "{{") {
+		// moving rules out of conditionals would change their meaning
+		return nil
+	}
+	rules := parseCSS(string(style))
+	kept := rules[:0]
+	var queries []string
+	inner := map[string][]*cssRule{}
+	for _, r := range rules {
+		if r.kind != cssAtGroup || r.atName() != "media" {
+			kept = append(kept, r)
+			continue
+		}
+		query := strings.Join(strings.Fields(r.prelude), " ")
+		if _, ok := inner[query]; !ok {
+			queries = append(queries, query)
+		}
+		inner[query] = append(inner[query], r.rules...)
+	}
+	if len(queries) == 0 {
+		return nil
+	}
+	if !b.defined[mediaClose] {
+		if err := b.addText(mediaClose, "}"); err != nil {
+			return err
+		}
+	}
+	for _, query := range queries {
+		h := fnv.New64a()
+		h.Write([]byte(query))
+		id := fmt.Sprintf("%016x", h.Sum64())
+		g := mediaGroup{open: "#media-" + id, name: c.name + "#media-" + id}
+		if !b.defined[g.open] {
+			if err := b.addText(g.open, query+" {"); err != nil {
+				return err
+			}
+		}
+		if err := b.addText(g.name, strings.TrimSpace(printCSS(inner[query]))); err != nil {
+			return errors.Wrapf(err, "parse media rules in %s", c.name)
+		}
+		b.media[c.name] = append(b.media[c.name], g)
+	}
+	c.sections["style"] = []byte(printCSS(kept))
+	return nil
+}
+
+// addText defines a template holding CSS generated at compile time.
+func (b *builder) addText(name, text string) error {
+	t, err := template.New(name).Funcs(b.fns).Parse(text)
+	if err != nil {
+		return err
+	}
+	b.trees = append(b.trees, t.Tree)
+	b.defined[name] = true
+	b.allNames[name] = true
+	return nil
+}
@@ -0,0 +1,97 @@
+package component
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDedupAtRules(t *testing.T) {
+	src := map[string]string{
+		"a": `<style>
+@keyframes spin { to { transform: rotate(360deg); } }
+@font-face { font-family: "Inter"; src: url(/inter.woff2); }
+.a { animation: spin 1s; }
+</style>
+<template>a</template>`,
+		// the same rules, formatted differently
+		"b": `<style>
+@keyframes spin {
+  to { transform: rotate(360deg); }
+}
+@font-face {
+  font-family: "Inter";
+  src: url(/inter.woff2);
+}
+@keyframes fade { to { opacity: 0; } }
+.b { animation: spin 2s; }
+</style>
+<template>b</template>`,
+		"page": `<template>{{ template "./a" }}{{ template "./b" }}</template>`,
+	}
+	tmpl, _ := compileMap(t, Options{DedupAtRules: true}, src)
+	page := render(t, tmpl, "page", nil)
+	for rule, want := range map[string]int{
+		"@keyframes spin": 1,
+		"@font-face":      1,
+		"@keyframes fade": 1,
+		".a {":            1,
+		".b {":            1,
+	} {
+		if n := strings.Count(page, rule); n != want {
+			t.Errorf("%q appears %d times, want %d:\n%s", rule, n, want, page)
+		}
+	}
+	// the at-rules are hoisted ahead of the components' other styles
+	if strings.Index(page, "@keyframes spin") > strings.Index(page, ".a {") {
+		t.Errorf("at-rules should come first:\n%s", page)
+	}
+
+	// each component's own page keeps its rules
+	if a := render(t, tmpl, "a", nil); !strings.Contains(a, "@keyframes spin") {
+		t.Errorf("a lost its keyframes:\n%s", a)
+	}
+
+	tmpl, _ = compileMap(t, Options{}, src)
+	if n := strings.Count(render(t, tmpl, "page", nil), "@keyframes spin"); n != 2 {
+		t.Errorf("without the option, keyframes appear %d times, want 2", n)
+	}
+}
+
+func TestGroupMedia(t *testing.T) {
+	src := map[string]string{
+		"a": `<style>
+.a { color: red; }
+@media (max-width: 600px) { .a { color: blue; } }
+@media print { .a { display: none; } }
+</style>
+<template>a</template>`,
+		"b": `<style>
+.b { color: red; }
+@media (max-width: 600px) { .b { color: green; } }
+</style>
+<template>b</template>`,
+		"page": `<template>{{ template "./a" }}{{ template "./b" }}</template>`,
+	}
+	tmpl, _ := compileMap(t, Options{GroupMedia: true}, src)
+	page := render(t, tmpl, "page", nil)
+	want := `.a { color: red; }
+
+.b { color: red; }
+
+@media (max-width: 600px) {
+.a { color: blue; }
+.b { color: green; }
+}
+@media print {
+.a { display: none; }
+}`
+	if !strings.Contains(page, want) {
+		t.Errorf("page styles:\n%s\nwant:\n%s", page, want)
+	}
+
+	tmpl, _ = compileMap(t, Options{}, src)
+	page = render(t, tmpl, "page", nil)
+	if n := strings.Count(page, "@media (max-width: 600px)"); n != 2 {
+		t.Errorf("without the option, the query appears %d times, want 2", n)
+	}
+}
@@ -0,0 +1,178 @@
+package component
+
+import (
+	"fmt"
+	"go/format"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// GenerateDataTypes generates a type for the data of each component in a
+// directory from the fields its template uses, as reported by
+// Meta.DataFields, for scaffolding a typed data model, e.g. from a
+// go:generate step. lang is "go" for Go structs or "typescript" for
+// TypeScript interfaces. The result maps each component using fields to the
+// type's source, named after the component, e.g. ListItemData for
+// "list/item".
+//
+// Types are heuristic: only the presence and nesting of fields can be
+// known, so each field which isn't a struct itself has an unknown type,
+// interface{} or unknown, and a field ranged over is a slice of structs.
+func GenerateDataTypes(dirname, lang string, opts ...Options) (map[string]string, error) {
+	var gen func(name string, root *typeNode) (string, error)
+	switch lang {
+	case "go":
+		gen = goDataType
+	case "typescript":
+		gen = tsDataType
+	default:
+		return nil, fmt.Errorf("unknown language %q", lang)
+	}
+	_, meta, err := CompileDirMeta(dirname, nil, opts...)
+	if err != nil {
+		return nil, err
+	}
+	types := make(map[string]string, len(meta.DataFields))
+	for name, fields := range meta.DataFields {
+		root := &typeNode{}
+		for _, f := range fields {
+			root.add(f)
+		}
+		src, err := gen(name, root)
+		if err != nil {
+			return nil, errors.Wrapf(err, "generate type for %s", name)
+		}
+		types[name] = src
+	}
+	return types, nil
+}
+
+// typeNode is a value within a component's data, built from the paths of
+// the fields used.
+type typeNode struct {
+	// fields are the value's fields, if it's a struct.
+	fields map[string]*typeNode
+
+	// elem is the type of the value's elements, if it's ranged over.
+	elem *typeNode
+}
+
+// add adds the field at path within n, e.g. "Items[].Name".
+func (n *typeNode) add(path string) {
+	for _, part := range strings.Split(path, ".") {
+		name := strings.TrimSuffix(part, "[]")
+		if n.fields == nil {
+			n.fields = map[string]*typeNode{}
+		}
+		child := n.fields[name]
+		if child == nil {
+			child = &typeNode{}
+			n.fields[name] = child
+		}
+		n = child
+		if name != part {
+			if n.elem == nil {
+				n.elem = &typeNode{}
+			}
+			n = n.elem
+		}
+	}
+}
+
+// sortedFields returns the names of n's fields, sorted.
+func (n *typeNode) sortedFields() []string {
+	names := make([]string, 0, len(n.fields))
+	for name := range n.fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// dataTypeName returns the name of the type of a component's data, e.g.
+// ListItemData for "list/item".
+func dataTypeName(name string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	s := b.String()
+	if r, _ := utf8.DecodeRuneInString(s); !unicode.IsLetter(r) {
+		s = "C" + s
+	}
+	return s + "Data"
+}
+
+// goDataType returns a Go struct type for a component's data, formatted.
+func goDataType(name string, root *typeNode) (string, error) {
+	var write func(b *strings.Builder, n *typeNode)
+	write = func(b *strings.Builder, n *typeNode) {
+		switch {
+		case n.elem != nil:
+			b.WriteString("[]")
+			write(b, n.elem)
+		case len(n.fields) > 0:
+			b.WriteString("struct {\n")
+			for _, f := range n.sortedFields() {
+				b.WriteString(f + " ")
+				write(b, n.fields[f])
+				b.WriteString("\n")
+			}
+			b.WriteString("}")
+		default:
+			b.WriteString("interface{}")
+		}
+	}
+	typ := dataTypeName(name)
+	var b strings.Builder
+	fmt.Fprintf(&b, "// %s is the data of the %s component.\ntype %s ", typ, name, typ)
+	write(&b, root)
+	b.WriteString("\n")
+	src, err := format.Source([]byte(b.String()))
+	if err != nil {
+		return "", err
+	}
+	return string(src), nil
+}
+
+// tsDataType returns a TypeScript interface for a component's data.
+func tsDataType(name string, root *typeNode) (string, error) {
+	var write func(b *strings.Builder, n *typeNode, indent string)
+	write = func(b *strings.Builder, n *typeNode, indent string) {
+		switch {
+		case n.elem != nil:
+			write(b, n.elem, indent)
+			b.WriteString("[]")
+		case len(n.fields) > 0:
+			b.WriteString("{\n")
+			for _, f := range n.sortedFields() {
+				b.WriteString(indent + "\t" + f + ": ")
+				write(b, n.fields[f], indent+"\t")
+				b.WriteString(";\n")
+			}
+			b.WriteString(indent + "}")
+		default:
+			b.WriteString("unknown")
+		}
+	}
+	typ := dataTypeName(name)
+	var b strings.Builder
+	fmt.Fprintf(&b, "// %s is the data of the %s component.\nexport interface %s ",
+		typ, name, typ)
+	write(&b, root, "")
+	b.WriteString("\n")
+	return b.String(), nil
+}
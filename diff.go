@@ -0,0 +1,185 @@
+package component
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"html/template"
+	"sort"
+	"strings"
+)
+
+// Change kinds.
+const (
+	// ChangeAdded is reported for components only in the new set.
+	ChangeAdded = "added"
+
+	// ChangeRemoved is reported for components only in the old set.
+	ChangeRemoved = "removed"
+
+	// ChangeOutput is reported for pages whose assembled output may
+	// differ, because the page or any template it includes changed.
+	ChangeOutput = "output"
+
+	// ChangeDependencies is reported for components which include a
+	// different set of components.
+	ChangeDependencies = "dependencies"
+)
+
+// Change is a difference between two compiled sets of components.
+type Change struct {
+	// Component is the name of the component, e.g. "list/item".
+	Component string
+
+	// Kind categorizes the change, e.g. ChangeOutput.
+	Kind string
+
+	// Added and Removed are the components the component began and
+	// stopped including, for ChangeDependencies.
+	Added, Removed []string
+}
+
+func (c Change) String() string {
+	switch c.Kind {
+	case ChangeAdded, ChangeRemoved:
+		return c.Component + ": " + c.Kind
+	case ChangeOutput:
+		return c.Component + ": output changed"
+	}
+	var parts []string
+	if len(c.Added) > 0 {
+		parts = append(parts, "now includes "+strings.Join(c.Added, ", "))
+	}
+	if len(c.Removed) > 0 {
+		parts = append(parts, "no longer includes "+strings.Join(c.Removed, ", "))
+	}
+	return c.Component + ": " + strings.Join(parts, "; ")
+}
+
+// Diff reports how two compiled sets of components differ, e.g. those
+// compiled from the base and head of a pull request, sorted by component
+// and then kind. A page's output is compared without rendering it, by
+// hashing the templates it's assembled from, so ChangeOutput is reported
+// for any change to them, even one which renders the same.
+//
+// Compare sets before executing them, since html/template rewrites
+// templates on first execution to escape their output.
+func Diff(before, after *template.Template) []Change {
+	var changes []Change
+	old, cur := componentNames(before), componentNames(after)
+	for name := range old {
+		if !cur[name] {
+			changes = append(changes, Change{Component: name, Kind: ChangeRemoved})
+		}
+	}
+	for name := range cur {
+		if !old[name] {
+			changes = append(changes, Change{Component: name, Kind: ChangeAdded})
+			continue
+		}
+		if pageHash(before, name) != pageHash(after, name) {
+			changes = append(changes, Change{Component: name, Kind: ChangeOutput})
+		}
+		added, removed := diffSets(includedBy(before, name), includedBy(after, name))
+		if len(added) > 0 || len(removed) > 0 {
+			changes = append(changes, Change{
+				Component: name,
+				Kind:      ChangeDependencies,
+				Added:     added,
+				Removed:   removed,
+			})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		a, b := changes[i], changes[j]
+		if a.Component != b.Component {
+			return a.Component < b.Component
+		}
+		return a.Kind < b.Kind
+	})
+	return changes
+}
+
+// componentNames returns the names of the components in t, i.e. those of
+// its page templates.
+func componentNames(t *template.Template) map[string]bool {
+	names := map[string]bool{}
+	for _, tt := range t.Templates() {
+		if tt.Tree != nil && isPage(tt.Name()) {
+			names[tt.Name()] = true
+		}
+	}
+	return names
+}
+
+// pageHash hashes the named page and every template it renders,
+// transitively, including the children passed to components and those
+// rendered with the include function.
+func pageHash(t *template.Template, name string) string {
+	seen := map[string]bool{name: true}
+	queue := []string{name}
+	for i := 0; i < len(queue); i++ {
+		tt := t.Lookup(queue[i])
+		if tt == nil || tt.Tree == nil {
+			continue
+		}
+		for _, ref := range templateRefs(tt) {
+			if !seen[ref] {
+				seen[ref] = true
+				queue = append(queue, ref)
+			}
+		}
+	}
+	sort.Strings(queue)
+	h := sha256.New()
+	for _, n := range queue {
+		fmt.Fprintf(h, "%s\x00", n)
+		if tt := t.Lookup(n); tt != nil && tt.Tree != nil {
+			fmt.Fprintf(h, "%s\x00", tt.Tree.Root)
+		}
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// includedBy returns the components the named component includes from its
+// template section and the local templates it defines, including its
+// children's slots and with the include function.
+func includedBy(t *template.Template, name string) map[string]bool {
+	deps := map[string]bool{}
+	seen := map[string]bool{}
+	queue := []string{name + "#template"}
+	for i := 0; i < len(queue); i++ {
+		tt := t.Lookup(queue[i])
+		if tt == nil || tt.Tree == nil {
+			continue
+		}
+		for _, ref := range templateRefs(tt) {
+			switch {
+			case strings.HasPrefix(ref, name+"~") && !seen[ref]:
+				seen[ref] = true
+				queue = append(queue, ref)
+			case strings.HasSuffix(ref, "#template"):
+				if dep := strings.TrimSuffix(ref, "#template"); dep != name {
+					deps[dep] = true
+				}
+			}
+		}
+	}
+	return deps
+}
+
+// diffSets returns the sorted names only in b and only in a.
+func diffSets(a, b map[string]bool) (added, removed []string) {
+	for name := range b {
+		if !a[name] {
+			added = append(added, name)
+		}
+	}
+	for name := range a {
+		if !b[name] {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
@@ -0,0 +1,49 @@
+package component
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	before, _ := compileMap(t, Options{}, map[string]string{
+		"page":   `<template>{{ template "./card" }}</template>`,
+		"card":   `<template><div>card</div></template>`,
+		"about":  `<template>about</template>`,
+		"banner": `<template>old</template>`,
+	})
+	after, _ := compileMap(t, Options{}, map[string]string{
+		"page":   `<template>{{ template "./card" }}{{ template "./footer" }}</template>`,
+		"card":   `<template><div>new card</div></template>`,
+		"about":  `<template>about</template>`,
+		"footer": `<template>footer</template>`,
+	})
+	want := []Change{
+		{Component: "banner", Kind: ChangeRemoved},
+		{Component: "card", Kind: ChangeOutput},
+		{Component: "footer", Kind: ChangeAdded},
+		{Component: "page", Kind: ChangeDependencies, Added: []string{"footer"}},
+		{Component: "page", Kind: ChangeOutput},
+	}
+	if got := Diff(before, after); !reflect.DeepEqual(got, want) {
+		t.Errorf("Diff:\n%v\nwant:\n%v", got, want)
+	}
+
+	// a page changes with the components it includes
+	changed, _ := compileMap(t, Options{}, map[string]string{
+		"page":   `<template>{{ template "./card" }}{{ template "./footer" }}</template>`,
+		"card":   `<template><div>card</div></template>`,
+		"about":  `<template>about</template>`,
+		"footer": `<template>footer</template>`,
+	})
+	want = []Change{
+		{Component: "card", Kind: ChangeOutput},
+		{Component: "page", Kind: ChangeOutput},
+	}
+	if got := Diff(changed, after); !reflect.DeepEqual(got, want) {
+		t.Errorf("Diff of an include:\n%v\nwant:\n%v", got, want)
+	}
+	if got := Diff(after, after); len(got) != 0 {
+		t.Errorf("Diff of a set with itself: %v", got)
+	}
+}
@@ -0,0 +1,262 @@
+// Package component generates HTML templates from single-file components,
+// similar to Vue.js or Svbtle. Single-file components contain the style,
+// scripts, and structure to render a given component, rather than placing
+// styles and scripts in separate directories.
+//
+// Go's stdlib and HTML templates get us 90% of the way to single-file
+// components, but they have a drawback preventing their use for this purpose:
+// since single-file components embed style and script tags, including the same
+// template 100 times (such as for an item in a list) would include the
+// associated script and style tags 100 times and create tons of bloat.
+// Instead, for any template included as a partial, this package ensures only 1
+// copy of its script and style tags are included. For example, if the same
+// template is included twice, component excludes the second one's duplicated
+// style and script tags.
+//
+// To prevent namespace collisions, you should namespace each of your styles
+// and Javascript functions under a name matching the component. This isn't
+// enforced unless Options.EnforceNamespacing is set. Alternatively, mark a
+// component's style as <style scoped> to confine its selectors to the
+// component.
+//
+// You'll find more examples in the package's templates/ directory.
+//
+// # Components
+//
+// A component is a file with the ".tmpl" extension. Components may only have
+// <style>, <script>, and <template> root tags. The structure of the
+// component, e.g. the text and divs that make it up, should go in the
+// <template> tag. Only the outermost tags delimit sections, so a <template>
+// element meant for the browser may be nested within the component's
+// <template>.
+//
+// Names for templates are defined automatically based on the name of the file
+// it was drawn from, using a relative path with a forward slash (on any
+// platform -- even on Windows). e.g. assume we have one file named
+// "templates/analytics.tmpl" and another named "templates/graphs/user.tmpl":
+//
+//	// main.go
+//	t, err := component.CompileDir("templates", nil)
+//	if err != nil {
+//		return err
+//	}
+//	err = t.ExecuteTemplate(out, "analytics", nil)
+//	// Or...
+//	err = t.ExecuteTemplate(out, "graphs/user", nil)
+//
+// to render our analytics page on its own. Pages are rendered by these bare
+// names, without a leading "./".
+//
+// # Including components
+//
+// Rendering one template within another as a partial stays the same,
+// although we use a relative path, such as in the following example:
+//
+//	// analytics.tmpl
+//	<template>
+//		<h1>Analytics</h1>
+//		{{ template "./graphs/user" . }}
+//	</template>
+//
+// Note the leading "./" in the path, which is relative to the including
+// component's directory. A leading "/" instead refers to a component by its
+// path from the template directory, regardless of where the referring
+// component is, e.g. {{ template "/components/button" . }}. Paths may
+// contain spaces and Unicode, e.g. {{ template "./my dir/café" . }}, but not
+// "#" or "~".
+//
+// A reference may name a single section of another component, e.g.
+// {{ template "./card#style" . }} within a <style> to share the card's rules
+// intentionally, or {{ template "./card#template" . }} to render its markup
+// alone. Unlike including the component, this doesn't make it a dependency,
+// so its style and script aren't added to the page. Naming a section the
+// component doesn't have is an error.
+//
+// A component may also be rendered into a variable with the include
+// function, e.g. to use its output more than once or pass it to another
+// component:
+//
+//	{{ $avatar := include "./avatar" .User }}
+//	{{ template "./card" (componentProps "icon" $avatar) }}
+//
+// The path must be quoted, and it's resolved like a template action's, so
+// the included component's styles and scripts are added to the page as
+// usual. Its output is trusted HTML, so don't interpolate it within
+// attributes or scripts. Defining your own include function in the FuncMap
+// turns this off.
+//
+// Similarly, the jsonScript function embeds data for scripts as a JSON data
+// island, e.g. {{ jsonScript "cart-data" .Cart }}, escaped so it's safe
+// whatever the data holds.
+//
+// # Props and slots
+//
+// To pass a component specific props rather than the whole of dot, include
+// it with a <component> element naming its path, e.g.:
+//
+//	<component is="./card" title="Hello" :user=".User"></component>
+//
+// The component's data is then a map of its attributes, here with "title"
+// set to the string "Hello" and "user" to the result of the pipeline
+// ".User". Attributes prefixed with ":" are pipelines, as is a value which
+// is a single action, e.g. title="{{ .Title }}", while one without a value
+// is true. Kebab-case names become camelCase keys, e.g. user-name is
+// available as .userName, since HTML ignores the case of attribute names.
+//
+// Components in the same directory may also be included by name, as a
+// PascalCase element or one prefixed with "c-", e.g. <UserCard> or
+// <c-user-card> for "./user-card". Dots separate directories, e.g.
+// <Forms.TextInput> for "./forms/text-input". Either is left as is unless
+// the component exists, so HTML elements and custom elements still work.
+// The children of any of these elements are rendered with the includer's
+// data and passed as .slot, e.g.:
+//
+//	// card.tmpl
+//	<template><div class="card">{{ .slot }}</div></template>
+//
+//	// page.tmpl
+//	<template><Card><p>Hello, {{ .Name }}</p></Card></template>
+//
+// Children can't use variables declared outside the element.
+//
+// # Local templates
+//
+// You can also define and re-use templates locally within a component. For
+// locally defined templates only used within a single component, do not
+// prepend "./", e.g.:
+//
+//	// analytics.tmpl
+//	{{ define "local" }}<p>Local Template!</p>{{ end }}
+//	<template>
+//		<h1>Analytics</h1>
+//		{{ template "local" }}
+//	</template>
+//
+// # Styles
+//
+// A component's style may be scoped to the component with
+// <style scoped>. Each of its selectors is rewritten to match only the
+// component's top-level elements and their descendants, which are marked
+// with a data attribute unique to the component. Use :global(...) within a
+// scoped style to opt a selector out, e.g. ":global(body) { margin: 0; }".
+// When a component's styling boundary is an inner element rather than its
+// top-level elements, e.g. a wrapper following other markup, mark it
+// <div data-scope-root>. Only elements so marked are then scoped, and the
+// marker is removed.
+//
+// A style which only applies to some devices may declare its media
+// condition, e.g. <style media="(max-width: 600px)">. Inlined, it's wrapped
+// in an @media rule with the condition, and compiled to a file with
+// Options.ExternalAssets, it's linked with the media attribute, so browsers
+// may skip parsing it or defer loading it when the condition doesn't match.
+//
+// A page includes the styles of its components in dependency order, so a
+// component's style follows those of the components it includes. When two
+// otherwise unrelated components must cascade in a given order, declare it
+// with <style after="./base">, listing paths separated by spaces. The
+// constraint applies wherever both components are on the same page, and
+// contradicting the includes is an error.
+//
+// # Instances
+//
+// A scoped style is shared by every instance of its component. To theme
+// instances differently, mark the style <style scoped instance>. Each
+// rendered instance then has a unique ID, available within the <template>
+// as $instance, which also marks its top-level elements as
+// data-ci="{{ $instance }}". Write the shared style in terms of CSS custom
+// properties and set them per instance, e.g.:
+//
+//	// card.tmpl
+//	<style scoped instance>
+//		.card { color: var(--accent, black); }
+//	</style>
+//	<template>
+//		<style>[data-ci="{{ $instance }}"] { --accent: {{ .Accent }}; }</style>
+//		<div class="card">{{ .Title }}</div>
+//	</template>
+//
+// Templates defined by the component can't see the section's $instance, so
+// each has its own, and custom properties set on an instance are inherited
+// by its descendants regardless.
+//
+// # Extending
+//
+// A component may extend another with <template extends="./base">, taking
+// the base's markup and overriding any of the regions it marks with
+// {{ block }}. The extending component's template section may only define
+// the blocks it overrides, e.g.:
+//
+//	// base.tmpl
+//	<template>
+//		<h1>{{ block "title" . }}Untitled{{ end }}</h1>
+//		{{ block "body" . }}{{ end }}
+//	</template>
+//
+//	// about.tmpl
+//	<template extends="./base">
+//		{{ define "title" }}About{{ end }}
+//	</template>
+//
+// Blocks it doesn't override keep the base's content, and the base's
+// styles and scripts are included too. A component may extend one which
+// itself extends another, overriding blocks of either.
+//
+// A block is shorthand for defining a local template and including it, so
+// its name is namespaced like any other template the component defines,
+// e.g. "title" in base.tmpl becomes "base~title". Blocks may be nested,
+// including within other local templates, and each can be overridden by
+// extending. Including a component with {{ template }} renders its blocks'
+// defaults: a template of the same name defined by the including component
+// is its own local template, so it doesn't override them.
+//
+// # Data
+//
+// A component may declare the data fields it requires, e.g.
+// <template requires="Title Items">. See CheckData and RenderChecked.
+//
+// A component may prepare its own data before rendering, rather than every
+// caller doing so, by naming a function from the FuncMap to pass its data
+// through with <template setup="...">. The function's result becomes the
+// component's data, e.g.:
+//
+//	// user/card.tmpl, rendered with a *User
+//	<template setup="userCard">
+//		<p>{{ .DisplayName }}, member since {{ .Joined }}</p>
+//	</template>
+//
+// The setup may also be a pipeline taking the data as its last argument,
+// e.g. setup="userCard .Locale". Templates defined by the component receive
+// whatever data they're passed, as usual.
+//
+// # Variants
+//
+// Variants of a component needing different markup may live in the same
+// file as templates named "variant:" followed by the variant's name. Data
+// with a Variant key or field selects one, and data without renders the
+// component's markup as usual, e.g.:
+//
+//	// button.tmpl, rendered with {"Variant": "icon", ...}
+//	<template>
+//		{{ define "variant:icon" }}<button aria-label="{{ .Label }}">...</button>{{ end }}
+//		<button>{{ .Label }}</button>
+//	</template>
+//
+// Naming a variant the component doesn't define is an error.
+//
+// # Structured data
+//
+// A component may contribute structured data for search engines in a
+// <jsonld> section holding a JSON object, or an array of them, e.g. a
+// product component describing its product. The sections of a page's
+// components are merged into a single <script type="application/ld+json">
+// in its head, as the "@graph" of a schema.org document. Each section is
+// validated as JSON when compiled, treating template actions outputting a
+// value as null, so it may render data like "name": {{ .Name }}. Since the
+// sections are joined with commas, each must render a value whatever its
+// data, so compilation fails if one may render nothing, e.g. an if without
+// an else. Render an empty object instead, which adds nothing to the graph:
+//
+//	<jsonld>
+//		{{ if .Product }}{"@type": "Product", "name": {{ .Product.Name }}}{{ else }}{}{{ end }}
+//	</jsonld>
+package component
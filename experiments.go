@@ -0,0 +1,203 @@
+package component
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Experiments holds components compiled once for every combination of the
+// arms of their experiments, for A/B testing, e.g. rendering button.a.tmpl
+// wherever ./button is included for some requests and button.b.tmpl for
+// others. See CompileExperiments.
+type Experiments struct {
+	// arms maps each experiment, named like the component it replaces, to
+	// its sorted arms.
+	arms map[string][]string
+
+	// sets maps the key of each combination of arms to the template
+	// compiled with them.
+	sets map[string]*template.Template
+}
+
+// CompileExperiments is like CompileDir but treats components named with an
+// extra extension, e.g. button.a.tmpl and button.b.tmpl, as the arms "a" and
+// "b" of an experiment on the component button, which mustn't exist itself.
+// Every component includes "./button" as usual, and the arm rendered is
+// chosen per request with Experiments.Render.
+//
+// html/template resolves includes when templates are parsed, and templates
+// can't be changed once executed, so arms can't be swapped at render time.
+// Instead every combination of arms is compiled up front, each as its own
+// template with the chosen arms compiled as button, styles and scripts
+// included. Compilation time and memory grow with the product of the number
+// of arms of each experiment, so keep experiments few and end them by
+// renaming the winning arm.
+func CompileExperiments(
+	dirname string,
+	fns template.FuncMap,
+	opts ...Options,
+) (*Experiments, error) {
+	opt, err := getOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	opt = withFuncs(opt, fns)
+	comps, err := readDir(dirname, opt)
+	if err != nil {
+		return nil, err
+	}
+	if err := requireComponents(dirname, comps); err != nil {
+		return nil, err
+	}
+	e := &Experiments{
+		arms: experimentArms(comps),
+		sets: map[string]*template.Template{},
+	}
+	for _, choice := range e.combinations() {
+		t, _, err := compile(chooseArms(comps, choice), opt)
+		if err != nil {
+			return nil, errors.Wrapf(err, "arms %s", armsKey(choice))
+		}
+		e.sets[armsKey(choice)] = t
+	}
+	return e, nil
+}
+
+// experimentArms returns the arms of each experiment among comps, i.e. two
+// or more components whose names without their last extension are the same
+// and aren't a component themselves. A lone component like jquery.min isn't
+// an experiment.
+func experimentArms(comps []*component) map[string][]string {
+	known := make(map[string]bool, len(comps))
+	for _, c := range comps {
+		known[c.name] = true
+	}
+	arms := map[string][]string{}
+	for _, c := range comps {
+		ext := path.Ext(c.name)
+		base := strings.TrimSuffix(c.name, ext)
+		if ext == "" || ext == "." || known[base] || strings.HasSuffix(base, "/") {
+			continue
+		}
+		arms[base] = append(arms[base], ext[1:])
+	}
+	for exp, a := range arms {
+		if len(a) < 2 {
+			delete(arms, exp)
+			continue
+		}
+		sort.Strings(a)
+	}
+	return arms
+}
+
+// combinations returns every combination of arms, each mapping every
+// experiment to one of its arms.
+func (e *Experiments) combinations() []map[string]string {
+	combos := []map[string]string{{}}
+	for _, exp := range sortedKeys(e.arms) {
+		var next []map[string]string
+		for _, combo := range combos {
+			for _, arm := range e.arms[exp] {
+				choice := make(map[string]string, len(combo)+1)
+				for k, v := range combo {
+					choice[k] = v
+				}
+				choice[exp] = arm
+				next = append(next, choice)
+			}
+		}
+		combos = next
+	}
+	return combos
+}
+
+// chooseArms returns copies of comps with the chosen arm of each experiment
+// renamed to the experiment and the other arms left out.
+func chooseArms(comps []*component, choice map[string]string) []*component {
+	chosen := make([]*component, 0, len(comps))
+	for _, c := range comps {
+		ext := path.Ext(c.name)
+		base := strings.TrimSuffix(c.name, ext)
+		arm, ok := choice[base]
+		if ok && ext[1:] != arm {
+			continue
+		}
+		cp := c.clone()
+		if ok {
+			cp.name = base
+		}
+		chosen = append(chosen, cp)
+	}
+	return chosen
+}
+
+// armsKey identifies a combination of arms, e.g. "button=a,card=b".
+func armsKey(choice map[string]string) string {
+	exps := make([]string, 0, len(choice))
+	for exp := range choice {
+		exps = append(exps, exp)
+	}
+	sort.Strings(exps)
+	for i, exp := range exps {
+		exps[i] = exp + "=" + choice[exp]
+	}
+	return strings.Join(exps, ",")
+}
+
+// Arms returns the arms of each experiment, e.g. {"button": ["a", "b"]}.
+func (e *Experiments) Arms() map[string][]string {
+	arms := make(map[string][]string, len(e.arms))
+	for exp, a := range e.arms {
+		arms[exp] = append([]string(nil), a...)
+	}
+	return arms
+}
+
+// Template returns the template compiled with the chosen arm of each
+// experiment, e.g. {"button": "b"}. Experiments not chosen use their first
+// arm in sorted order. Choosing an experiment or arm which doesn't exist is
+// an error.
+func (e *Experiments) Template(choice map[string]string) (*template.Template, error) {
+	full := make(map[string]string, len(e.arms))
+	for exp, arms := range e.arms {
+		full[exp] = arms[0]
+	}
+	for exp, arm := range choice {
+		arms, ok := e.arms[exp]
+		if !ok {
+			return nil, fmt.Errorf("experiment %s doesn't exist", exp)
+		}
+		found := false
+		for _, a := range arms {
+			found = found || a == arm
+		}
+		if !found {
+			return nil, fmt.Errorf("experiment %s has no arm %q", exp, arm)
+		}
+		full[exp] = arm
+	}
+	return e.sets[armsKey(full)], nil
+}
+
+// Render renders the named page with data using the chosen arm of each
+// experiment, e.g. as assigned to the user making the request. See
+// Template.
+func (e *Experiments) Render(
+	w io.Writer,
+	name string,
+	choice map[string]string,
+	data interface{},
+) error {
+	t, err := e.Template(choice)
+	if err != nil {
+		return err
+	}
+	return t.ExecuteTemplate(w, name, data)
+}
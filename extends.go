@@ -0,0 +1,120 @@
+package component
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/template/parse"
+)
+
+// checkExtends fails if the template section of a component extending
+// another has markup besides the blocks it defines, which would be
+// discarded.
+func checkExtends(name string, tree *parse.Tree) error {
+	for _, n := range tree.Root.Nodes {
+		if tn, ok := n.(*parse.TextNode); ok && strings.TrimSpace(string(tn.Text)) == "" {
+			continue
+		}
+		return fmt.Errorf("%s extends another component, so its template section may only define blocks",
+			name)
+	}
+	return nil
+}
+
+// resolveExtends gives each component marked <template extends="..."> the
+// markup of the component it extends, with the blocks it defines overriding
+// those of the same name. Extending may be repeated, e.g. C extends B which
+// extends A, in which case the most derived definition of each block wins.
+//
+// Each extending component receives its own copy of the base's markup and
+// local templates, renamed into its namespace, so the base renders as
+// before.
+func (b *builder) resolveExtends() error {
+	// index the trees before any are replaced, so every component resolves
+	// against the original definitions
+	trees := make(map[string]*parse.Tree, len(b.trees))
+	for _, tree := range b.trees {
+		trees[tree.Name] = tree
+	}
+	names := make([]string, 0, len(b.extends))
+	for name := range b.extends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		chain := []string{name}
+		seen := map[string]bool{name: true}
+		for base, ok := b.extends[name]; ok; base, ok = b.extends[base] {
+			if seen[base] {
+				return fmt.Errorf("%s: extends cycle through %s", name, base)
+			}
+			seen[base] = true
+			chain = append(chain, base)
+		}
+		root := chain[len(chain)-1]
+		markup := trees[root+"#template"]
+		if markup == nil {
+			return fmt.Errorf("%s extends %s, which has no template section",
+				chain[len(chain)-2], root)
+		}
+
+		// find the component defining each local template, most derived
+		// first
+		owners := map[string]string{}
+		for i := len(chain) - 1; i >= 0; i-- {
+			prefix := chain[i] + "~"
+			for treeName := range trees {
+				if strings.HasPrefix(treeName, prefix) {
+					owners[strings.TrimPrefix(treeName, prefix)] = chain[i]
+				}
+			}
+		}
+		rename := func(tree *parse.Tree) {
+			tns := &tnodes{template: map[*parse.TemplateNode]string{}}
+			tns.checkListNode(tree.Root)
+			for tn, ref := range tns.template {
+				i := strings.Index(ref, "~")
+				if i >= 0 && seen[ref[:i]] {
+					tn.Name = name + ref[i:]
+				}
+			}
+		}
+		loc := b.meta.Sources[root+"#template"]
+		section := markup.Copy()
+		section.Name = name + "#template"
+		rename(section)
+		b.replaceTree(section, loc)
+		locals := make([]string, 0, len(owners))
+		for local := range owners {
+			locals = append(locals, local)
+		}
+		sort.Strings(locals)
+		for _, local := range locals {
+			owner := owners[local]
+			tree := trees[owner+"~"+local]
+			if owner != name {
+				tree = tree.Copy()
+				tree.Name = name + "~" + local
+			}
+			rename(tree)
+			b.replaceTree(tree, b.meta.Sources[owner+"~"+local])
+		}
+	}
+	return nil
+}
+
+// replaceTree adds a markup tree generated while compiling, replacing any of
+// the same name.
+func (b *builder) replaceTree(tree *parse.Tree, loc SourceLocation) {
+	b.defined[tree.Name] = true
+	b.allNames[tree.Name] = true
+	b.meta.Sources[tree.Name] = loc
+	for i, t := range b.trees {
+		if t.Name == tree.Name {
+			b.trees[i] = tree
+			return
+		}
+	}
+	b.trees = append(b.trees, tree)
+	b.markup = append(b.markup, tree)
+}
@@ -0,0 +1,92 @@
+package component
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExtends(t *testing.T) {
+	src := map[string]string{
+		"base": `<style>.base { margin: 0; }</style>
+<template><h1>{{ block "title" . }}Untitled{{ end }}</h1><main>{{ block "body" . }}empty{{ end }}</main></template>`,
+		"about": `<template extends="./base">{{ define "title" }}About {{ .Name }}{{ end }}</template>`,
+		"team":  `<style>.team { margin: 0; }</style><template extends="./about">{{ define "body" }}Team{{ end }}</template>`,
+	}
+	tmpl, _ := compileMap(t, Options{}, src)
+	data := map[string]string{"Name": "us"}
+	for name, want := range map[string]string{
+		"base":  "<h1>Untitled</h1><main>empty</main>",
+		"about": "<h1>About us</h1><main>empty</main>",
+		"team":  "<h1>About us</h1><main>Team</main>",
+	} {
+		if got := render(t, tmpl, name+"#template", data); got != want {
+			t.Errorf("%s: got %s, want %s", name, got, want)
+		}
+	}
+	page := render(t, tmpl, "team", data)
+	if i, j := strings.Index(page, ".base"), strings.Index(page, ".team"); i < 0 || j < i {
+		t.Errorf("base style missing or after the extending component's:\n%s", page)
+	}
+}
+
+func TestExtendsErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		src  map[string]string
+		want string
+	}{{
+		name: "markup besides blocks",
+		src: map[string]string{
+			"base": `<template>{{ block "t" . }}{{ end }}</template>`,
+			"x":    `<template extends="./base"><p>stray</p>{{ define "t" }}{{ end }}</template>`,
+		},
+		want: "may only define blocks",
+	}, {
+		name: "missing base",
+		src:  map[string]string{"x": `<template extends="./missing"></template>`},
+		want: "missing",
+	}, {
+		name: "cycle",
+		src: map[string]string{
+			"a": `<template extends="./b"></template>`,
+			"b": `<template extends="./a"></template>`,
+		},
+		want: "cycle",
+	}} {
+		srcs := map[string][]byte{}
+		for name, s := range tc.src {
+			srcs[name] = []byte(s)
+		}
+		_, _, err := NewCompiler(Options{}).Map(srcs)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: err = %v, want %q", tc.name, err, tc.want)
+		}
+	}
+}
+
+func TestBlockNamespacing(t *testing.T) {
+	src := map[string]string{
+		"base": `<template><h1>{{ block "title" . }}Untitled{{ end }}</h1>` +
+			`{{ define "wrap" }}<div>{{ block "inner" . }}default{{ end }}</div>{{ end }}{{ template "wrap" . }}</template>`,
+		// including base doesn't override its blocks, since title here is
+		// page's own local template
+		"page": `<template>{{ define "title" }}Mine{{ end }}{{ template "./base" . }}|{{ template "title" }}</template>`,
+		"ext":  `<template extends="./base">{{ define "inner" }}nested{{ end }}</template>`,
+	}
+	tmpl, _ := compileMap(t, Options{}, src)
+	for _, name := range []string{"base~title", "base~inner", "page~title"} {
+		if tmpl.Lookup(name) == nil {
+			t.Errorf("%s not defined", name)
+		}
+	}
+	if tmpl.Lookup("title") != nil {
+		t.Error("block defined outside its component's namespace")
+	}
+	if got, want := render(t, tmpl, "page#template", nil), "<h1>Untitled</h1><div>default</div>|Mine"; got != want {
+		t.Errorf("page %s, want %s", got, want)
+	}
+	// a block nested within a local template is overridden by extending
+	if got, want := render(t, tmpl, "ext#template", nil), "<h1>Untitled</h1><div>nested</div>"; got != want {
+		t.Errorf("ext %s, want %s", got, want)
+	}
+}
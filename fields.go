@@ -0,0 +1,101 @@
+package component
+
+import (
+	"sort"
+	"strings"
+	"text/template/parse"
+)
+
+// dataFields returns the fields of its data a template section uses, sorted,
+// e.g. "Title" for {{ .Title }} and "User.Name" for {{ .User.Name }}. Fields
+// used within {{ with .User }} are relative to the user, e.g. "User.Name"
+// for {{ .Name }}, and within {{ range .Items }} to each item, e.g.
+// "Items[].Name". Fields of values which aren't fields themselves, e.g. the
+// result of a function, are skipped, as are those of local templates, which
+// may be passed any data.
+func dataFields(tree *parse.Tree) []string {
+	w := fieldWalker{}
+	w.list(tree.Root, "", true)
+	fields := make([]string, 0, len(w))
+	for f := range w {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// fieldWalker records the data fields used by the nodes it walks. Each
+// walk is given the field dot is within, e.g. "User." within
+// {{ with .User }}, and whether it's known.
+type fieldWalker map[string]bool
+
+func (w fieldWalker) list(ln *parse.ListNode, dot string, known bool) {
+	if ln == nil {
+		return
+	}
+	for _, n := range ln.Nodes {
+		w.node(n, dot, known)
+	}
+}
+
+func (w fieldWalker) node(n parse.Node, dot string, known bool) {
+	switch n := n.(type) {
+	case *parse.ActionNode:
+		w.pipe(n.Pipe, dot, known)
+	case *parse.IfNode:
+		w.pipe(n.Pipe, dot, known)
+		w.list(n.List, dot, known)
+		w.list(n.ElseList, dot, known)
+	case *parse.WithNode:
+		w.pipe(n.Pipe, dot, known)
+		field, ok := pipeField(n.Pipe)
+		w.list(n.List, dot+field+".", known && ok)
+		w.list(n.ElseList, dot, known)
+	case *parse.RangeNode:
+		w.pipe(n.Pipe, dot, known)
+		field, ok := pipeField(n.Pipe)
+		w.list(n.List, dot+field+"[].", known && ok)
+		w.list(n.ElseList, dot, known)
+	case *parse.TemplateNode:
+		w.pipe(n.Pipe, dot, known)
+	case *parse.PipeNode:
+		w.pipe(n, dot, known)
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			w.node(arg, dot, known)
+		}
+	case *parse.ChainNode:
+		w.node(n.Node, dot, known)
+	case *parse.FieldNode:
+		if known {
+			w[dot+strings.Join(n.Ident, ".")] = true
+		}
+	case *parse.VariableNode:
+		// $ is the data the template was executed with
+		if n.Ident[0] == "$" && len(n.Ident) > 1 {
+			w[strings.Join(n.Ident[1:], ".")] = true
+		}
+	}
+}
+
+func (w fieldWalker) pipe(pn *parse.PipeNode, dot string, known bool) {
+	if pn == nil {
+		return
+	}
+	for _, cmd := range pn.Cmds {
+		w.node(cmd, dot, known)
+	}
+}
+
+// pipeField returns the field a pipeline evaluates to, if it's a field of
+// dot alone, e.g. "User" for .User.
+func pipeField(pn *parse.PipeNode) (string, bool) {
+	if pn == nil || len(pn.Cmds) != 1 || len(pn.Cmds[0].Args) != 1 {
+		return "", false
+	}
+	f, ok := pn.Cmds[0].Args[0].(*parse.FieldNode)
+	if !ok {
+		return "", false
+	}
+	return strings.Join(f.Ident, "."), true
+}
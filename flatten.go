@@ -0,0 +1,158 @@
+package component
+
+import (
+	"html/template"
+	"text/template/parse"
+
+	"github.com/pkg/errors"
+)
+
+// maxFlattenDepth limits how deeply Options.FlattenIncludes expands nested
+// includes. Includes nested deeper are left as they are.
+const maxFlattenDepth = 100
+
+// flattener expands includes into copies of the templates they include. See
+// Options.FlattenIncludes.
+type flattener struct {
+	all *template.Template
+
+	// done maps the templates already flattened to their flattened
+	// bodies, and active holds those being flattened, whose includes
+	// within themselves are recursive and left as they are.
+	done   map[string]*parse.ListNode
+	active map[string]bool
+
+	// scope is an empty {{ if true }} for scoping the variables declared
+	// by an inlined body, copied for each use.
+	scope *parse.IfNode
+}
+
+// flattenIncludes replaces each {{ template }} include in the set passing
+// its own data, e.g. {{ template "./card" . }}, with a copy of the included
+// template's body, so rendering a page needn't look up its components.
+// Includes passing other data, recursive includes, and includes of
+// templates using $ are left as they are, since inlining them would change
+// what the included template sees. Calls to the include function name
+// their template at render time, so they're never flattened.
+func flattenIncludes(all *template.Template) error {
+	scope, err := parse.Parse("flatten", "{{if true}}{{end}}", "", "", nil)
+	if err != nil {
+		return errors.Wrap(err, "flatten")
+	}
+	f := &flattener{
+		all:    all,
+		done:   map[string]*parse.ListNode{},
+		active: map[string]bool{},
+		scope:  scope["flatten"].Root.Nodes[0].(*parse.IfNode),
+	}
+	for _, t := range Templates(all) {
+		if t.Tree != nil {
+			f.flatten(t.Tree)
+		}
+	}
+	return nil
+}
+
+// flatten expands the includes within tree, returning its flattened body.
+func (f *flattener) flatten(tree *parse.Tree) *parse.ListNode {
+	if body, ok := f.done[tree.Name]; ok {
+		return body
+	}
+	f.active[tree.Name] = true
+	defer delete(f.active, tree.Name)
+	// the callback never fails
+	_ = rewriteList(tree.Root, func(n parse.Node) (parse.Node, error) {
+		tn, ok := n.(*parse.TemplateNode)
+		if !ok || !isDotPipe(tn.Pipe) || f.active[tn.Name] || len(f.active) > maxFlattenDepth {
+			return n, nil
+		}
+		included := f.all.Lookup(tn.Name)
+		if included == nil || included.Tree == nil {
+			return n, nil
+		}
+		body := f.flatten(included.Tree)
+		if usesRoot(body) {
+			// $ is the included template's data, which differs from the
+			// including template's $ within ranges and withs
+			return n, nil
+		}
+		inlined := body.CopyList()
+		if !declaresVars(inlined) {
+			return inlined, nil
+		}
+		// variables declared by the body mustn't outlive it
+		scope := f.scope.Copy().(*parse.IfNode)
+		scope.List = inlined
+		return scope, nil
+	})
+	f.done[tree.Name] = tree.Root
+	return tree.Root
+}
+
+// isDotPipe reports whether a pipeline is only ".".
+func isDotPipe(pipe *parse.PipeNode) bool {
+	if pipe == nil || len(pipe.Decl) > 0 || len(pipe.Cmds) != 1 ||
+		len(pipe.Cmds[0].Args) != 1 {
+		return false
+	}
+	_, ok := pipe.Cmds[0].Args[0].(*parse.DotNode)
+	return ok
+}
+
+// declaresVars reports whether a list declares variables outside any
+// control structure, i.e. those visible after it.
+func declaresVars(ln *parse.ListNode) bool {
+	for _, n := range ln.Nodes {
+		if a, ok := n.(*parse.ActionNode); ok && len(a.Pipe.Decl) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// usesRoot reports whether a node refers to $ anywhere within it.
+func usesRoot(n parse.Node) bool {
+	switch t := n.(type) {
+	case *parse.ListNode:
+		if t == nil {
+			return false
+		}
+		for _, n := range t.Nodes {
+			if usesRoot(n) {
+				return true
+			}
+		}
+	case *parse.ActionNode:
+		return usesRoot(t.Pipe)
+	case *parse.IfNode:
+		return usesRoot(&t.BranchNode)
+	case *parse.RangeNode:
+		return usesRoot(&t.BranchNode)
+	case *parse.WithNode:
+		return usesRoot(&t.BranchNode)
+	case *parse.BranchNode:
+		return usesRoot(t.Pipe) || usesRoot(t.List) || usesRoot(t.ElseList)
+	case *parse.TemplateNode:
+		return usesRoot(t.Pipe)
+	case *parse.PipeNode:
+		if t == nil {
+			return false
+		}
+		for _, c := range t.Cmds {
+			if usesRoot(c) {
+				return true
+			}
+		}
+	case *parse.CommandNode:
+		for _, arg := range t.Args {
+			if usesRoot(arg) {
+				return true
+			}
+		}
+	case *parse.ChainNode:
+		return usesRoot(t.Node)
+	case *parse.VariableNode:
+		return t.Ident[0] == "$"
+	}
+	return false
+}
@@ -0,0 +1,43 @@
+package component
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFlattenIncludes(t *testing.T) {
+	src := map[string]string{
+		"card": `<template><div>{{ .Title }}{{ template "./icon" . }}</div></template>`,
+		"icon": `<template><i>{{ .Icon }}</i></template>`,
+		"root": `<template>{{ $.Title }}</template>`,
+		"tree": `<template>{{ define "node" }}{{ .Name }}{{ range .Kids }}{{ template "node" . }}{{ end }}{{ end }}` +
+			`{{ template "node" . }}</template>`,
+		"other": `<template>{{ . }}</template>`,
+		"page": `<template>{{ template "./card" . }}|{{ template "./other" .Title }}|` +
+			`{{ template "./root" . }}|{{ template "./tree" .Tree }}|{{ include "./icon" . }}</template>`,
+	}
+	data := map[string]interface{}{
+		"Title": "t",
+		"Icon":  "i",
+		"Tree": map[string]interface{}{
+			"Name": "a",
+			"Kids": []map[string]interface{}{{"Name": "b"}},
+		},
+	}
+	plain, _ := compileMap(t, Options{}, src)
+	flat, _ := compileMap(t, Options{FlattenIncludes: true}, src)
+	want := render(t, plain, "page", data)
+	if got := render(t, flat, "page", data); got != want {
+		t.Errorf("flattened page:\n%s\nwant:\n%s", got, want)
+	}
+	// card and the icon it includes are expanded, but not includes
+	// passing other data or using $, nor the include function's
+	got := strings.Join(templateRefs(flat.Lookup("page#template")), " ")
+	if want := "icon#template other#template root#template tree#template"; got != want {
+		t.Errorf("page includes %s, want %s", got, want)
+	}
+	// a recursive local template can't be expanded into itself
+	if got := templateRefs(flat.Lookup("tree~node")); len(got) != 1 || got[0] != "tree~node" {
+		t.Errorf("tree~node includes %v, want itself", got)
+	}
+}
@@ -0,0 +1,48 @@
+package component
+
+import (
+	"fmt"
+	"html/template"
+	"sort"
+	"strings"
+)
+
+// MergeFuncs combines function libraries into one FuncMap to pass to
+// CompileDir, failing if more than one defines a function of the same name
+// rather than letting the last silently win. Namespace libraries with
+// NamespaceFuncs first to combine those whose names collide.
+func MergeFuncs(libs ...template.FuncMap) (template.FuncMap, error) {
+	merged := template.FuncMap{}
+	var dups []string
+	for _, lib := range libs {
+		for name, fn := range lib {
+			if _, ok := merged[name]; ok {
+				dups = append(dups, name)
+				continue
+			}
+			merged[name] = fn
+		}
+	}
+	if len(dups) > 0 {
+		sort.Strings(dups)
+		return nil, fmt.Errorf("functions defined more than once: %s",
+			strings.Join(dups, ", "))
+	}
+	return merged, nil
+}
+
+// NamespaceFuncs returns a copy of a function library with each name
+// prefixed by prefix and an underscore, e.g. fmt becomes a_fmt with prefix
+// "a", for merging with MergeFuncs. Templates call the prefixed names.
+//
+// Template function names can't contain dots, so a.fmt isn't possible: the
+// parser reads it as the field fmt of the result of a function a. Prefix
+// must be a valid function name itself, i.e. letters, digits, and
+// underscores not beginning with a digit.
+func NamespaceFuncs(prefix string, fns template.FuncMap) template.FuncMap {
+	namespaced := make(template.FuncMap, len(fns))
+	for name, fn := range fns {
+		namespaced[prefix+"_"+name] = fn
+	}
+	return namespaced
+}
@@ -1,6 +1,6 @@
 module egt.run/component
 
-go 1.14
+go 1.16
 
 require (
 	github.com/pkg/errors v0.9.1
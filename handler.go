@@ -0,0 +1,160 @@
+package component
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"net/http"
+)
+
+// Handler serves components over HTTP. Navigations get the full page, while
+// requests for a fragment, such as those made by HTMX, get only the
+// component's markup: no document wrapper, and none of the styles and
+// scripts of the component or those it includes. Adopting HTMX then needs
+// no changes to the handlers themselves, e.g.
+//
+//	http.Handle("/todos", &component.Handler{
+//		Template: t,
+//		Route: func(r *http.Request) (string, interface{}, error) {
+//			return "todos", loadTodos(r), nil
+//		},
+//	})
+//
+// The handler can't know which assets the page requesting a fragment has
+// loaded, so fragments never include any. The page must load the assets of
+// every component it may swap in itself, e.g. by including the components
+// somewhere in its markup.
+//
+// Since the response depends on request headers, Handler sets a Vary header
+// naming those checked by the default IsFragment, so caches keep the two
+// responses apart. A custom IsFragment inspecting other headers should be
+// paired with a custom Vary.
+type Handler struct {
+	// Template holds the compiled components.
+	Template *template.Template
+
+	// Route returns the component to render for a request and the data to
+	// render it with. An empty name responds with 404 Not Found.
+	Route func(r *http.Request) (name string, data interface{}, err error)
+
+	// IsFragment reports whether to render only the component's markup.
+	// It defaults to IsFragmentRequest.
+	IsFragment func(r *http.Request) bool
+
+	// Vary is sent as the Vary header. It defaults to the headers checked
+	// by IsFragmentRequest.
+	Vary string
+
+	// MaxBytes aborts rendering once the output exceeds this many bytes,
+	// e.g. when a range runs over far more data than expected, failing
+	// with an *OutputLimitError rather than exhausting memory. Zero
+	// allows any size.
+	MaxBytes int64
+
+	// Error responds to errors returned by Route or rendering, e.g. to
+	// log them. It defaults to responding with 500 Internal Server Error,
+	// without revealing the error to the client.
+	Error func(w http.ResponseWriter, r *http.Request, err error)
+}
+
+// fragmentVary lists the headers checked by IsFragmentRequest.
+const fragmentVary = "HX-Request, HX-History-Restore-Request, X-Requested-With"
+
+// IsFragmentRequest reports whether a request asks for a fragment of a page
+// rather than the whole document, using these heuristics:
+//
+//   - "HX-Request: true" is sent by HTMX for requests it swaps into the
+//     current page, unless "HX-History-Restore-Request: true" is also sent,
+//     which HTMX uses to restore a page missing from its history cache and
+//     so needs the whole document.
+//   - "X-Requested-With: XMLHttpRequest" is sent by jQuery and other
+//     libraries for requests made by scripts.
+//
+// Anything else, including a plain navigation, gets the whole document.
+func IsFragmentRequest(r *http.Request) bool {
+	if r.Header.Get("HX-Request") == "true" {
+		return r.Header.Get("HX-History-Restore-Request") != "true"
+	}
+	return r.Header.Get("X-Requested-With") == "XMLHttpRequest"
+}
+
+// ServeHTTP renders the component returned by Route, either as a full page
+// or as a fragment. Output is buffered so a failed render sends only the
+// error response, never a partial page.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	vary := h.Vary
+	if vary == "" {
+		vary = fragmentVary
+	}
+	w.Header().Add("Vary", vary)
+
+	name, data, err := h.Route(r)
+	if err != nil {
+		h.fail(w, r, err)
+		return
+	}
+	if name == "" {
+		http.NotFound(w, r)
+		return
+	}
+	isFragment := h.IsFragment
+	if isFragment == nil {
+		isFragment = IsFragmentRequest
+	}
+	var buf bytes.Buffer
+	if isFragment(r) && h.Template.Lookup(name+"#template") != nil {
+		// render only the markup, like RenderHTML
+		name += "#template"
+	}
+	if h.MaxBytes > 0 {
+		err = h.Template.ExecuteTemplate(&limitWriter{w: &buf, limit: h.MaxBytes}, name, data)
+	} else {
+		err = h.Template.ExecuteTemplate(&buf, name, data)
+	}
+	if err != nil {
+		h.fail(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = buf.WriteTo(w)
+}
+
+// OutputLimitError is returned when rendering is aborted for exceeding
+// Handler.MaxBytes. Since it's the error of a write, templates wrap it, so
+// check for it with errors.As.
+type OutputLimitError struct {
+	// Limit is the maximum size of the output.
+	Limit int64
+
+	// Written is the size of the output when rendering was aborted,
+	// including the write which exceeded the limit.
+	Written int64
+}
+
+func (e *OutputLimitError) Error() string {
+	return fmt.Sprintf("output of %d bytes exceeds the limit of %d", e.Written, e.Limit)
+}
+
+// limitWriter fails writes once more than limit bytes have been written.
+type limitWriter struct {
+	w       *bytes.Buffer
+	limit   int64
+	written int64
+}
+
+func (lw *limitWriter) Write(p []byte) (int, error) {
+	lw.written += int64(len(p))
+	if lw.written > lw.limit {
+		return 0, &OutputLimitError{Limit: lw.limit, Written: lw.written}
+	}
+	return lw.w.Write(p)
+}
+
+func (h *Handler) fail(w http.ResponseWriter, r *http.Request, err error) {
+	if h.Error != nil {
+		h.Error(w, r, err)
+		return
+	}
+	http.Error(w, http.StatusText(http.StatusInternalServerError),
+		http.StatusInternalServerError)
+}
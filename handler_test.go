@@ -0,0 +1,113 @@
+package component
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	src := map[string]string{
+		"card": `<style>.card { color: red; }</style>
+<template><div class="card">{{ . }}</div></template>`,
+		"todos": `<style>.todos { margin: 0; }</style>
+<template><ul class="todos">{{ template "./card" . }}</ul></template>`,
+	}
+	tmpl, _ := compileMap(t, Options{}, src)
+	h := &Handler{
+		Template: tmpl,
+		Route: func(r *http.Request) (string, interface{}, error) {
+			switch r.URL.Path {
+			case "/todos":
+				return "todos", "buy milk", nil
+			case "/fail":
+				return "", nil, errors.New("failed")
+			}
+			return "", nil, nil
+		},
+	}
+	serve := func(path string, headers map[string]string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", path, nil)
+		for k, v := range headers {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+	fragment := `<ul class="todos"><div class="card">buy milk</div></ul>`
+
+	w := serve("/todos", nil)
+	if body := w.Body.String(); !strings.HasPrefix(body, "<!DOCTYPE html>") ||
+		!strings.Contains(body, ".card { color: red; }") || !strings.Contains(body, fragment) {
+		t.Errorf("navigation got:\n%s\nwant the whole page", body)
+	}
+	if vary := w.Header().Get("Vary"); vary != fragmentVary {
+		t.Errorf("Vary = %q, want %q", vary, fragmentVary)
+	}
+	for _, headers := range []map[string]string{
+		{"HX-Request": "true"},
+		{"X-Requested-With": "XMLHttpRequest"},
+	} {
+		// fragments have none of the page's assets, even those of
+		// components the requesting page may not have loaded
+		if body := serve("/todos", headers).Body.String(); body != fragment {
+			t.Errorf("%v got %q, want %q", headers, body, fragment)
+		}
+	}
+	restore := map[string]string{"HX-Request": "true", "HX-History-Restore-Request": "true"}
+	if body := serve("/todos", restore).Body.String(); !strings.HasPrefix(body, "<!DOCTYPE html>") {
+		t.Errorf("history restore got:\n%s\nwant the whole page", body)
+	}
+	if w := serve("/missing", nil); w.Code != http.StatusNotFound {
+		t.Errorf("missing page responded %d", w.Code)
+	}
+	if w := serve("/fail", nil); w.Code != http.StatusInternalServerError ||
+		strings.Contains(w.Body.String(), "failed") {
+		t.Errorf("failed route responded %d: %q", w.Code, w.Body.String())
+	}
+}
+
+func TestHandlerMaxBytes(t *testing.T) {
+	tmpl, _ := compileMap(t, Options{}, map[string]string{
+		"list": `<template><ul>{{ range . }}<li>{{ . }}</li>{{ end }}</ul></template>`,
+	})
+	var items []int
+	var failed error
+	h := &Handler{
+		Template: tmpl,
+		Route: func(r *http.Request) (string, interface{}, error) {
+			return "list", items, nil
+		},
+		MaxBytes: 200,
+		Error: func(w http.ResponseWriter, r *http.Request, err error) {
+			failed = err
+			w.WriteHeader(http.StatusServiceUnavailable)
+		},
+	}
+	serve := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		return w
+	}
+
+	items = []int{1, 2}
+	if w := serve(); failed != nil || !strings.Contains(w.Body.String(), "<li>2</li>") {
+		t.Fatalf("small page: err = %v, body:\n%s", failed, w.Body)
+	}
+
+	items = make([]int, 1000)
+	w := serve()
+	var limitErr *OutputLimitError
+	if !errors.As(failed, &limitErr) || limitErr.Limit != 200 || limitErr.Written <= 200 {
+		t.Fatalf("err = %v, want an *OutputLimitError over 200 bytes", failed)
+	}
+	if w.Code != http.StatusServiceUnavailable || w.Body.Len() != 0 {
+		t.Errorf("got %d with %d bytes, want only the error response", w.Code, w.Body.Len())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "" {
+		t.Errorf("Content-Type %q set for a failed render", ct)
+	}
+}
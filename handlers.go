@@ -0,0 +1,107 @@
+package component
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// handlerAttr marks the elements whose inline event handlers were moved into
+// their component's script. See Options.ExtractInlineHandlers.
+const handlerAttr = "data-c-handler"
+
+// extractHandlers moves the inline event handler attributes of template
+// section markup, e.g. onclick="...", into script which binds them with
+// addEventListener. Each element with handlers is marked with a generated
+// handlerAttr instead.
+//
+// Handlers are bound once on the document and delegated to the marked
+// elements, so they work for elements rendered at any time, such as in
+// fragments added to the page later. As with inline handlers, this is the
+// element and event the event, returning false prevents the default action,
+// and handlers of events which bubble also run for events on descendants.
+func extractHandlers(name string, src []byte) ([]byte, []byte, error) {
+	toks, err := tokenizeMarkup(src)
+	if err != nil {
+		return nil, nil, err
+	}
+	masked := maskActions(src)
+	var out, script bytes.Buffer
+	last, n := 0, 0
+	for _, t := range toks {
+		if t.Type != html.StartTagToken && t.Type != html.SelfClosingTagToken {
+			continue
+		}
+		tag := src[t.start:t.end]
+		var handlers []tagAttr
+		for _, a := range scanAttrs(masked[t.start:t.end], tag) {
+			if isHandlerAttr(a.name) {
+				handlers = append(handlers, a)
+			}
+		}
+		if len(handlers) == 0 {
+			continue
+		}
+		id := scopeID(name) + "-" + strconv.Itoa(n)
+		n++
+		// mark the element directly after the tag name, then copy the tag
+		// without its handlers
+		i := 1 + len(t.Data)
+		out.Write(src[last : t.start+i])
+		out.WriteString(" " + handlerAttr + `="` + id + `"`)
+		for _, a := range handlers {
+			if strings.Contains(a.value, "{{") {
+				return nil, nil, fmt.Errorf(
+					"<%s %s> uses actions, so it can't be moved into the script",
+					t.Data, a.name)
+			}
+			out.Write(bytes.TrimRight(tag[i:a.start], spaceChars))
+			i = a.end
+			bindHandler(&script, id, a.name[2:], html.UnescapeString(a.value))
+		}
+		out.Write(tag[i:])
+		last = t.end
+	}
+	out.Write(src[last:])
+	return out.Bytes(), script.Bytes(), nil
+}
+
+// isHandlerAttr reports whether an attribute is an inline event handler,
+// e.g. "onclick".
+func isHandlerAttr(name string) bool {
+	if len(name) <= 2 || !strings.HasPrefix(name, "on") {
+		return false
+	}
+	for _, r := range name[2:] {
+		if r < 'a' || r > 'z' {
+			return false
+		}
+	}
+	return true
+}
+
+// bindHandler writes script binding a handler of the given event to the
+// elements marked with id.
+func bindHandler(w *bytes.Buffer, id, event, code string) {
+	// the code can't end the script element it's moved into
+	code = strings.ReplaceAll(code, "</", `<\/`)
+	fmt.Fprintf(w, `(function () {
+	function handler(event) {
+		%s
+	}
+	document.addEventListener(%q, function (event) {
+		for (var el = event.target; el && el.nodeType === 1; el = el.parentElement) {
+			if (el.getAttribute(%q) === %q && handler.call(el, event) === false) {
+				event.preventDefault();
+			}
+			if (!event.bubbles) {
+				break;
+			}
+		}
+	}, true);
+})();
+`, code, event, handlerAttr, id)
+}
@@ -0,0 +1,51 @@
+package component
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExtractHandlers(t *testing.T) {
+	const src = `<button onclick="go(1 &amp;&amp; 2)" class="b">x</button>` +
+		`<a href="#" onmouseover='say("</script>"); return false'>y</a><p onclick-x="no">z</p>`
+	markup, script, err := extractHandlers("btn", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := scopeID("btn")
+	want := `<button data-c-handler="` + id + `-0" class="b">x</button>` +
+		`<a data-c-handler="` + id + `-1" href="#">y</a><p onclick-x="no">z</p>`
+	if string(markup) != want {
+		t.Errorf("markup:\n%s\nwant:\n%s", markup, want)
+	}
+	for _, want := range []string{
+		"go(1 && 2)",
+		`say("<\/script>"); return false`,
+		`document.addEventListener("click"`,
+		`document.addEventListener("mouseover"`,
+		`=== "` + id + `-1"`,
+	} {
+		if !strings.Contains(string(script), want) {
+			t.Errorf("script missing %s:\n%s", want, script)
+		}
+	}
+
+	if _, _, err := extractHandlers("x", []byte(`<b onclick="f({{ .X }})">x</b>`)); err == nil {
+		t.Error("handler with actions: want error")
+	}
+}
+
+func TestExtractInlineHandlers(t *testing.T) {
+	src := map[string]string{
+		"btn":  `<script>function go() {}</script><template><button onclick="go()">x</button></template>`,
+		"page": `<template>{{ template "./btn" }}</template>`,
+	}
+	tmpl, _ := compileMap(t, Options{ExtractInlineHandlers: true}, src)
+	page := render(t, tmpl, "page", nil)
+	if strings.Contains(page, "onclick=") || !strings.Contains(page, handlerAttr+`="`) {
+		t.Errorf("handler not extracted:\n%s", page)
+	}
+	if i, j := strings.Index(page, "function go()"), strings.Index(page, "handler.call"); i < 0 || j < i {
+		t.Errorf("handler not bound after the component's script:\n%s", page)
+	}
+}
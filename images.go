@@ -0,0 +1,77 @@
+package component
+
+import (
+	"encoding/base64"
+	"io/fs"
+	"mime"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// cssURLRE matches url() references in CSS, capturing the quote, if any, and
+// the URL.
+var cssURLRE = regexp.MustCompile(`url\(\s*(["']?)([^"')\s]+)(["']?)\s*\)`)
+
+// inlineImages replaces images referenced by relative URLs in a component's
+// style with data URIs when they're smaller than limit bytes. See
+// Options.InlineImagesBelow.
+func inlineImages(c *component, limit int64) ([]byte, error) {
+	var err error
+	out := cssURLRE.ReplaceAllFunc(c.sections["style"], func(m []byte) []byte {
+		sub := cssURLRE.FindSubmatch(m)
+		if err != nil || string(sub[1]) != string(sub[3]) {
+			return m
+		}
+		uri, ok, ierr := imageURI(c, string(sub[2]), limit)
+		if ierr != nil {
+			err = ierr
+		}
+		if !ok {
+			return m
+		}
+		return []byte("url(" + strconv.Quote(uri) + ")")
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// imageURI returns the data URI of the image a component refers to by ref,
+// reporting false if it's not a relative reference to an image smaller than
+// limit bytes.
+func imageURI(c *component, ref string, limit int64) (string, bool, error) {
+	if strings.HasPrefix(ref, "/") || strings.ContainsAny(ref, ":?#{}") {
+		return "", false, nil
+	}
+	name := path.Join(path.Dir(c.path), ref)
+	if !fs.ValidPath(name) {
+		return "", false, nil
+	}
+	typ := mime.TypeByExtension(path.Ext(name))
+	if i := strings.IndexByte(typ, ';'); i >= 0 {
+		typ = typ[:i]
+	}
+	if !strings.HasPrefix(typ, "image/") {
+		return "", false, nil
+	}
+	fi, err := fs.Stat(c.fsys, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, errors.Wrap(err, "stat")
+	}
+	if fi.IsDir() || fi.Size() >= limit {
+		return "", false, nil
+	}
+	data, err := fs.ReadFile(c.fsys, name)
+	if err != nil {
+		return "", false, errors.Wrap(err, "read image")
+	}
+	return "data:" + typ + ";base64," + base64.StdEncoding.EncodeToString(data), true, nil
+}
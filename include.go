@@ -0,0 +1,66 @@
+package component
+
+import (
+	"fmt"
+	"html/template"
+	"strconv"
+	"text/template/parse"
+)
+
+// includeFunc is the name of the template function which calls to include
+// are renamed to, so Coverage can instrument them without affecting a
+// user's own include function.
+const includeFunc = "componentInclude"
+
+// include renders the named template with data for the include function,
+// e.g. {{ $card := include "./card" . }}. Its name has already been resolved
+// by resolveIncludes.
+func (b *builder) include(name string, data ...interface{}) (template.HTML, error) {
+	if len(data) > 1 {
+		return "", fmt.Errorf("include of %s takes at most one argument",
+			displayName(name))
+	}
+	var d interface{}
+	if len(data) == 1 {
+		d = data[0]
+	}
+	return b.slot(name, d)
+}
+
+// resolveIncludes resolves the names passed to calls to include within a
+// compiled section like compileSection does those of template actions, so
+// a component included as a function is found from the including component
+// and has its styles and scripts added to pages like any other. The name
+// must be a string literal for this reason.
+func (b *builder) resolveIncludes(
+	name, section string,
+	t *template.Template,
+	deps map[string]bool,
+) error {
+	for _, tt := range t.Templates() {
+		for _, cn := range getTemplateNodes(tt).include {
+			if len(cn.Args) < 2 {
+				return fmt.Errorf("%s: include needs the path of a component",
+					displayName(tt.Tree.Name))
+			}
+			sn, ok := cn.Args[1].(*parse.StringNode)
+			if !ok {
+				return fmt.Errorf("%s: include needs a quoted path like \"./card\", not %s",
+					displayName(tt.Tree.Name), cn.Args[1])
+			}
+			ref, local := ResolveRef(name, sn.Text)
+			if local {
+				ref = name + "~" + ref
+			} else {
+				if section == "template" {
+					deps[ref] = true
+				}
+				ref += "#template"
+			}
+			b.refs[name][ref] = true
+			sn.Text, sn.Quoted = ref, strconv.Quote(ref)
+			cn.Args[0].(*parse.IdentifierNode).Ident = includeFunc
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package component
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"strings"
+	"text/template/parse"
+
+	"github.com/pkg/errors"
+)
+
+// inlineStatic replaces includes of pure components having constant
+// arguments with the component's output. See Options.InlineStatic.
+func inlineStatic(
+	all *template.Template,
+	trees []*parse.Tree,
+	pure map[string]bool,
+) error {
+	if len(pure) == 0 {
+		return nil
+	}
+
+	// Executing a template prevents adding to its set, so render from a
+	// clone instead.
+	render, err := all.Clone()
+	if err != nil {
+		return errors.Wrap(err, "clone")
+	}
+	cache := map[string][]byte{}
+	inline := func(n parse.Node) (parse.Node, error) {
+		tn, ok := n.(*parse.TemplateNode)
+		if !ok || !strings.HasSuffix(tn.Name, "#template") {
+			return n, nil
+		}
+		if !pure[strings.TrimSuffix(tn.Name, "#template")] {
+			return n, nil
+		}
+		arg, ok := constArg(tn.Pipe)
+		if !ok {
+			return n, nil
+		}
+		key := fmt.Sprintf("%s %T %v", tn.Name, arg, arg)
+		out, ok := cache[key]
+		if !ok {
+			buf := &bytes.Buffer{}
+			if err := render.ExecuteTemplate(buf, tn.Name, arg); err != nil {
+				return nil, errors.Wrapf(err, "inline %s", tn.Name)
+			}
+			out = buf.Bytes()
+			cache[key] = out
+		}
+		return &parse.TextNode{NodeType: parse.NodeText, Pos: tn.Pos, Text: out}, nil
+	}
+	for _, tree := range trees {
+		if err := rewriteList(tree.Root, inline); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// constArg returns the value of a pipeline consisting only of a constant,
+// such as "check" or 3. A missing pipeline is a nil constant.
+func constArg(pipe *parse.PipeNode) (interface{}, bool) {
+	if pipe == nil {
+		return nil, true
+	}
+	if len(pipe.Decl) > 0 || len(pipe.Cmds) != 1 || len(pipe.Cmds[0].Args) != 1 {
+		return nil, false
+	}
+	switch n := pipe.Cmds[0].Args[0].(type) {
+	case *parse.StringNode:
+		return n.Text, true
+	case *parse.BoolNode:
+		return n.True, true
+	case *parse.NilNode:
+		return nil, true
+	case *parse.NumberNode:
+		switch {
+		case n.IsInt:
+			return int(n.Int64), true
+		case n.IsFloat:
+			return n.Float64, true
+		}
+	}
+	return nil, false
+}
+
+// rewriteList replaces each node within a list, including nodes nested in
+// the branches of if, range, and with actions, by the result of fn.
+func rewriteList(
+	ln *parse.ListNode,
+	fn func(parse.Node) (parse.Node, error),
+) error {
+	if ln == nil {
+		return nil
+	}
+	for i, n := range ln.Nodes {
+		var branch *parse.BranchNode
+		switch t := n.(type) {
+		case *parse.IfNode:
+			branch = &t.BranchNode
+		case *parse.RangeNode:
+			branch = &t.BranchNode
+		case *parse.WithNode:
+			branch = &t.BranchNode
+		}
+		if branch != nil {
+			if err := rewriteList(branch.List, fn); err != nil {
+				return err
+			}
+			if err := rewriteList(branch.ElseList, fn); err != nil {
+				return err
+			}
+			continue
+		}
+		nn, err := fn(n)
+		if err != nil {
+			return err
+		}
+		ln.Nodes[i] = nn
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package component
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInlineStatic(t *testing.T) {
+	src := map[string]string{
+		"icon": `<style>.icon { width: 1em; }</style>
+<template pure><i class="icon">{{ . }}</i></template>`,
+		"badge": `<template><b>{{ . }}</b></template>`,
+		"page": `<template>
+	{{ template "./icon" "check" }}
+	{{ template "./icon" .Name }}
+	{{ template "./badge" "new" }}
+</template>`,
+	}
+	tmpl, _ := compileMap(t, Options{InlineStatic: true}, src)
+	tree := tmpl.Lookup("page#template").Tree.Root.String()
+	if !strings.Contains(tree, `<i class="icon">check</i>`) {
+		t.Errorf("constant include of pure component not inlined:\n%s", tree)
+	}
+	if !strings.Contains(tree, `{{template "icon#template" .Name}}`) {
+		t.Errorf("include with data should be kept:\n%s", tree)
+	}
+	if !strings.Contains(tree, `{{template "badge#template" "new"}}`) {
+		t.Errorf("include of impure component should be kept:\n%s", tree)
+	}
+
+	got := render(t, tmpl, "page", map[string]string{"Name": "x"})
+	for _, want := range []string{
+		`<i class="icon">check</i>`,
+		`<i class="icon">x</i>`,
+		`<b>new</b>`,
+		`.icon { width: 1em; }`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("page missing %q:\n%s", want, got)
+		}
+	}
+
+	// inlining doesn't change what's rendered
+	plain, _ := compileMap(t, Options{}, src)
+	if want := render(t, plain, "page", map[string]string{"Name": "x"}); got != want {
+		t.Errorf("inlined page differs:\n%s\nwant:\n%s", got, want)
+	}
+}
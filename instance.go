@@ -0,0 +1,49 @@
+package component
+
+import (
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// instanceAttr is added to the top-level elements of each rendered instance
+// of a component marked <style scoped instance>, holding an ID unique to
+// that instance.
+const instanceAttr = "data-ci"
+
+// instanceFunc is the name of the template function generating instance IDs.
+const instanceFunc = "componentInstance"
+
+var instanceCount uint64
+
+// nextInstance returns an ID which is unique for the life of the process, so
+// it's also unique within any page.
+func nextInstance() string {
+	return strconv.FormatUint(atomic.AddUint64(&instanceCount, 1), 36)
+}
+
+// instanceMarkup marks each rendered instance of a component with a unique
+// ID. The ID is generated once at the start of the template section and is
+// available to it as $instance. Templates defined within the section can't
+// see the section's variables, so each generates its own ID.
+func instanceMarkup(src []byte) []byte {
+	decl := "{{ $instance := " + instanceFunc + " }}"
+	out := make([]byte, 0, len(src)+64)
+	out = append(out, decl...)
+	s := string(src)
+	last := 0
+	for i := 0; i < len(s); i++ {
+		if !strings.HasPrefix(s[i:], "{{") {
+			continue
+		}
+		end := skipAction(s, i)
+		action := strings.TrimLeft(s[i+2:end], "- \t\r\n")
+		if strings.HasPrefix(action, "define") || strings.HasPrefix(action, "block") {
+			out = append(out, s[last:end]...)
+			out = append(out, decl...)
+			last = end
+		}
+		i = end - 1
+	}
+	return append(out, s[last:]...)
+}
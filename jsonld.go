@@ -0,0 +1,145 @@
+package component
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template/parse"
+)
+
+// jsonLDSection is the section holding a component's structured data,
+// written <jsonld>...</jsonld>.
+const jsonLDSection = "jsonld"
+
+// controlActions begin template actions which don't output a value.
+var controlActions = map[string]bool{
+	"if":       true,
+	"else":     true,
+	"end":      true,
+	"range":    true,
+	"with":     true,
+	"define":   true,
+	"block":    true,
+	"break":    true,
+	"continue": true,
+}
+
+// jsonLDFragment validates a component's JSON-LD section, which must be a
+// JSON object or an array of them, returning it ready to be joined with
+// those of other components into a page's @graph. An array's elements are
+// returned without its brackets; an empty array returns nothing.
+//
+// Since the section may use template actions, it's validated with each
+// action outputting a value replaced by null and other actions removed,
+// e.g. {"name": {{ .Name }}} is valid. Else branches are left out, so only
+// the first of each set of alternatives is validated.
+func jsonLDFragment(name string, src []byte) ([]byte, error) {
+	var v interface{}
+	if err := json.Unmarshal([]byte(maskJSONActions(string(src))), &v); err != nil {
+		return nil, fmt.Errorf("invalid JSON-LD in %s: %v", name, err)
+	}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return bytes.TrimSpace(src), nil
+	case []interface{}:
+		if len(v) == 0 {
+			return nil, nil
+		}
+		src = bytes.TrimSpace(src)
+		return bytes.TrimSpace(src[1 : len(src)-1]), nil
+	}
+	return nil, fmt.Errorf("invalid JSON-LD in %s: it must be an object or array", name)
+}
+
+// rendersValue reports whether a compiled JSON-LD section always renders
+// something, whatever its data. Sections are joined with commas, so one
+// rendering nothing, e.g. an if without an else, would leave an empty
+// element in the page's @graph, which isn't valid JSON.
+func rendersValue(list *parse.ListNode) bool {
+	if list == nil {
+		return false
+	}
+	for _, n := range list.Nodes {
+		switch n := n.(type) {
+		case *parse.TextNode:
+			if len(bytes.TrimSpace(n.Text)) > 0 {
+				return true
+			}
+		case *parse.ActionNode:
+			if len(n.Pipe.Decl) == 0 {
+				return true
+			}
+		case *parse.TemplateNode:
+			return true
+		case *parse.IfNode:
+			if rendersValue(n.List) && rendersValue(n.ElseList) {
+				return true
+			}
+		case *parse.WithNode:
+			if rendersValue(n.List) && rendersValue(n.ElseList) {
+				return true
+			}
+		case *parse.RangeNode:
+			if rendersValue(n.List) && rendersValue(n.ElseList) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// maskJSONActions replaces the template actions in src for validating it
+// as JSON. Only the first branch of each if, with, or range is kept, so a
+// section may render alternatives, e.g. {{ if .P }}{...}{{ else }}{}{{ end }}.
+func maskJSONActions(s string) string {
+	var b strings.Builder
+	last := 0
+	// depth is the number of blocks open, and skip the depth of the block
+	// whose else branch is being left out, if any
+	depth, skip := 0, 0
+	for i := 0; i < len(s); i++ {
+		if !strings.HasPrefix(s[i:], "{{") {
+			continue
+		}
+		end := skipAction(s, i)
+		if skip == 0 {
+			b.WriteString(s[last:i])
+		}
+		action := strings.TrimLeft(strings.TrimSuffix(s[i+2:end], "}}"), "- \t\r\n")
+		word := action
+		if j := strings.IndexAny(action, " \t\r\n-}"); j >= 0 {
+			word = action[:j]
+		}
+		switch {
+		case word == "if", word == "range", word == "with", word == "block", word == "define":
+			depth++
+		case word == "end":
+			if skip == depth {
+				skip = 0
+			}
+			depth--
+		case word == "else":
+			if skip == 0 {
+				skip = depth
+			}
+		case skip == 0 && !controlActions[word] && !strings.HasPrefix(action, "/*"):
+			b.WriteString("null")
+		}
+		last = end
+		i = end - 1
+	}
+	if skip == 0 {
+		b.WriteString(s[last:])
+	}
+	return b.String()
+}
+
+// jsonLDTag returns the <script type="application/ld+json"> merging the
+// named JSON-LD sections of a page into a single @graph.
+func jsonLDTag(names []string) string {
+	return `<script type="application/ld+json">` + "\n" +
+		`{"@context": "https://schema.org", "@graph": [` + "\n" +
+		strings.Replace(includes(names), "\n", ",\n", -1) +
+		"\n]}\n</script>"
+}
@@ -0,0 +1,84 @@
+package component
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// jsonLDGraph returns the @graph of the JSON-LD in a page, failing the test
+// unless it's valid JSON.
+func jsonLDGraph(t *testing.T, page string) []interface{} {
+	t.Helper()
+	const open = `<script type="application/ld+json">`
+	i := strings.Index(page, open)
+	if i < 0 {
+		t.Fatalf("page has no JSON-LD:\n%s", page)
+	}
+	src := page[i+len(open):]
+	src = src[:strings.Index(src, "</script>")]
+	var doc struct {
+		Context string        `json:"@context"`
+		Graph   []interface{} `json:"@graph"`
+	}
+	if err := json.Unmarshal([]byte(src), &doc); err != nil {
+		t.Fatalf("invalid JSON-LD: %v\n%s", err, src)
+	}
+	if doc.Context != "https://schema.org" {
+		t.Errorf("@context %q", doc.Context)
+	}
+	return doc.Graph
+}
+
+func TestJSONLD(t *testing.T) {
+	src := map[string]string{
+		"product": `<jsonld>{"@type": "Product", "name": {{ .Name }}}</jsonld>
+<template>{{ .Name }}</template>`,
+		"crumbs": `<jsonld>[{"@type": "ListItem", "position": 1}, {"@type": "ListItem", "position": 2}]</jsonld>
+<template>crumbs</template>`,
+		"none": `<jsonld>[]</jsonld><template>none</template>`,
+		"maybe": `<jsonld>{{ if .Name }}{"@type": "Thing"}{{ else }}{}{{ end }}</jsonld>
+<template>maybe</template>`,
+		"page": `<template>{{ template "./product" . }}{{ template "./crumbs" }}{{ template "./none" }}{{ template "./maybe" . }}</template>`,
+	}
+	tmpl, _ := compileMap(t, Options{}, src)
+	page := render(t, tmpl, "page", map[string]interface{}{
+		"Name": `Ann's "best" </script>`,
+	})
+	if n := strings.Count(page, "application/ld+json"); n != 1 {
+		t.Errorf("%d JSON-LD scripts, want them merged into one", n)
+	}
+	graph := jsonLDGraph(t, page)
+	if len(graph) != 4 {
+		t.Fatalf("@graph has %d nodes, want the product, 2 crumbs, and a thing: %v",
+			len(graph), graph)
+	}
+	for _, node := range graph {
+		node := node.(map[string]interface{})
+		if node["@type"] == "Product" && node["name"] != `Ann's "best" </script>` {
+			t.Errorf("product name %q", node["name"])
+		}
+	}
+
+	// sections whose data is missing still render values
+	page = render(t, tmpl, "page", map[string]interface{}{"Name": ""})
+	if graph := jsonLDGraph(t, page); len(graph) != 4 {
+		t.Errorf("@graph has %d nodes, want the product, 2 crumbs, and an empty one: %v",
+			len(graph), graph)
+	}
+
+	for section, want := range map[string]string{
+		`{"name": }`: "invalid JSON-LD",
+		`"text"`:     "must be an object or array",
+		`{{ if .Name }}{"@type": "Thing"}{{ end }}`:                   "may render nothing",
+		`[{{ range .Items }}{"name": {{ . }}}{{ end }}]`:              "may render nothing",
+		`{{ with .Product }}{"name": {{ .Name }}}{{ else }}{{ end }}`: "may render nothing",
+	} {
+		_, _, err := NewCompiler(Options{}).Map(map[string][]byte{
+			"page": []byte("<jsonld>" + section + "</jsonld><template>x</template>"),
+		})
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: err = %v, want %q", section, err, want)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package component
+
+// Event kinds reported to Options.Logger.
+const (
+	// EventFile is reported for each component file found in a directory.
+	EventFile = "file"
+
+	// EventSection is reported for each section compiled.
+	EventSection = "section"
+
+	// EventCycle is reported when components include each other in a
+	// cycle, just before compilation fails.
+	EventCycle = "cycle"
+
+	// EventCheckFailed is reported when Validate fails on a problem which
+	// is only a warning when compiling, e.g. an undefined template.
+	EventCheckFailed = "check-failed"
+)
+
+// Event describes a step of compilation. See Options.Logger.
+type Event struct {
+	// Kind categorizes the event, e.g. EventSection.
+	Kind string
+
+	// Component is the name of the component involved, if any.
+	Component string
+
+	// Section is the section involved, if any, e.g. "style".
+	Section string
+
+	// Path is the file involved, if any.
+	Path string
+
+	// Message describes the event.
+	Message string
+}
+
+// Logger receives events as compilation progresses. See Options.Logger.
+type Logger interface {
+	Log(Event)
+}
+
+// LoggerFunc adapts a function to a Logger.
+type LoggerFunc func(Event)
+
+// Log calls f(e).
+func (f LoggerFunc) Log(e Event) { f(e) }
+
+// log reports an event to logger, if there is one.
+func log(logger Logger, e Event) {
+	if logger != nil {
+		logger.Log(e)
+	}
+}
@@ -0,0 +1,65 @@
+package component
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestLogger(t *testing.T) {
+	var events []Event
+	opts := Options{Logger: LoggerFunc(func(e Event) { events = append(events, e) })}
+	count := func(kind, component, section string) int {
+		n := 0
+		for _, e := range events {
+			if e.Kind == kind && e.Component == component && e.Section == section {
+				n++
+			}
+		}
+		return n
+	}
+
+	dir := writeDir(t, map[string]string{
+		"page.tmpl":    `<style>p { color: red; }</style><template>{{ template "./nav/bar" }}</template>`,
+		"nav/bar.tmpl": `<template><nav></nav></template>`,
+		"notes.txt":    "not a component",
+	})
+	if _, err := CompileDir(dir, nil, opts); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"page", "nav/bar"} {
+		if count(EventFile, name, "") != 1 {
+			t.Errorf("want one file event for %s: %+v", name, events)
+		}
+	}
+	for _, e := range events {
+		if e.Kind == EventFile && e.Component == "nav/bar" &&
+			e.Path != filepath.Join(dir, "nav", "bar.tmpl") {
+			t.Errorf("file event path %s", e.Path)
+		}
+	}
+	for _, want := range [][2]string{{"page", "style"}, {"page", "template"}, {"nav/bar", "template"}} {
+		if count(EventSection, want[0], want[1]) != 1 {
+			t.Errorf("want one section event for %s#%s: %+v", want[0], want[1], events)
+		}
+	}
+	if n := count(EventSection, "nav/bar", "style"); n != 0 {
+		t.Errorf("%d section events for a missing style", n)
+	}
+
+	events = nil
+	_, err := CompileDir(writeDir(t, map[string]string{
+		"a.tmpl": `<template>{{ template "./b" }}</template>`,
+		"b.tmpl": `<template>{{ template "./a" }}</template>`,
+	}), nil, opts)
+	if err == nil || count(EventCycle, "a", "") != 1 {
+		t.Errorf("err = %v, want a cycle event for a: %+v", err, events)
+	}
+
+	events = nil
+	err = Validate(writeDir(t, map[string]string{
+		"page.tmpl": `<template>{{ template "./missing" }}</template>`,
+	}), nil, opts)
+	if err == nil || count(EventCheckFailed, "page", "") != 1 {
+		t.Errorf("err = %v, want a check-failed event for page: %+v", err, events)
+	}
+}
@@ -0,0 +1,461 @@
+package component
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// voidElements never have content or an end tag.
+var voidElements = map[string]bool{
+	"area":   true,
+	"base":   true,
+	"br":     true,
+	"col":    true,
+	"embed":  true,
+	"hr":     true,
+	"img":    true,
+	"input":  true,
+	"link":   true,
+	"meta":   true,
+	"param":  true,
+	"source": true,
+	"track":  true,
+	"wbr":    true,
+}
+
+// markupToken is an HTML token within a template section along with its
+// byte offsets in the original markup.
+type markupToken struct {
+	html.Token
+	start, end int
+}
+
+// tokenizeMarkup splits template section markup into HTML tokens. Template
+// actions are masked before tokenizing, so a "<" or quote within an action
+// can't confuse the tokenizer. As a result, token data and attributes show
+// actions as runs of 'x'; use the offsets to recover the original markup.
+func tokenizeMarkup(src []byte) ([]markupToken, error) {
+	z := html.NewTokenizer(bytes.NewReader(maskActions(src)))
+	var toks []markupToken
+	pos := 0
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if err := z.Err(); err != io.EOF {
+				return nil, err
+			}
+			return toks, nil
+		}
+		n := len(z.Raw())
+		toks = append(toks, markupToken{
+			Token: z.Token(),
+			start: pos,
+			end:   pos + n,
+		})
+		pos += n
+	}
+}
+
+// maskActions returns a copy of src with every template action replaced by
+// 'x' characters of the same length.
+func maskActions(src []byte) []byte {
+	masked := make([]byte, len(src))
+	copy(masked, src)
+	s := string(src)
+	for i := 0; i < len(s); i++ {
+		if s[i] != '{' || i+1 >= len(s) || s[i+1] != '{' {
+			continue
+		}
+		end := skipAction(s, i)
+		for j := i; j < end; j++ {
+			masked[j] = 'x'
+		}
+		i = end - 1
+	}
+	return masked
+}
+
+// scopeRootAttr marks the elements of a template section to receive the
+// scoping attribute instead of its top-level elements.
+const scopeRootAttr = "data-scope-root"
+
+// scopeMarkup adds attr to every top-level element in a template section,
+// i.e. each element which isn't nested within another element of the same
+// section. If any elements are marked data-scope-root, attr is added to
+// those instead, replacing the marker.
+func scopeMarkup(src []byte, attr string) ([]byte, error) {
+	toks, err := tokenizeMarkup(src)
+	if err != nil {
+		return nil, err
+	}
+	if out, ok := scopeRoots(src, toks, attr); ok {
+		return out, nil
+	}
+	var b bytes.Buffer
+	depth, last := 0, 0
+	for _, t := range toks {
+		switch t.Type {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			if depth == 0 {
+				// insert the attribute directly after the tag name
+				i := t.start + 1 + len(t.Data)
+				b.Write(src[last:i])
+				b.WriteString(" " + attr)
+				last = i
+			}
+			if t.Type == html.StartTagToken && !voidElements[t.Data] {
+				depth++
+			}
+		case html.EndTagToken:
+			if depth > 0 {
+				depth--
+			}
+		}
+	}
+	b.Write(src[last:])
+	return b.Bytes(), nil
+}
+
+// scopeRoots adds attr to the elements marked data-scope-root in place of
+// the marker, reporting false if there are none.
+func scopeRoots(src []byte, toks []markupToken, attr string) ([]byte, bool) {
+	masked := maskActions(src)
+	var b bytes.Buffer
+	last, found := 0, false
+	for _, t := range toks {
+		if t.Type != html.StartTagToken && t.Type != html.SelfClosingTagToken {
+			continue
+		}
+		tag := src[t.start:t.end]
+		for _, a := range scanAttrs(masked[t.start:t.end], tag) {
+			if a.name != scopeRootAttr {
+				continue
+			}
+			found = true
+			i := 1 + len(t.Data)
+			b.Write(src[last : t.start+i])
+			b.WriteString(" " + attr)
+			b.Write(bytes.TrimRight(tag[i:a.start], spaceChars))
+			b.Write(tag[a.end:])
+			last = t.end
+			break
+		}
+	}
+	if !found {
+		return nil, false
+	}
+	b.Write(src[last:])
+	return b.Bytes(), true
+}
+
+// lazyImages adds loading="lazy" and decoding="async" to each <img> in
+// template section markup which doesn't set them already. See
+// Options.LazyImages.
+func lazyImages(src []byte) ([]byte, error) {
+	return defaultAttrs(src, map[string]map[string]string{
+		"img": {"loading": "lazy", "decoding": "async"},
+	})
+}
+
+// defaultAttrs adds attributes to elements in template section markup which
+// don't set them already, mapping tag names to the attributes to add.
+// Elements with attributes written by template actions are left alone,
+// since the actions might set them.
+func defaultAttrs(src []byte, defaults map[string]map[string]string) ([]byte, error) {
+	toks, err := tokenizeMarkup(src)
+	if err != nil {
+		return nil, err
+	}
+	masked := maskActions(src)
+	var b bytes.Buffer
+	last := 0
+tags:
+	for _, t := range toks {
+		attrs := defaults[t.Data]
+		if len(attrs) == 0 ||
+			(t.Type != html.StartTagToken && t.Type != html.SelfClosingTagToken) {
+			continue
+		}
+		add := make(map[string]bool, len(attrs))
+		for name := range attrs {
+			add[name] = true
+		}
+		for _, a := range scanAttrs(masked[t.start:t.end], src[t.start:t.end]) {
+			if strings.Contains(a.name, "{{") {
+				continue tags
+			}
+			delete(add, a.name)
+		}
+		names := make([]string, 0, len(add))
+		for name := range add {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		// insert the attributes directly after the tag name
+		i := t.start + 1 + len(t.Data)
+		b.Write(src[last:i])
+		for _, name := range names {
+			b.WriteString(" " + name + `="` + html.EscapeString(attrs[name]) + `"`)
+		}
+		last = i
+	}
+	b.Write(src[last:])
+	return b.Bytes(), nil
+}
+
+// blockElements are rendered as blocks by default, so whitespace beside
+// them is never significant.
+var blockElements = map[string]bool{
+	"address":    true,
+	"article":    true,
+	"aside":      true,
+	"blockquote": true,
+	"body":       true,
+	"caption":    true,
+	"col":        true,
+	"colgroup":   true,
+	"dd":         true,
+	"details":    true,
+	"dialog":     true,
+	"div":        true,
+	"dl":         true,
+	"dt":         true,
+	"fieldset":   true,
+	"figcaption": true,
+	"figure":     true,
+	"footer":     true,
+	"form":       true,
+	"h1":         true,
+	"h2":         true,
+	"h3":         true,
+	"h4":         true,
+	"h5":         true,
+	"h6":         true,
+	"head":       true,
+	"header":     true,
+	"hgroup":     true,
+	"hr":         true,
+	"html":       true,
+	"li":         true,
+	"link":       true,
+	"main":       true,
+	"meta":       true,
+	"nav":        true,
+	"noscript":   true,
+	"ol":         true,
+	"option":     true,
+	"p":          true,
+	"pre":        true,
+	"script":     true,
+	"section":    true,
+	"style":      true,
+	"summary":    true,
+	"table":      true,
+	"tbody":      true,
+	"td":         true,
+	"template":   true,
+	"tfoot":      true,
+	"th":         true,
+	"thead":      true,
+	"title":      true,
+	"tr":         true,
+	"ul":         true,
+}
+
+// preserveWhitespace are elements whose text content must not be changed.
+var preserveWhitespace = map[string]bool{
+	"pre":      true,
+	"textarea": true,
+	"script":   true,
+	"style":    true,
+}
+
+// collapseWhitespace removes insignificant whitespace from template section
+// markup. See Options.CollapseWhitespace.
+func collapseWhitespace(src []byte) ([]byte, error) {
+	toks, err := tokenizeMarkup(src)
+	if err != nil {
+		return nil, err
+	}
+	masked := maskActions(src)
+	isBlock := func(i int) bool {
+		if i < 0 || i >= len(toks) {
+			return false
+		}
+		switch toks[i].Type {
+		case html.StartTagToken, html.EndTagToken, html.SelfClosingTagToken:
+			return blockElements[toks[i].Data]
+		case html.DoctypeToken:
+			return true
+		}
+		return false
+	}
+	var b bytes.Buffer
+	preserve := 0
+	for i, t := range toks {
+		switch t.Type {
+		case html.StartTagToken:
+			if preserveWhitespace[t.Data] {
+				preserve++
+			}
+		case html.EndTagToken:
+			if preserveWhitespace[t.Data] && preserve > 0 {
+				preserve--
+			}
+		}
+		if t.Type != html.TextToken || preserve > 0 {
+			b.Write(src[t.start:t.end])
+			continue
+		}
+		text := masked[t.start:t.end]
+		start, end := 0, len(text)
+		if isBlock(i - 1) {
+			start = len(text) - len(bytes.TrimLeft(text, spaceChars))
+		}
+		if isBlock(i + 1) {
+			end = len(bytes.TrimRight(text, spaceChars))
+		}
+		for j := start; j < end; j++ {
+			if !isSpace(text[j]) {
+				b.WriteByte(src[t.start+j])
+				continue
+			}
+			for j+1 < end && isSpace(text[j+1]) {
+				j++
+			}
+			b.WriteByte(' ')
+		}
+	}
+	return b.Bytes(), nil
+}
+
+const spaceChars = " \t\r\n\f"
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\f'
+}
+
+// silentActionRE matches template actions which never output anything,
+// such as {{ if .X }}, {{ end }}, comments, and variable assignments.
+var silentActionRE = regexp.MustCompile(
+	`^{{-?\s*(?:(?:if|else|end|range|with|break|continue)\b|/\*|\$\w*\s*:?=)`)
+
+// prettyMarkup indents template section markup by element depth for
+// readability. See Options.Pretty. Only whitespace which doesn't affect
+// rendering changes: block-level elements are put on their own lines, and
+// whitespace spanning lines is re-indented.
+func prettyMarkup(src []byte) ([]byte, error) {
+	toks, err := tokenizeMarkup(src)
+	if err != nil {
+		return nil, err
+	}
+	masked := maskActions(src)
+	var b bytes.Buffer
+	// multiline records whether each open element has content on its own
+	// lines, in which case its end tag goes on its own line too
+	var multiline []bool
+	preserve, pending := 0, false
+	write := func(p []byte) {
+		if pending {
+			// whitespace before a line break is insignificant
+			trimmed := bytes.TrimRight(b.Bytes(), " \t")
+			b.Truncate(len(trimmed))
+			if b.Len() > 0 {
+				b.WriteByte('\n')
+				b.Write(bytes.Repeat([]byte{'\t'}, len(multiline)))
+			}
+			for i := range multiline {
+				multiline[i] = true
+			}
+			pending = false
+		}
+		b.Write(p)
+	}
+	for _, t := range toks {
+		raw := src[t.start:t.end]
+		block := blockElements[t.Data]
+		if preserve > 0 {
+			switch {
+			case t.Type == html.StartTagToken && preserveWhitespace[t.Data]:
+				preserve++
+			case t.Type == html.EndTagToken && preserveWhitespace[t.Data]:
+				preserve--
+			}
+			if preserve > 0 {
+				b.Write(raw)
+				continue
+			}
+			// the end of a preserved element can't move
+			b.Write(raw)
+			multiline = multiline[:len(multiline)-1]
+			pending = pending || block
+			continue
+		}
+		switch t.Type {
+		case html.StartTagToken:
+			pending = pending || block
+			write(raw)
+			if preserveWhitespace[t.Data] {
+				preserve++
+			}
+			if !voidElements[t.Data] {
+				multiline = append(multiline, false)
+			} else if block {
+				pending = true
+			}
+		case html.EndTagToken:
+			ml := false
+			if len(multiline) > 0 {
+				ml = multiline[len(multiline)-1]
+				multiline = multiline[:len(multiline)-1]
+			}
+			pending = pending || (block && ml)
+			write(raw)
+			pending = block
+		case html.SelfClosingTagToken, html.DoctypeToken:
+			block = block || t.Type == html.DoctypeToken
+			pending = pending || block
+			write(raw)
+			pending = block
+		case html.TextToken:
+			text := masked[t.start:t.end]
+			for j := 0; j < len(text); j++ {
+				if bytes.HasPrefix(raw[j:], []byte("{{")) {
+					end := j + skipAction(string(raw[j:]), 0)
+					if silentActionRE.Match(raw[j:end]) {
+						// keep line breaks after actions which output
+						// nothing, so they don't leave blank lines
+						b.Write(raw[j:end])
+					} else {
+						write(raw[j:end])
+					}
+					j = end - 1
+					continue
+				}
+				if !isSpace(text[j]) {
+					write(raw[j : j+1])
+					continue
+				}
+				k := j
+				for k < len(text) && isSpace(text[k]) {
+					k++
+				}
+				switch {
+				case bytes.IndexByte(text[j:k], '\n') >= 0:
+					pending = true
+				case !pending:
+					b.Write(raw[j:k])
+				}
+				j = k - 1
+			}
+		default:
+			write(raw)
+		}
+	}
+	return b.Bytes(), nil
+}
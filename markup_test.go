@@ -0,0 +1,162 @@
+package component
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCollapseWhitespace(t *testing.T) {
+	tests := []struct {
+		name, src, want string
+	}{
+		{
+			name: "block",
+			src:  "<div>\n  <p>Hello,   <b>world</b> !</p>\n</div>",
+			want: "<div><p>Hello, <b>world</b> !</p></div>",
+		},
+		{
+			name: "inline",
+			src:  "<span>a</span> <span>b</span>",
+			want: "<span>a</span> <span>b</span>",
+		},
+		{
+			name: "pre",
+			src:  "<div>\n<pre>\n  a\n    b\n</pre>\n</div>",
+			want: "<div><pre>\n  a\n    b\n</pre></div>",
+		},
+		{
+			name: "textarea",
+			src:  "<textarea>  x  </textarea>",
+			want: "<textarea>  x  </textarea>",
+		},
+		{
+			name: "actions",
+			src:  "<p>{{ .A }}   {{ .B }}</p>",
+			want: "<p>{{ .A }} {{ .B }}</p>",
+		},
+		{
+			name: "within action",
+			src:  `<p>{{ printf "%s   %s" .A .B }}</p>`,
+			want: `<p>{{ printf "%s   %s" .A .B }}</p>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := collapseWhitespace([]byte(tt.src))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCollapseWhitespaceOption(t *testing.T) {
+	src := map[string]string{
+		"page": `<template>
+	<ul>
+		<li>{{ .A }}   and   {{ .B }}</li>
+	</ul>
+	<pre>  keep
+	  this  </pre>
+</template>`,
+	}
+	tmpl, _ := compileMap(t, Options{CollapseWhitespace: true}, src)
+	got := render(t, tmpl, "page#template", map[string]string{"A": "x", "B": "y"})
+	want := "<ul><li>x and y</li></ul><pre>  keep\n  this  </pre>"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// without the option, markup is left as written
+	tmpl, _ = compileMap(t, Options{}, src)
+	got = render(t, tmpl, "page#template", map[string]string{"A": "x", "B": "y"})
+	if !strings.Contains(got, "x   and   y") {
+		t.Errorf("whitespace collapsed without the option: %q", got)
+	}
+}
+
+func TestLazyImages(t *testing.T) {
+	tests := []struct {
+		name, src, want string
+	}{
+		{
+			name: "plain",
+			src:  `<img src="a.png">`,
+			want: `<img decoding="async" loading="lazy" src="a.png">`,
+		},
+		{
+			name: "override",
+			src:  `<img src="a.png" loading="eager">`,
+			want: `<img decoding="async" src="a.png" loading="eager">`,
+		},
+		{
+			name: "case and self-closing",
+			src:  `<IMG src=a.png decoding=sync/>`,
+			want: `<IMG loading="lazy" src=a.png decoding=sync/>`,
+		},
+		{
+			name: "actions in values",
+			src:  `<img src="{{ .X }}" alt="{{ if .A }}loading{{ end }}">`,
+			want: `<img decoding="async" loading="lazy" src="{{ .X }}" alt="{{ if .A }}loading{{ end }}">`,
+		},
+		{
+			name: "actions as attributes",
+			src:  `<img src="a.png" {{ .Attrs }}>`,
+			want: `<img src="a.png" {{ .Attrs }}>`,
+		},
+		{
+			name: "not an image",
+			src:  `<p>img</p><imgx>`,
+			want: `<p>img</p><imgx>`,
+		},
+	}
+	for _, tt := range tests {
+		got, err := lazyImages([]byte(tt.src))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s:\n got %s\nwant %s", tt.name, got, tt.want)
+		}
+	}
+	tmpl, _ := compileMap(t, Options{LazyImages: true}, map[string]string{
+		"page": `<template><img src="{{ .Src }}"></template>`,
+	})
+	if page := render(t, tmpl, "page", map[string]string{"Src": "a.png"}); !strings.Contains(page, `loading="lazy"`) {
+		t.Errorf("LazyImages page:\n%s", page)
+	}
+}
+
+func TestScopeMarkup(t *testing.T) {
+	tests := []struct {
+		name, src, want string
+	}{
+		{
+			name: "top-level",
+			src:  `<div class="y">a</div><p>b</p>`,
+			want: `<div data-c class="y">a</div><p data-c>b</p>`,
+		},
+		{
+			name: "one root",
+			src:  `<h1>t</h1><div data-scope-root class="x"><p>a</p></div>`,
+			want: `<h1>t</h1><div data-c class="x"><p>a</p></div>`,
+		},
+		{
+			name: "several roots",
+			src:  `<h1>t</h1><div data-scope-root><p data-scope-root>a</p></div><section data-scope-root>b</section><span>c</span>`,
+			want: `<h1>t</h1><div data-c><p data-c>a</p></div><section data-c>b</section><span>c</span>`,
+		},
+	}
+	for _, tt := range tests {
+		got, err := scopeMarkup([]byte(tt.src), "data-c")
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s:\n got %s\nwant %s", tt.name, got, tt.want)
+		}
+	}
+}
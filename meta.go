@@ -0,0 +1,200 @@
+package component
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Meta describes a compiled set of components.
+type Meta struct {
+	// Warnings are non-fatal problems found while compiling, sorted by
+	// component. Compilation succeeds regardless, so callers decide
+	// whether to log warnings or treat them as failures.
+	Warnings []Warning
+
+	// Assets are the styles and scripts compiled to separate files with
+	// Options.ExternalAssets or Options.NoAssetBundling, sorted by path.
+	// Serve each at Options.AssetPrefix + Path.
+	Assets []*Asset
+
+	// Sources maps the internal name of each section and local template,
+	// e.g. "list/item#template" or "list/item~row", to where it was
+	// defined. Template errors report lines relative to these, which lets
+	// a development server point at the component responsible for an
+	// error. See Locate.
+	Sources map[string]SourceLocation
+
+	// Pages maps each page to the external assets it references, in the
+	// order they appear. See LinkHeaders.
+	Pages map[string][]*Asset
+
+	// DataFields maps each component to the fields of its data its
+	// template uses, sorted, e.g. ["Items[].Name", "Title", "User.Name"],
+	// for documenting data models or checking a refactor of them didn't
+	// break a template. Fields within {{ with }} and {{ range }} are
+	// named from the component's data, "[]" marking each element of a
+	// range. Fields whose path can't be followed, e.g. those of a
+	// function's result or within local templates, are left out.
+	DataFields map[string][]string
+
+	// PageSizes maps each page to the size of the styles, scripts, and
+	// markup it inlines, as compiled and as written, e.g. for checking
+	// pages against a performance budget with PagesOver.
+	PageSizes map[string]PageSize
+
+	// crossOrigin records whether external assets are referenced with
+	// crossorigin="anonymous", which preloads must match, and
+	// assetPrefix is Options.AssetPrefix.
+	crossOrigin bool
+	assetPrefix string
+}
+
+// LinkHeaders returns a Link header value preloading each external asset
+// of the named page, for sending with a 103 Early Hints response before
+// the page is rendered, e.g.
+//
+//	for _, link := range meta.LinkHeaders("home") {
+//		w.Header().Add("Link", link)
+//	}
+//	w.WriteHeader(http.StatusEarlyHints)
+//
+// Only assets compiled with Options.ExternalAssets can be preloaded. Module
+// scripts are preloaded with rel=modulepreload.
+func (m *Meta) LinkHeaders(page string) []string {
+	var links []string
+	for _, a := range m.Pages[page] {
+		link := "<" + assetURL(m.assetPrefix, a) + ">; "
+		switch {
+		case a.Module:
+			// a plain preload of a module wouldn't be reused, since
+			// modules are fetched differently
+			link += "rel=modulepreload"
+		case strings.HasSuffix(a.Path, ".css"):
+			link += "rel=preload; as=style"
+		default:
+			link += "rel=preload; as=script"
+		}
+		if m.crossOrigin {
+			link += "; crossorigin=anonymous"
+		}
+		links = append(links, link)
+	}
+	return links
+}
+
+// SourceLocation is where a section or local template was defined.
+type SourceLocation struct {
+	// File is the path of the component's file, or Source.File for
+	// components compiled from memory, falling back to Source.Name.
+	File string
+
+	// LineOffset is the number of lines in File preceding the section's
+	// content. Add it to a line reported by a template error to get the
+	// line in File. Lines are exact unless the section was rewritten
+	// across lines, e.g. by Options.CollapseWhitespace.
+	LineOffset int
+}
+
+// templateErrRE matches the location reported by text/template and
+// html/template errors, e.g. `template: list/item#template:3:12: ...`. Names
+// may contain spaces, e.g. "my dir/item#template", so the name runs up to
+// the line number.
+var templateErrRE = regexp.MustCompile(`(?:html/)?template: ?([^:\n]+):(\d+)`)
+
+// Locate returns the file and line of the component responsible for a
+// template error, such as one returned by ExecuteTemplate. It reports false
+// if err doesn't refer to a known section or local template.
+func (m *Meta) Locate(err error) (file string, line int, ok bool) {
+	if err == nil {
+		return "", 0, false
+	}
+	match := templateErrRE.FindStringSubmatch(err.Error())
+	if match == nil {
+		return "", 0, false
+	}
+	loc, ok := m.Sources[match[1]]
+	if !ok {
+		return "", 0, false
+	}
+	line, _ = strconv.Atoi(match[2])
+	return loc.File, loc.LineOffset + line, true
+}
+
+// Warning kinds.
+const (
+	// WarnGlobalSelector is reported for selectors in a scoped style which
+	// target the document, like "body" or ":root", rather than the
+	// component.
+	WarnGlobalSelector = "global-selector"
+
+	// WarnUndefinedTemplate is reported for references to templates which
+	// don't exist, e.g. a misspelled component. Rendering the reference
+	// fails at runtime.
+	WarnUndefinedTemplate = "undefined-template"
+
+	// WarnSectionSize is reported for sections larger than
+	// Options.MaxSectionSize.
+	WarnSectionSize = "section-size"
+
+	// WarnDynamicAsset is reported for styles and scripts discarded by
+	// Options.NoAssetBundling because they use template actions, which
+	// only work inline.
+	WarnDynamicAsset = "dynamic-asset"
+
+	// WarnNoAssets is reported with Options.WarnNoAssets for components
+	// included by others which have no style or script. It tells a
+	// component which simply has nothing to contribute to a page's
+	// assets apart from one whose assets went missing.
+	WarnNoAssets = "no-assets"
+
+	// WarnUndefinedToken is reported with Options.Themes for custom
+	// properties a component's style uses, e.g. var(--accent), which
+	// neither a theme nor any component declares.
+	WarnUndefinedToken = "undefined-token"
+)
+
+// Warning is a non-fatal problem found in a component.
+type Warning struct {
+	// Component is the name of the component, e.g. "list/item".
+	Component string
+
+	// Kind categorizes the warning, e.g. WarnGlobalSelector.
+	Kind string
+
+	// Message describes the problem.
+	Message string
+}
+
+func (w Warning) String() string {
+	return w.Component + ": " + w.Message
+}
+
+// sortWarnings sorts warnings by component, then kind, then message, so
+// they're reported in a stable order.
+func sortWarnings(warnings []Warning) {
+	sort.SliceStable(warnings, func(i, j int) bool {
+		a, b := warnings[i], warnings[j]
+		if a.Component != b.Component {
+			return a.Component < b.Component
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.Message < b.Message
+	})
+}
+
+// displayName describes an internal template name, e.g. "list/item#style",
+// in terms of the component source it came from.
+func displayName(name string) string {
+	if i := strings.Index(name, "~"); i >= 0 {
+		return fmt.Sprintf("local template %q in %s", name[i+1:], name[:i])
+	}
+	if i := strings.Index(name, "#"); i >= 0 {
+		return fmt.Sprintf("%s section of %s", name[i+1:], name[:i])
+	}
+	return name
+}
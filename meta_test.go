@@ -0,0 +1,66 @@
+package component
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestLocate(t *testing.T) {
+	fns := template.FuncMap{
+		"fail": func() (string, error) { return "", errors.New("failed") },
+	}
+	srcs := []Source{
+		{
+			Name: "my dir/item",
+			File: "templates/my dir/item.tmpl",
+			Content: []byte(`<style>p { margin: 0; }</style>
+<template>
+	<p>ok</p>
+	<p>{{ fail }}</p>
+</template>`),
+		},
+		{
+			Name:    "page",
+			Content: []byte(`<template>{{ template "./my dir/item" . }}</template>`),
+		},
+	}
+	tmpl, meta, err := CompileSourcesMeta(srcs, fns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"my dir/item", "page"} {
+		err := tmpl.ExecuteTemplate(&bytes.Buffer{}, name, nil)
+		if err == nil {
+			t.Fatalf("%s: expected an error", name)
+		}
+		file, line, ok := meta.Locate(err)
+		if !ok || file != "templates/my dir/item.tmpl" || line != 4 {
+			t.Errorf("%s: Locate(%q) = %q, %d, %t; want line 4 of the item",
+				name, err, file, line, ok)
+		}
+	}
+	if _, _, ok := meta.Locate(errors.New("template: unknown#template:1:2: x")); ok {
+		t.Error("located an unknown template")
+	}
+}
+
+func TestLinkHeaders(t *testing.T) {
+	_, meta := compileMap(t, Options{ExternalAssets: true, Integrity: true}, map[string]string{
+		"mod":  `<script type="module">export const m = 1;</script><template>m</template>`,
+		"page": `<style>p { margin: 0; }</style><script>var p = 1;</script><template>{{ template "./mod" }}</template>`,
+	})
+	links := strings.Join(meta.LinkHeaders("page"), "\n")
+	for _, want := range []string{
+		`</mod\.\w+\.js>; rel=modulepreload; crossorigin=anonymous`,
+		`</page\.\w+\.js>; rel=preload; as=script; crossorigin=anonymous`,
+		`</page\.\w+\.css>; rel=preload; as=style; crossorigin=anonymous`,
+	} {
+		if !regexp.MustCompile(`(?m)^` + want + `$`).MatchString(links) {
+			t.Errorf("links missing %s:\n%s", want, links)
+		}
+	}
+}
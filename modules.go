@@ -0,0 +1,426 @@
+package component
+
+import (
+	"fmt"
+	"html/template"
+	"io/fs"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template/parse"
+
+	"github.com/pkg/errors"
+)
+
+// modulePrefix begins the names of the templates holding files imported by
+// module scripts, e.g. "#module:lib/util.js".
+const modulePrefix = "#module:"
+
+// moduleInfo describes a module script or a file it imports. See
+// Options.BundleModules.
+type moduleInfo struct {
+	// imports are the names of the templates holding the files it imports
+	// from the source tree, e.g. "#module:lib/util.js".
+	imports []string
+
+	// hoisted are the import statements left for the browser to resolve,
+	// e.g. of URLs, which are moved to the top of each page's module.
+	hoisted []string
+}
+
+var (
+	// importRE matches a static import statement at the start of a line,
+	// capturing the import clause, if any, and the module specifier.
+	importRE = regexp.MustCompile(
+		`(?m)^[ \t]*import[ \t]*(?:([\w${*][\w$\s,{}*]*?)\s*from\s*)?["']([^"'\n]+)["'][ \t]*;?`)
+
+	// exportStarRE matches export * from "...", capturing the namespace
+	// name, if any, and the module specifier.
+	exportStarRE = regexp.MustCompile(
+		`(?m)^[ \t]*export[ \t]*\*(?:[ \t]*as[ \t]+([\w$]+))?[ \t]*from[ \t]*["']([^"'\n]+)["'][ \t]*;?`)
+
+	// exportListRE matches export { ... }, capturing the list and the
+	// module specifier re-exported from, if any.
+	exportListRE = regexp.MustCompile(
+		`(?m)^[ \t]*export[ \t]*\{([^}]*)\}(?:[ \t]*from[ \t]*["']([^"'\n]+)["'])?[ \t]*;?`)
+
+	// exportDeclRE matches an exported declaration, capturing its
+	// indentation, keyword, and name.
+	exportDeclRE = regexp.MustCompile(
+		`(?m)^([ \t]*)export[ \t]+((?:async[ \t]+)?function[ \t]*\*?|class|const|let|var)[ \t]*([\w$]+)`)
+
+	// exportDefaultRE matches the start of export default.
+	exportDefaultRE = regexp.MustCompile(`(?m)^([ \t]*)export[ \t]+default[ \t]+`)
+)
+
+// isModule reports whether a component's script is bundled as a module.
+func (b *builder) isModule(name string) bool {
+	_, ok := b.modules[name]
+	return ok
+}
+
+// bundleModule rewrites the imports of a component's <script type="module">
+// to refer to the files they import, which are each defined once as
+// templates to be included in the page's module. See Options.BundleModules.
+func (b *builder) bundleModule(c *component) error {
+	src, info, err := b.resolveImports(c.fsys, c.path, c.name,
+		string(c.sections["script"]), nil)
+	if err != nil {
+		return err
+	}
+	// each script is a block, so components' top-level names don't clash
+	c.sections["script"] = []byte("{\n" + src + "\n}")
+	b.modules[c.name] = info
+	return nil
+}
+
+// resolveImports replaces the import statements of a module script, read
+// from file within fsys, with declarations referring to the files they
+// import, adding those files. Imports which aren't relative paths are
+// hoisted. stack holds the files importing this one, to detect cycles.
+func (b *builder) resolveImports(
+	fsys fs.FS,
+	file, name, src string,
+	stack []string,
+) (string, *moduleInfo, error) {
+	info := &moduleInfo{}
+	var err error
+	out := importRE.ReplaceAllStringFunc(src, func(m string) string {
+		sub := importRE.FindStringSubmatch(m)
+		if err != nil {
+			return m
+		}
+		spec := sub[2]
+		if !isRelativeImport(spec) {
+			info.hoisted = append(info.hoisted, strings.TrimSpace(m))
+			return ""
+		}
+		var dep string
+		dep, err = b.addModule(fsys, file, name, spec, stack)
+		if err != nil {
+			return m
+		}
+		info.imports = append(info.imports, dep)
+		var decl string
+		decl, err = importBindings(sub[1], moduleRef(dep))
+		if err != nil {
+			err = errors.Wrapf(err, "%s imports %s", name, spec)
+		}
+		return decl
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return out, info, nil
+}
+
+// isRelativeImport reports whether a module specifier is a relative path,
+// e.g. "./util.js", rather than a URL or package name.
+func isRelativeImport(spec string) bool {
+	return strings.HasPrefix(spec, "./") || strings.HasPrefix(spec, "../")
+}
+
+// moduleRef returns the expression evaluating to the exports of the file
+// held by the named template.
+func moduleRef(tmpl string) string {
+	return "__modules[" + strconv.Quote(strings.TrimPrefix(tmpl, modulePrefix)) + "]"
+}
+
+// addModule defines the template holding the file spec refers to, relative
+// to from, along with the files it imports in turn, returning the
+// template's name. Each file is only defined once.
+func (b *builder) addModule(
+	fsys fs.FS,
+	from, name, spec string,
+	stack []string,
+) (string, error) {
+	if fsys == nil {
+		return "", fmt.Errorf("%s imports %s, but only components read from a directory can import files",
+			name, spec)
+	}
+	file := path.Join(path.Dir(from), spec)
+	if !fs.ValidPath(file) {
+		return "", fmt.Errorf("%s imports %s, which is outside the directory", name, spec)
+	}
+	tmpl := modulePrefix + file
+	for i, f := range stack {
+		if f == file {
+			return "", fmt.Errorf("import cycle: %s",
+				strings.Join(append(stack[i:], file), " imports "))
+		}
+	}
+	if b.defined[tmpl] {
+		return tmpl, nil
+	}
+	var data []byte
+	var err error
+	if b.opts.ReadTimeout > 0 {
+		data, err = readTimeout(fsys, file, b.opts.ReadTimeout)
+	} else {
+		data, err = fs.ReadFile(fsys, file)
+	}
+	if err != nil {
+		return "", errors.Wrapf(err, "%s imports %s", name, spec)
+	}
+	src, info, err := b.resolveImports(fsys, file, file, string(data),
+		append(stack[:len(stack):len(stack)], file))
+	if err != nil {
+		return "", err
+	}
+	src, err = b.rewriteExports(fsys, file, src, info, stack)
+	if err != nil {
+		return "", err
+	}
+	wrapped := moduleRef(tmpl) + " = (function () {\n" +
+		"const __exports = {};\n" + src + "\nreturn __exports;\n})();"
+	if err := b.addRawText(tmpl, wrapped); err != nil {
+		return "", errors.Wrapf(err, "parse %s", file)
+	}
+	b.modules[tmpl] = info
+	return tmpl, nil
+}
+
+// rewriteExports replaces the export statements of an imported file with
+// assignments to its __exports object, adding the files it re-exports
+// from.
+func (b *builder) rewriteExports(
+	fsys fs.FS,
+	file, src string,
+	info *moduleInfo,
+	stack []string,
+) (string, error) {
+	stack = append(stack[:len(stack):len(stack)], file)
+	var exports []string
+	var err error
+	reexport := func(spec string) string {
+		if err != nil {
+			return ""
+		}
+		if !isRelativeImport(spec) {
+			err = fmt.Errorf("%s re-exports %s, which isn't a relative path", file, spec)
+			return ""
+		}
+		var dep string
+		dep, err = b.addModule(fsys, file, file, spec, stack)
+		info.imports = append(info.imports, dep)
+		return moduleRef(dep)
+	}
+	src = exportStarRE.ReplaceAllStringFunc(src, func(m string) string {
+		sub := exportStarRE.FindStringSubmatch(m)
+		ref := reexport(sub[2])
+		if sub[1] != "" {
+			return "__exports." + sub[1] + " = " + ref + ";"
+		}
+		return "Object.assign(__exports, " + ref + ");"
+	})
+	src = exportListRE.ReplaceAllStringFunc(src, func(m string) string {
+		sub := exportListRE.FindStringSubmatch(m)
+		var assigns []string
+		var ref string
+		if sub[2] != "" {
+			ref = reexport(sub[2])
+		}
+		for _, spec := range strings.Split(sub[1], ",") {
+			local, exported := splitAs(spec)
+			if local == "" {
+				continue
+			}
+			if sub[2] != "" {
+				assigns = append(assigns, "__exports."+exported+" = "+ref+"."+local+";")
+			} else {
+				// assigned at the end, once the local is declared
+				exports = append(exports, "__exports."+exported+" = "+local+";")
+			}
+		}
+		return strings.Join(assigns, " ")
+	})
+	src = exportDeclRE.ReplaceAllStringFunc(src, func(m string) string {
+		sub := exportDeclRE.FindStringSubmatch(m)
+		exports = append(exports, "__exports."+sub[3]+" = "+sub[3]+";")
+		return sub[1] + strings.TrimSpace(sub[2]) + " " + sub[3]
+	})
+	src = exportDefaultRE.ReplaceAllString(src, "${1}__exports.default = ")
+	if err != nil {
+		return "", err
+	}
+	if len(exports) > 0 {
+		src += "\n" + strings.Join(exports, "\n")
+	}
+	return src, nil
+}
+
+// importBindings returns the declarations binding the names an import
+// clause imports from the module ref evaluates to, e.g.
+// "const { a, b: c } = ref;" for "{ a, b as c }". A clause-less import,
+// only run for its effects, binds nothing.
+func importBindings(clause, ref string) (string, error) {
+	clause = strings.TrimSpace(clause)
+	var decls []string
+	for clause != "" {
+		switch {
+		case strings.HasPrefix(clause, "{"):
+			end := strings.IndexByte(clause, '}')
+			if end < 0 {
+				return "", fmt.Errorf("unclosed import list %q", clause)
+			}
+			var fields []string
+			for _, spec := range strings.Split(clause[1:end], ",") {
+				imported, local := splitAs(spec)
+				if imported == "" {
+					continue
+				}
+				if imported == local {
+					fields = append(fields, local)
+				} else {
+					fields = append(fields, imported+": "+local)
+				}
+			}
+			decls = append(decls, "const { "+strings.Join(fields, ", ")+" } = "+ref+";")
+			clause = clause[end+1:]
+		case strings.HasPrefix(clause, "*"):
+			_, local := splitAs(clause)
+			if i := strings.IndexByte(local, ','); i >= 0 {
+				local = local[:i]
+			}
+			decls = append(decls, "const "+local+" = "+ref+";")
+			clause = clause[len(clause):]
+		default:
+			local := clause
+			if i := strings.IndexByte(clause, ','); i >= 0 {
+				local = clause[:i]
+			}
+			decls = append(decls, "const "+strings.TrimSpace(local)+" = "+ref+".default;")
+			clause = clause[len(local):]
+		}
+		clause = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(clause), ","))
+	}
+	return strings.Join(decls, " "), nil
+}
+
+// splitAs splits a specifier like "a as b" into "a" and "b". Without "as",
+// both are the name.
+func splitAs(spec string) (string, string) {
+	fields := strings.Fields(spec)
+	switch {
+	case len(fields) == 3 && fields[1] == "as":
+		return fields[0], fields[2]
+	case len(fields) == 1:
+		return fields[0], fields[0]
+	}
+	return "", ""
+}
+
+// addRawText defines a template rendering text as is, unlike addText, since
+// files imported by module scripts aren't templates.
+func (b *builder) addRawText(name, text string) error {
+	t, err := template.New(name).Parse("-")
+	if err != nil {
+		return err
+	}
+	t.Tree.Root.Nodes[0].(*parse.TextNode).Text = []byte(text)
+	b.trees = append(b.trees, t.Tree)
+	b.defined[name] = true
+	b.allNames[name] = true
+	return nil
+}
+
+// moduleGraph returns the import statements hoisted by the named module
+// script sections of a page and the templates holding the files they
+// import, each once, in the order they must be evaluated.
+func (b *builder) moduleGraph(names []string) (hoisted, files []string) {
+	seen := map[string]bool{}
+	var visit func(key string)
+	visit = func(key string) {
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		info := b.modules[key]
+		for _, h := range info.hoisted {
+			if !seen[h] {
+				seen[h] = true
+				hoisted = append(hoisted, h)
+			}
+		}
+		for _, dep := range info.imports {
+			visit(dep)
+		}
+		if strings.HasPrefix(key, modulePrefix) {
+			files = append(files, key)
+		}
+	}
+	for _, name := range names {
+		visit(strings.TrimSuffix(name, "#script"))
+	}
+	return hoisted, files
+}
+
+// moduleTag returns the <script type="module"> bundling the named module
+// script sections of a page, preceded by each file they import.
+func (b *builder) moduleTag(names []string) string {
+	hoisted, files := b.moduleGraph(names)
+	attrs := ""
+	if b.opts.Nonce != "" {
+		attrs = ` nonce="{{` + b.opts.Nonce + `}}"`
+	}
+	src := `<script type="module"` + attrs + ">\n"
+	if len(hoisted) > 0 {
+		src += strings.Join(hoisted, "\n") + "\n"
+	}
+	src += "const __modules = {};\n"
+	if len(files) > 0 {
+		src += includes(files) + "\n"
+	}
+	return src + includes(names) + "\n</script>"
+}
+
+// inlineModuleTag returns a <script type="module"> holding a module script
+// section which isn't bundled. Each has a tag of its own, since the imports
+// of separate components may bind the same names.
+func (b *builder) inlineModuleTag(name string) string {
+	attrs := ""
+	if b.opts.Nonce != "" {
+		attrs = ` nonce="{{` + b.opts.Nonce + `}}"`
+	}
+	return `<script type="module"` + attrs + ">\n" + includes([]string{name}) + "\n</script>"
+}
+
+// modulePreloads returns <link rel="modulepreload"> tags for the modules a
+// page loads by URL, once each: the external module scripts among its
+// scripts, and the URLs imported by its bundled modules. See
+// Options.ModulePreload.
+func (b *builder) modulePreloads(scripts, modules []string) string {
+	var links []string
+	seen := map[string]bool{}
+	add := func(href, attrs string) {
+		if !seen[href] {
+			seen[href] = true
+			links = append(links, `<link rel="modulepreload" href="`+
+				template.HTMLEscapeString(href)+`"`+attrs+`>`)
+		}
+	}
+	for _, part := range scripts {
+		a := b.assets[part]
+		if a == nil || !b.moduleScripts[a.Component] {
+			continue
+		}
+		attrs := ""
+		if b.opts.Integrity {
+			attrs = ` integrity="` + a.Integrity + `" crossorigin="anonymous"`
+		}
+		add(assetURL(b.opts.AssetPrefix, a), attrs)
+	}
+	hoisted, _ := b.moduleGraph(modules)
+	for _, h := range hoisted {
+		// bare specifiers, e.g. "lit", need an import map to resolve
+		spec := importRE.FindStringSubmatch(h)[2]
+		if strings.HasPrefix(spec, "/") || strings.Contains(spec, "://") {
+			add(spec, "")
+		}
+	}
+	if len(links) == 0 {
+		return ""
+	}
+	return strings.Join(links, "\n") + "\n"
+}
@@ -0,0 +1,91 @@
+package component
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// moduleSources are components with module scripts importing the same
+// name, which can't share a module unless bundled, and a classic script.
+var moduleSources = map[string]string{
+	"a": `<script type="module">import { x } from "https://cdn.example.com/x.js";
+x("a");</script><template>a</template>`,
+	"b": `<script type="module">import { x } from "https://cdn.example.com/x.js";
+x("b");</script><template>b</template>`,
+	"c":    `<script>var c = 1;</script><template>c</template>`,
+	"page": `<template>{{ template "./a" }}{{ template "./b" }}{{ template "./c" }}</template>`,
+}
+
+func TestInlineModuleScripts(t *testing.T) {
+	tmpl, _ := compileMap(t, Options{}, moduleSources)
+	page := render(t, tmpl, "page", nil)
+	if n := strings.Count(page, `<script type="module">`); n != 2 {
+		t.Errorf("%d module tags, want one each:\n%s", n, page)
+	}
+	classic := page[strings.Index(page, "<script>"):]
+	classic = classic[:strings.Index(classic, "</script>")]
+	if strings.Contains(classic, "import") || !strings.Contains(classic, "var c") {
+		t.Errorf("classic script %q", classic)
+	}
+
+	for _, opts := range []Options{{}, {ExternalAssets: true}} {
+		tmpl, _ := compileMap(t, opts, moduleSources)
+		_, js, err := PageAssets(tmpl, "page")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if js != "var c = 1;" {
+			t.Errorf("%+v: PageAssets js %q, want only the classic script", opts, js)
+		}
+	}
+}
+
+func TestModulePreload(t *testing.T) {
+	src := map[string]string{}
+	for name, s := range moduleSources {
+		src[name] = s
+	}
+	// including a component twice doesn't repeat its hint
+	src["page"] = `<template>{{ template "./a" }}{{ template "./a" }}{{ template "./b" }}{{ template "./c" }}</template>`
+	opts := Options{ExternalAssets: true, Integrity: true, ModulePreload: true}
+	tmpl, meta := compileMap(t, opts, src)
+	page := render(t, tmpl, "page", nil)
+	if n := strings.Count(page, `rel="modulepreload"`); n != 2 {
+		t.Errorf("%d modulepreload hints, want one per module:\n%s", n, page)
+	}
+	for _, a := range meta.Assets {
+		hint := `<link rel="modulepreload" href="/` + a.Path + `" integrity="` +
+			a.Integrity + `" crossorigin="anonymous">`
+		if has := strings.Contains(page, hint); has != a.Module {
+			t.Errorf("%s: hint %v, want one only for modules:\n%s", a.Path, has, page)
+		}
+	}
+
+	opts.ModulePreload = false
+	tmpl, _ = compileMap(t, opts, src)
+	if page := render(t, tmpl, "page", nil); strings.Contains(page, "modulepreload") {
+		t.Errorf("hints without ModulePreload:\n%s", page)
+	}
+
+	// bundled modules hint each URL they import once
+	dir := writeDir(t, map[string]string{
+		"a.tmpl": `<script type="module">import { x } from "https://cdn.example.com/x.js";
+import { fmt } from "./util.js";
+x(fmt("a"));</script><template>a</template>`,
+		"b.tmpl": `<script type="module">import { x } from "https://cdn.example.com/x.js";
+import { html } from "lit";
+x(html("b"));</script><template>b</template>`,
+		"util.js":   `export function fmt(s) { return s; }`,
+		"page.tmpl": `<template>{{ template "./a" }}{{ template "./b" }}</template>`,
+	})
+	tmpl, err := CompileDir(dir, nil, Options{BundleModules: true, ModulePreload: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	page = render(t, tmpl, "page", nil)
+	hints := regexp.MustCompile(`<link rel="modulepreload" href="([^"]*)">`).FindAllStringSubmatch(page, -1)
+	if len(hints) != 1 || hints[0][1] != "https://cdn.example.com/x.js" {
+		t.Errorf("hints %q, want only the imported URL once:\n%s", hints, page)
+	}
+}
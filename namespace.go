@@ -0,0 +1,173 @@
+package component
+
+import (
+	"fmt"
+	"strings"
+)
+
+// namespace returns the form of a component's name its classes, IDs, and
+// global identifiers must begin with, compared case-insensitively and
+// ignoring "-" and "_", e.g. "listitem" for "list/item", which
+// ".list-item-title" and "listItemAdd" both begin with. See
+// Options.EnforceNamespacing.
+func namespace(name string) string {
+	return normalizeIdent(strings.ReplaceAll(name, "/", ""))
+}
+
+// normalizeIdent lowercases an identifier and removes its separators.
+func normalizeIdent(s string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", "_", "").Replace(s))
+}
+
+// checkNamespacing fails if a component's style uses a class or ID, or its
+// script declares a global, which doesn't begin with the component's
+// namespace. A scoped style isn't checked, since it's already confined to
+// the component.
+func checkNamespacing(c *component, scoped bool) error {
+	ns := namespace(c.name)
+	var violations []string
+	if !scoped {
+		var walk func(rules []*cssRule)
+		walk = func(rules []*cssRule) {
+			for _, r := range rules {
+				switch r.kind {
+				case cssAtGroup:
+					walk(r.rules)
+				case cssQualified:
+					for _, sel := range splitSelectors(r.prelude) {
+						for _, name := range selectorNames(sel) {
+							if !strings.HasPrefix(normalizeIdent(name[1:]), ns) {
+								violations = append(violations, fmt.Sprintf(
+									"selector %q uses %s", sel, name))
+							}
+						}
+					}
+				}
+			}
+		}
+		walk(parseCSS(string(c.sections["style"])))
+	}
+	for _, name := range scriptGlobals(string(c.sections["script"])) {
+		if !strings.HasPrefix(normalizeIdent(name), ns) {
+			violations = append(violations, fmt.Sprintf("script declares %s", name))
+		}
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s isn't namespaced: %s", c.name, strings.Join(violations, "; "))
+}
+
+// selectorNames returns the classes and IDs in a selector with their
+// leading "." or "#", e.g. ".card" and "#main". Those within :global(...)
+// or template actions are skipped.
+func selectorNames(sel string) []string {
+	var names []string
+	for i := 0; i < len(sel); i++ {
+		switch c := sel[i]; {
+		case strings.HasPrefix(sel[i:], "{{"):
+			i = skipAction(sel, i) - 1
+		case strings.HasPrefix(sel[i:], ":global("):
+			i = skipArgs(sel, i+len(":global"), '(', ')') - 1
+		case c == '"' || c == '\'':
+			i = skipString(sel, i) - 1
+		case c == '[':
+			i = skipArgs(sel, i, '[', ']') - 1
+		case c == '.' || c == '#':
+			end := skipIdent(sel, i+1)
+			if end > i+1 {
+				names = append(names, sel[i:end])
+			}
+			i = end - 1
+		}
+	}
+	return names
+}
+
+// declKeywords begin declarations of global names at the top level of a
+// script.
+var declKeywords = map[string]bool{
+	"function": true,
+	"class":    true,
+	"var":      true,
+	"let":      true,
+	"const":    true,
+}
+
+// scriptGlobals returns the names a script declares at its top level, e.g.
+// "tableAddRow" for "function tableAddRow() {...}". It's lightweight rather
+// than a JavaScript parser: only the first name of each declaration is
+// found, and it may be confused by regular expression literals containing
+// braces or quotes.
+func scriptGlobals(src string) []string {
+	var names []string
+	depth := 0
+	prev := byte(0) // the last non-space character
+	next := false   // whether the next identifier is declared
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case strings.HasPrefix(src[i:], "{{"):
+			i = skipAction(src, i)
+			continue
+		case strings.HasPrefix(src[i:], "//"):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+			continue
+		case strings.HasPrefix(src[i:], "/*"):
+			i = skipComment(src, i)
+			continue
+		case c == '"' || c == '\'':
+			i = skipString(src, i)
+		case c == '`':
+			for i++; i < len(src) && src[i] != '`'; i++ {
+				if src[i] == '\\' {
+					i++
+				}
+			}
+			i++
+		case c == '{' || c == '(' || c == '[':
+			depth++
+			i++
+		case c == '}' || c == ')' || c == ']':
+			if depth > 0 {
+				depth--
+			}
+			i++
+		case isJSIdentStart(c):
+			start := i
+			for i < len(src) && (isJSIdentStart(src[i]) || (src[i] >= '0' && src[i] <= '9')) {
+				i++
+			}
+			word := src[start:i]
+			switch {
+			case depth > 0 || prev == '.':
+			case next:
+				names = append(names, word)
+				next = false
+			case declKeywords[word]:
+				next = true
+			}
+			prev = src[i-1]
+			continue
+		case isSpace(c):
+			i++
+			continue
+		default:
+			i++
+		}
+		if c != '*' {
+			// generators are declared with function*
+			next = false
+		}
+		prev = c
+	}
+	return names
+}
+
+// isJSIdentStart reports whether c may begin a JavaScript identifier.
+func isJSIdentStart(c byte) bool {
+	return c == '_' || c == '$' || c >= 0x80 ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
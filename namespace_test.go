@@ -0,0 +1,35 @@
+package component
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEnforceNamespacing(t *testing.T) {
+	opts := Options{EnforceNamespacing: true}
+	tmpl, _ := compileMap(t, opts, map[string]string{
+		"list/item": `<style>.list-item-title { color: red; } #listItem_main { margin: 0; }
+:global(.other) .list-item { padding: 0; }</style>
+<script>function listItemAdd() {}
+var LIST_ITEM_COUNT = 0;</script>
+<template><p class="list-item-title">hi</p></template>`,
+	})
+	if page := render(t, tmpl, "list/item", nil); !strings.Contains(page, "listItemAdd") {
+		t.Errorf("page:\n%s", page)
+	}
+
+	_, _, err := NewCompiler(opts).Map(map[string][]byte{
+		"list/item": []byte(`<style>.title { color: red; }</style>
+<script>function add() {}</script>
+<template><p class="title">hi</p></template>`),
+	})
+	for _, want := range []string{
+		"list/item isn't namespaced",
+		`selector ".title" uses .title`,
+		"script declares add",
+	} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("err = %v, want %q", err, want)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package component
+
+import (
+	"strings"
+	"text/template/parse"
+
+	"golang.org/x/net/html"
+)
+
+// rawTextElements hold text which html/template doesn't treat as HTML,
+// e.g. JavaScript, so actions within them are escaped differently.
+var rawTextElements = map[string]bool{
+	"iframe":    true,
+	"noembed":   true,
+	"noframes":  true,
+	"noscript":  true,
+	"plaintext": true,
+	"script":    true,
+	"style":     true,
+	"textarea":  true,
+	"title":     true,
+	"xmp":       true,
+}
+
+// htmlTextRanges returns the byte ranges of template section markup which
+// are ordinary HTML text, i.e. outside tags, comments, and raw text
+// elements like <script>.
+func htmlTextRanges(src []byte) ([][2]int, error) {
+	toks, err := tokenizeMarkup(src)
+	if err != nil {
+		return nil, err
+	}
+	var ranges [][2]int
+	raw := ""
+	for _, t := range toks {
+		switch t.Type {
+		case html.StartTagToken:
+			if rawTextElements[t.Data] {
+				raw = t.Data
+			}
+		case html.EndTagToken:
+			if t.Data == raw {
+				raw = ""
+			}
+		case html.TextToken:
+			if raw == "" {
+				ranges = append(ranges, [2]int{t.start, t.end})
+			}
+		}
+	}
+	return ranges, nil
+}
+
+// optimizer folds constant expressions in parse trees. See Options.Optimize.
+type optimizer struct {
+	// text holds the ranges of the parsed source where printing a string
+	// is equivalent to writing it as text. Strings are never folded
+	// elsewhere, since html/template escapes them by context.
+	text [][2]int
+}
+
+// inText reports whether pos is within one of the optimizer's text ranges.
+func (o *optimizer) inText(pos parse.Pos) bool {
+	for _, r := range o.text {
+		if int(pos) >= r[0] && int(pos) < r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// fold rewrites a list, replacing if actions having constant conditions
+// with the branch taken, and actions printing constant strings which need
+// no escaping with text.
+func (o *optimizer) fold(ln *parse.ListNode) {
+	if ln == nil {
+		return
+	}
+	var out []parse.Node
+	for _, n := range ln.Nodes {
+		switch t := n.(type) {
+		case *parse.IfNode:
+			if truth, ok := constTruth(t.Pipe); ok {
+				branch := t.ElseList
+				if truth {
+					branch = t.List
+				}
+				if branch != nil {
+					o.fold(branch)
+					out = append(out, branch.Nodes...)
+				}
+				continue
+			}
+			o.fold(t.List)
+			o.fold(t.ElseList)
+		case *parse.RangeNode:
+			o.fold(t.List)
+			o.fold(t.ElseList)
+		case *parse.WithNode:
+			o.fold(t.List)
+			o.fold(t.ElseList)
+		case *parse.ActionNode:
+			arg, ok := constArg(t.Pipe)
+			s, isString := arg.(string)
+			if ok && isString && !strings.ContainsAny(s, "&'<>\"+\x00") &&
+				o.inText(t.Pos) {
+				n = &parse.TextNode{NodeType: parse.NodeText, Pos: t.Pos, Text: []byte(s)}
+			}
+		}
+		out = append(out, n)
+	}
+	ln.Nodes = mergeText(out)
+}
+
+// constTruth returns whether a constant pipeline is true as an if action
+// would evaluate it.
+func constTruth(pipe *parse.PipeNode) (truth, ok bool) {
+	if pipe == nil {
+		return false, false
+	}
+	arg, ok := constArg(pipe)
+	if !ok {
+		return false, false
+	}
+	switch v := arg.(type) {
+	case bool:
+		return v, true
+	case string:
+		return v != "", true
+	case int:
+		return v != 0, true
+	case float64:
+		return v != 0, true
+	}
+	// {{ if nil }} is an error at runtime, so leave it be
+	return false, false
+}
+
+// mergeText joins adjacent text nodes.
+func mergeText(nodes []parse.Node) []parse.Node {
+	out := nodes[:0]
+	for _, n := range nodes {
+		t, ok := n.(*parse.TextNode)
+		if !ok || len(out) == 0 {
+			out = append(out, n)
+			continue
+		}
+		prev, ok := out[len(out)-1].(*parse.TextNode)
+		if !ok {
+			out = append(out, n)
+			continue
+		}
+		text := make([]byte, 0, len(prev.Text)+len(t.Text))
+		text = append(append(text, prev.Text...), t.Text...)
+		out[len(out)-1] = &parse.TextNode{
+			NodeType: parse.NodeText,
+			Pos:      prev.Pos,
+			Text:     text,
+		}
+	}
+	return out
+}
@@ -0,0 +1,41 @@
+package component
+
+import (
+	"testing"
+)
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		name, src, want string
+	}{
+		{"if true", `{{ if true }}A{{ else }}B{{ end }}`, `A`},
+		{"if false", `{{ if false }}A{{ else }}B{{ end }}`, `B`},
+		{"empty string", `{{ if "" }}A{{ end }}!`, `!`},
+		{"zero", `{{ if 0 }}A{{ else }}B{{ end }}`, `B`},
+		{"nested", `{{ if true }}{{ if false }}A{{ else }}B{{ end }}{{ end }}`, `B`},
+		{"within range", `{{ range . }}{{ if 1 }}A{{ end }}{{ end }}`, `{{range .}}A{{end}}`},
+		{"string", `<p>{{ "x" }}</p>`, `<p>x</p>`},
+		{"data", `{{ if . }}A{{ end }}`, `{{if .}}A{{end}}`},
+		{"function", `<p>{{ printf "x" }}</p>`, `<p>{{printf "x"}}</p>`},
+		// html/template would escape these, so they're left to it
+		{"needs escaping", `<p>{{ "<b>" }}</p>`, `<p>{{"<b>"}}</p>`},
+		{"attribute", `<a href="{{ "x" }}">a</a>`, `<a href="{{"x"}}">a</a>`},
+		{"script", `<script>var s = {{ "x" }};</script>`, `<script>var s = {{"x"}};</script>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := map[string]string{"c": "<template>" + tt.src + "</template>"}
+			tmpl, _ := compileMap(t, Options{Optimize: true}, src)
+			if got := tmpl.Lookup("c#template").Tree.Root.String(); got != tt.want {
+				t.Errorf("folded to %q, want %q", got, tt.want)
+			}
+			// folding never changes what's rendered
+			data := []int{1, 2}
+			plain, _ := compileMap(t, Options{}, src)
+			got := render(t, tmpl, "c", data)
+			if want := render(t, plain, "c", data); got != want {
+				t.Errorf("rendered %q, want %q", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,561 @@
+package component
+
+import (
+	"fmt"
+	"html/template"
+	"io/fs"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Mode selects how components are output.
+type Mode int
+
+const (
+	// ModeServer renders components as plain HTML. It's the default.
+	ModeServer Mode = iota
+
+	// ModeWebComponents renders each component having a scoped style as a
+	// custom element with a declarative shadow root, e.g. "list/item"
+	// becomes <c-list-item>. The component's style lives within the shadow
+	// root, which scopes it naturally, so its selectors aren't rewritten.
+	//
+	// The component's script becomes the body of the element's class, so
+	// it should contain class members rather than statements, e.g.
+	//
+	//	<script>
+	//		connectedCallback() {
+	//			this.shadowRoot.querySelector("button").focus();
+	//		}
+	//	</script>
+	//
+	// Like any script it's included once per page, wrapped in the
+	// customElements.define call registering the element. Components
+	// without scoped styles are rendered as usual.
+	ModeWebComponents
+)
+
+// Options customize how components are compiled. The zero value compiles
+// components exactly as written.
+type Options struct {
+	// Funcs are the functions available to templates. Functions passed
+	// directly to a Compile function are added to these, taking
+	// precedence.
+	Funcs template.FuncMap
+
+	// Transforms map media types to functions rewriting the sections of
+	// that type, applied in order to each component at compile time, e.g.
+	// to compile <style lang="scss"> to CSS. The media types are
+	// "text/html" for templates, "text/css" for styles,
+	// "application/javascript" for scripts, and "application/ld+json" for
+	// JSON-LD; any other is an error. Custom sections aren't transformed.
+	//
+	// Transforms run first, before any of the transforms built into other
+	// options, so they see sections as written and built-in transforms see
+	// their output. A style is scoped after being transformed, for
+	// example, so a transform compiling SCSS may leave scoping to
+	// <style scoped>. Conversely, a minifier sees the style before it's
+	// scoped. Within a component, the template is transformed first, then
+	// the style, script, and JSON-LD.
+	Transforms map[string][]Transform
+
+	// CollapseWhitespace removes insignificant whitespace from each
+	// component's <template> markup at compile time. Runs of whitespace
+	// are collapsed to a single space, and whitespace beside block-level
+	// elements is removed entirely. Whitespace within <pre>, <textarea>,
+	// <script>, and <style> elements and within template actions is left
+	// untouched.
+	//
+	// Elements styled with "white-space: pre" can't be detected, so avoid
+	// this option for components which rely on that.
+	CollapseWhitespace bool
+
+	// Pretty indents each component's <template> markup by element depth
+	// at compile time, so rendered pages are readable in view-source while
+	// debugging. Only insignificant whitespace changes: whitespace spanning
+	// lines is re-indented, and block-level elements are put on their own
+	// lines. <pre>, <textarea>, <script>, and <style> elements are left
+	// untouched. Output is compact as written by default.
+	Pretty bool
+
+	// InlineStatic renders includes of pure components at compile time
+	// when the include's argument is a constant, e.g.
+	// {{ template "./icon" "check" }}, replacing the include with its
+	// output. Mark a component as pure with <template pure>, promising that
+	// its output depends only on its argument and never on functions with
+	// side effects, the current time, etc. The promise extends to any
+	// components it includes.
+	//
+	// The pure component's style and script are still included in the
+	// page. Since the output is rendered as HTML text, pure components
+	// shouldn't be included within attributes or <script> tags.
+	InlineStatic bool
+
+	// FlattenIncludes expands each include passing its own data, e.g.
+	// {{ template "./card" . }}, into a copy of the included template at
+	// compile time, so a page of static, deeply nested components renders
+	// as one template without looking any up. Includes it can't expand
+	// safely are left as they are: those passing other data, recursive
+	// includes, includes of templates using $, and calls to the include
+	// function, which name their template at render time. Pages grow by
+	// a copy of each component for every include of it.
+	FlattenIncludes bool
+
+	// MaxSectionSize reports a WarnSectionSize warning for any section
+	// larger than this many bytes. Zero disables the check.
+	MaxSectionSize int
+
+	// MaxDepth fails compilation if any component includes others nested
+	// more than this many levels deep, e.g. 2 allows a page to include a
+	// component which includes another, but no further. The error names
+	// the deepest chain of includes. Zero allows any depth.
+	MaxDepth int
+
+	// FollowSymlinks makes CompileDir and Validate follow symlinks to
+	// directories, e.g. a shared component library linked into each app,
+	// which are otherwise skipped. Components within are named by the
+	// link's path. A link to a directory containing it fails rather than
+	// walking forever.
+	FollowSymlinks bool
+
+	// NameFunc names the components read by CompileDir and CompileFS. It's
+	// called with the path of each file not skipped, relative to the
+	// compiled directory and using forward slashes, e.g.
+	// "list/item.tmpl", and returns false to skip the file. By default,
+	// ".tmpl" files are named by their path without the extension, e.g.
+	// "list/item", and other files are skipped.
+	//
+	// References between components resolve by name rather than by file,
+	// so a component named "forms.input" includes one named "forms.label"
+	// with {{ template "./forms.label" . }}, wherever their files are.
+	// Directories in names work as usual, so flattened names put every
+	// component in one directory. Names must be unique, and may not
+	// contain "#", "~", or control characters.
+	NameFunc func(relPath string) (name string, ok bool)
+
+	// ReadTimeout fails compilation if opening and reading any one file
+	// takes longer than this, e.g. from an fs.FS backed by a remote store,
+	// rather than hanging. The error names the file. Zero never times out.
+	ReadTimeout time.Duration
+
+	// Skip excludes files and directories from CompileDir. It's called with
+	// each path relative to the compiled directory, using forward slashes,
+	// e.g. "_fixtures" or "list/item.tmpl". Returning true for a directory
+	// skips everything within it. Skipped components aren't compiled, so
+	// other components can't reference them.
+	Skip func(path string, d fs.DirEntry) bool
+
+	// EnforceNamespacing fails compilation if a component's style uses a
+	// class or ID, or its script declares a top-level function, class, or
+	// variable, whose name doesn't begin with the component's name.
+	// Names are compared ignoring case, "-", "_", and directories, so
+	// "list/item" may use .list-item-title and declare listItemAdd. Scoped
+	// styles and selectors within :global(...) aren't checked.
+	EnforceNamespacing bool
+
+	// Sanitizer, if set, restricts the elements and attributes of every
+	// component's markup to those its policy permits, failing compilation
+	// or stripping the rest, so components written by untrusted authors,
+	// e.g. tenants, can't embed <iframe>s or event handlers. It checks
+	// markup as written, after element includes are resolved and before
+	// other options add attributes of their own. Data rendered by template
+	// actions is escaped by html/template as usual, but functions returning
+	// template.HTML bypass the policy, so don't give those to untrusted
+	// components.
+	Sanitizer *SanitizePolicy
+
+	// A11y enforces accessibility practices in every component's markup,
+	// e.g. requiring alt text for images, reporting each violation by
+	// component. The zero value enforces nothing.
+	A11y A11yPolicy
+
+	// StripComments removes HTML comments from each component's markup at
+	// compile time. Rendering already drops comments, since html/template
+	// does, so this mostly keeps those the author marks: conditional
+	// comments like <!--[if IE]>...<![endif]--> and comments beginning with
+	// "!", e.g. <!--! Licensed under MIT -->, are kept in the output as
+	// written. Kept comments can't contain template actions.
+	StripComments bool
+
+	// LazyImages adds loading="lazy" and decoding="async" to every <img>
+	// in each component's markup, so offscreen images don't delay the
+	// page. Set either attribute on an image to override it, e.g.
+	// loading="eager" for one above the fold.
+	LazyImages bool
+
+	// ExtractInlineHandlers moves inline event handler attributes, e.g.
+	// onclick="...", out of each component's markup and into its script,
+	// so pages work under a Content-Security-Policy forbidding inline
+	// handlers. Elements with handlers are marked with a generated
+	// data-c-handler attribute instead, which the script binds to. Handlers
+	// can't contain template actions, since the script is shared by every
+	// render of the component.
+	ExtractInlineHandlers bool
+
+	// ScriptGuard wraps each component's script so it runs at most once
+	// per document, even when the component is rendered again in a
+	// fragment added to the page later. The guard is a global flag unique
+	// to the component, e.g. window.__c_3f2a9b1c.
+	//
+	// Since the script is wrapped in a block, top-level let, const, and
+	// class declarations are no longer global. Assign to window instead
+	// when a script needs to share them.
+	ScriptGuard bool
+
+	// BundleModules bundles the scripts of components marked
+	// <script type="module"> with the files they import by relative
+	// path, e.g. import { format } from "./util.js", resolved from the
+	// component's file. Each page gets a single module holding its
+	// components' scripts, preceded by every file they import, included
+	// once no matter how many components import it. Other imports, e.g.
+	// of URLs, are moved to the top of the page's module for the browser
+	// to resolve.
+	//
+	// Bundling rewrites static imports and exports written at the start
+	// of a line rather than parsing JavaScript, so it has limits:
+	// imported bindings are copies, not live bindings; import cycles are
+	// an error; only the first name of an exported declaration is
+	// exported; and dynamic import() is left as is. Imported files are
+	// included as written, not compiled as templates. Only components
+	// read from a directory, with CompileDir or CompileFS, can import
+	// files, and module scripts are always inlined, even with
+	// ExternalAssets. They're left out of PageAssets.
+	BundleModules bool
+
+	// ExcludeAssets maps the names of pages to components whose styles
+	// and scripts the page leaves out, e.g. an analytics component on a
+	// privacy-sensitive page. Each entry names a component, or a
+	// directory to exclude every component within, e.g. "analytics" or
+	// "tracking/". The components' markup still renders wherever they're
+	// included, so exclude components which only contribute assets, or
+	// guard their includes with data.
+	ExcludeAssets map[string][]string
+
+	// DeferNonCritical moves the scripts of components to the end of each
+	// page, after its markup, so they don't delay the first paint. If
+	// they're all external, e.g. with ExternalAssets, they're also marked
+	// defer. Scripts marked <script critical> stay in the head, so they
+	// run before the page is painted. Critical scripts can't rely on
+	// deferred ones, which run later.
+	DeferNonCritical bool
+
+	// ModulePreload adds <link rel="modulepreload"> hints to the head of
+	// each page for the modules it loads by URL, so the browser fetches
+	// them early rather than as it discovers each import. There's one
+	// hint per distinct URL on a page: each module script compiled to a
+	// file by ExternalAssets, with its integrity hash if Integrity is set,
+	// and each URL imported by scripts bundled by BundleModules, e.g.
+	// "https://cdn.example.com/lib.js". Inlined scripts need no hints, and
+	// bare imports like "lit" aren't hinted, since they'd need an import
+	// map to resolve.
+	ModulePreload bool
+
+	// ExternalAssets compiles each component's style and script to a
+	// separate file rather than inlining it into every page, returning the
+	// files in Meta.Assets. Pages reference them with <link> and <script
+	// src> tags, keeping their original order. Only static sections, i.e.
+	// those without template actions, can be compiled to files; sections
+	// with actions are still inlined. Scripts marked <script type="module">
+	// are referenced with <script type="module" src>, and styles marked
+	// <style media="..."> with <link media>.
+	//
+	// Asset paths are fingerprinted with a hash of their content, e.g.
+	// "list/item.1a2b3c4d.css", so they may be cached indefinitely.
+	//
+	// Static scripts marked <script vendor>, e.g. third-party libraries,
+	// are bundled into a single file instead, "vendor.1a2b3c4d.js", apart
+	// from the components' own scripts. Since libraries change less often
+	// than the app, the bundle stays cached across most deploys. Every
+	// page with a vendor script includes the whole bundle, ahead of its
+	// other scripts.
+	ExternalAssets bool
+
+	// Integrity adds subresource integrity hashes to the tags referencing
+	// external assets, along with crossorigin="anonymous". Inline styles
+	// and scripts never have integrity hashes.
+	Integrity bool
+
+	// Nonce adds a CSP nonce to every inline <style> and <script> tag in
+	// the document. It's a template pipeline evaluated with the page's
+	// data, e.g. ".Nonce" or "cspNonce .", since nonces differ per
+	// request. External assets never have nonces; use Integrity instead.
+	Nonce string
+
+	// AssetPrefix is prepended to the path of each external asset in the
+	// tags referencing it, e.g. "https://cdn.example.com/" to serve
+	// assets from a CDN. It defaults to "/", the site root.
+	AssetPrefix string
+
+	// Mode selects how components are output. The default, ModeServer,
+	// renders plain HTML.
+	Mode Mode
+
+	// InlineImagesBelow replaces images referenced by relative URLs in
+	// each component's style, e.g. url(./icon.png), with data URIs when
+	// they're smaller than this many bytes, saving a request for each.
+	// Paths are relative to the component's file. Larger images, missing
+	// files, and absolute URLs are left as is. Only components read from
+	// a directory, with CompileDir or CompileFS, have images inlined. Zero
+	// inlines none.
+	InlineImagesBelow int64
+
+	// DedupStrategy chooses how duplicate styles and scripts are found on
+	// each page. The default, DedupByComponent, includes each component's
+	// once. DedupByContent also drops styles and scripts identical to one
+	// of another component already on the page. It hashes every static
+	// style and script when compiling, which costs time in proportion to
+	// their size, so only use it when components duplicate assets.
+	DedupStrategy DedupStrategy
+
+	// DedupAtRules collapses identical @keyframes and @font-face rules
+	// declared by different components, so each is included once per page
+	// no matter how many components on the page declare it. Rules are
+	// identical when they only differ in whitespace. The rules are moved
+	// ahead of the components' other styles.
+	DedupAtRules bool
+
+	// Unscoped compiles <style scoped> like any other style, so selectors
+	// aren't rewritten and elements have no scoping attributes. It's
+	// useful for channels which restyle components, like print.
+	Unscoped bool
+
+	// SVGSymbols defines the markup of SVG components, i.e. those whose
+	// <template> is a single <svg> element without template actions,
+	// only once per page as a <symbol>. Each use of the component renders
+	// a lightweight <svg> referring to the symbol instead, so icons used
+	// many times on a page don't repeat their path data.
+	SVGSymbols bool
+
+	// Logger, if set, receives events as compilation progresses, such as
+	// each file found and section compiled, which helps debug unexpected
+	// builds. Nothing is logged by default.
+	Logger Logger
+
+	// NoAssetBundling leaves styles and scripts out of pages entirely,
+	// for use with an external bundler. Pages render only their markup,
+	// without the surrounding <html> document, and each component's style
+	// and script is returned in Meta.Assets instead. Sections with
+	// template actions can't be bundled, so they're discarded with a
+	// warning.
+	NoAssetBundling bool
+
+	// GroupMedia combines the top-level @media rules of every component
+	// on a page which share a query into a single @media block, placed
+	// after the page's other styles. This shrinks pages built from many
+	// components with the same breakpoints. Moving the rules later may
+	// change which of two equally specific rules wins, so media rules
+	// should be written to override the base styles. Styles with template
+	// actions are left as-is.
+	GroupMedia bool
+
+	// WarnNoAssets reports a warning for each component included by
+	// others which has no style or script, which helps debug styles
+	// missing from a page. They're listed in Meta.Warnings as the
+	// WarnNoAssets kind.
+	WarnNoAssets bool
+
+	// StrictHTML fails compilation when a component's markup isn't
+	// well-formed in ways browsers silently repair, but stricter
+	// consumers like HTML-to-PDF renderers may not: mismatched or missing
+	// end tags, non-void elements written as self-closing, and block
+	// elements nested within a <p>. Optional end tags, e.g. </li>, are
+	// required. Every branch of a conditional must be well-formed on its
+	// own, since template actions are ignored.
+	StrictHTML bool
+
+	// StrictSections fails compilation when a component file contains
+	// anything at the top level besides its sections and comments, such as
+	// stray text or a second <template>, which would otherwise be dropped
+	// or merged into the first. The error quotes the offending content.
+	StrictSections bool
+
+	// Themes adds the custom properties, or tokens, of each theme to the
+	// styles of every page, so components share one style however they're
+	// themed, e.g. light and dark themes setting --bg and --fg for
+	// components using "background: var(--bg)". Tokens used by a component
+	// which no theme or component declares are reported as
+	// WarnUndefinedToken warnings.
+	Themes []Theme
+
+	// DevReload adds a script to every page which reloads it when the
+	// Reloader served at this path, e.g. "/_reload", says to. It's meant
+	// only for development, so leave it empty in production.
+	DevReload string
+
+	// DefaultPage is the page RenderPage renders in place of a page which
+	// doesn't exist, e.g. "not-found", so servers can fall back to it
+	// rather than handle the error at every call site. Compilation fails
+	// if it isn't a page.
+	DefaultPage string
+
+	// EnforceSectionOrder fails compilation if any component lists its
+	// sections in a different order, e.g.
+	// []string{"template", "style", "script"}. Sections are named as
+	// usual even when renamed by Tags. Sections not listed may appear
+	// anywhere, and missing sections are fine. Empty allows any order.
+	EnforceSectionOrder []string
+
+	// CustomSections adds sections beyond style, script, and template,
+	// mapping each section's tag to where pages place it, e.g.
+	// {"schema": component.PlaceHead} for <schema> sections holding
+	// JSON-LD. Like styles and scripts, a page includes the custom
+	// sections of every component it includes once, in dependency order.
+	// Custom sections hold markup, so wrap their content in the element
+	// it belongs in, e.g. <script type="application/ld+json">. They're
+	// left out when NoAssetBundling is set.
+	CustomSections map[string]Placement
+
+	// Tags renames the tags delimiting a component's sections, e.g. for
+	// editors which treat <template> specially.
+	Tags SectionTags
+
+	// Optimize folds constant expressions at compile time, e.g.
+	// {{ if true }}A{{ else }}B{{ end }} becomes A. Only literal
+	// constants are folded, never function calls or data, and printed
+	// strings are only folded where html/template wouldn't change them,
+	// i.e. in HTML text without characters needing escaping.
+	Optimize bool
+}
+
+// SectionTags are the names of the tags delimiting each section of a
+// component. Empty fields keep the default tag, e.g.
+//
+//	component.Options{Tags: component.SectionTags{Template: "markup"}}
+//
+// accepts <markup> in place of <template>, leaving <style> and <script> as
+// they are. Once renamed, the default tag is no longer a section, so a
+// <template> within <markup> is simply markup.
+type SectionTags struct {
+	Style    string
+	Script   string
+	Template string
+}
+
+// DedupStrategy is how pages detect duplicate styles and scripts. See
+// Options.DedupStrategy.
+type DedupStrategy int
+
+const (
+	// DedupByComponent includes each component's style and script once
+	// per page, however many times the component is included. It's the
+	// default.
+	DedupByComponent DedupStrategy = iota
+
+	// DedupByContent also includes byte-identical styles and scripts of
+	// different components once per page, e.g. a style copied between
+	// components. Sections with template actions are never identical,
+	// since they may render differently.
+	DedupByContent
+
+	// DedupBoth is the same as DedupByContent, since a component's own
+	// assets are never included twice. It's spelled out for clarity.
+	DedupBoth
+)
+
+// Placement is where pages place a custom section. See
+// Options.CustomSections.
+type Placement int
+
+const (
+	// PlaceHead places the section after the page's styles and scripts,
+	// before its markup.
+	PlaceHead Placement = iota
+
+	// PlaceEnd places the section at the end of the page, after its
+	// markup.
+	PlaceEnd
+)
+
+// reservedSections can't be custom sections, since they're sections
+// already or name templates generated for each page.
+var reservedSections = map[string]bool{
+	"style":       true,
+	"script":      true,
+	"template":    true,
+	"symbol":      true,
+	"css":         true,
+	"js":          true,
+	"cache":       true,
+	"preview":     true,
+	"progressive": true,
+	"jsonld":      true,
+	"requires":    true,
+}
+
+// sectionTags maps each tag name to the section it delimits, including
+// custom sections.
+func (o Options) sectionTags() (map[string]string, error) {
+	tags := o.Tags.byTag()
+	tags[jsonLDSection] = jsonLDSection
+	for section, place := range o.CustomSections {
+		if reservedSections[section] || strings.HasPrefix(section, "progressive-") ||
+			!customSectionRE.MatchString(section) {
+			return nil, fmt.Errorf("invalid custom section %q", section)
+		}
+		if place != PlaceHead && place != PlaceEnd {
+			return nil, fmt.Errorf("invalid placement of custom section %s", section)
+		}
+		if _, ok := tags[section]; ok {
+			return nil, fmt.Errorf("custom section %s is already a tag", section)
+		}
+		tags[section] = section
+	}
+	return tags, nil
+}
+
+// customSectionRE matches valid names of custom sections.
+var customSectionRE = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+// byTag maps each tag name to the section it delimits.
+func (t SectionTags) byTag() map[string]string {
+	tags := map[string]string{}
+	add := func(tag, section string) {
+		if tag == "" {
+			tag = section
+		}
+		tags[strings.ToLower(tag)] = section
+	}
+	add(t.Style, "style")
+	add(t.Script, "script")
+	add(t.Template, "template")
+	return tags
+}
+
+// check returns an error if two sections are delimited by the same tag,
+// e.g. Template: "style", since a tag can only delimit one.
+func (t SectionTags) check() error {
+	seen := map[string]string{}
+	for _, s := range []struct{ tag, section string }{
+		{t.Style, "style"},
+		{t.Script, "script"},
+		{t.Template, "template"},
+	} {
+		tag := s.tag
+		if tag == "" {
+			tag = s.section
+		}
+		tag = strings.ToLower(tag)
+		if other, ok := seen[tag]; ok {
+			return fmt.Errorf("sections %s and %s are both delimited by <%s>",
+				other, s.section, tag)
+		}
+		seen[tag] = s.section
+	}
+	return nil
+}
+
+// getOptions returns the Options passed to a variadic compile function, at
+// most one of which may be given.
+func getOptions(opts []Options) (Options, error) {
+	switch len(opts) {
+	case 0:
+		return Options{}, nil
+	case 1:
+		if err := opts[0].Tags.check(); err != nil {
+			return Options{}, err
+		}
+		return opts[0], nil
+	}
+	return Options{}, fmt.Errorf("%d Options given, but at most one may be", len(opts))
+}
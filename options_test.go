@@ -0,0 +1,35 @@
+package component
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSectionTags(t *testing.T) {
+	opts := Options{Tags: SectionTags{Template: "markup"}}
+	tmpl, _ := compileMap(t, opts, map[string]string{
+		"page": `<style>p { color: red; }</style>
+<markup><p>Hi</p><template><b>inert</b></template></markup>`,
+	})
+	page := render(t, tmpl, "page", nil)
+	for _, want := range []string{"color: red", "<p>Hi</p><template><b>inert</b></template>"} {
+		if !strings.Contains(page, want) {
+			t.Errorf("page missing %s:\n%s", want, page)
+		}
+	}
+
+	for _, tc := range []struct {
+		tags SectionTags
+		want string
+	}{
+		{SectionTags{Template: "style"}, "sections style and template"},
+		{SectionTags{Script: "STYLE"}, "sections style and script"},
+		{SectionTags{Style: "x", Template: "x"}, "sections style and template"},
+	} {
+		src := []Source{{Name: "page", Content: []byte("<template></template>")}}
+		_, err := CompileSources(src, nil, Options{Tags: tc.tags})
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%+v: want error naming %s, got %v", tc.tags, tc.want, err)
+		}
+	}
+}
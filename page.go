@@ -0,0 +1,125 @@
+package component
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// CompilePage compiles only the named page of a directory and the
+// components it includes, transitively, rather than every component like
+// CompileDir. Files are read as they're found to be included, so a process
+// rendering one known page from a large library reads and parses just what
+// it needs. Including a component which doesn't exist is an error.
+//
+// Components are found by their paths, so Options.NameFunc isn't
+// supported, and Options.Skip isn't consulted. Other Options apply as
+// usual.
+func CompilePage(
+	dirname, page string,
+	fns template.FuncMap,
+	opts ...Options,
+) (*template.Template, error) {
+	opt, err := getOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	opt = withFuncs(opt, fns)
+	if opt.NameFunc != nil {
+		return nil, errors.New("CompilePage doesn't support NameFunc")
+	}
+	if err := checkDir(dirname); err != nil {
+		return nil, err
+	}
+	// only the page's exclusions can apply
+	if excluded, ok := opt.ExcludeAssets[page]; ok {
+		opt.ExcludeAssets = map[string][]string{page: excluded}
+	} else {
+		opt.ExcludeAssets = nil
+	}
+	file := func(name string) string {
+		return filepath.Join(dirname, filepath.FromSlash(name)+".tmpl")
+	}
+	exists := func(name string) bool {
+		fi, err := os.Stat(file(name))
+		return err == nil && !fi.IsDir()
+	}
+	// add each component to a builder of its own as it's found, only to
+	// learn what it includes
+	find := newBuilder(opt)
+	find.exists = exists
+	var comps []*component
+	from := map[string]string{page: ""}
+	queue := []string{page}
+	for i := 0; i < len(queue); i++ {
+		name := queue[i]
+		if err := checkName(name); err != nil {
+			return nil, err
+		}
+		if !exists(name) {
+			if from[name] == "" {
+				return nil, fmt.Errorf("page %s doesn't exist", name)
+			}
+			return nil, fmt.Errorf("%s includes %s, which doesn't exist", from[name], name)
+		}
+		c, err := readComponent(name, file(name), opt)
+		if err != nil {
+			return nil, err
+		}
+		comps = append(comps, c)
+		find.known[name] = true
+		if err := find.add(c.deepClone()); err != nil {
+			return nil, err
+		}
+		deps := make([]string, 0, len(find.dependencies[name]))
+		for dep := range find.dependencies[name] {
+			deps = append(deps, dep)
+		}
+		// components named by after directives must be compiled too,
+		// though they needn't be on the page
+		deps = append(deps, find.after[name]...)
+		// as must those whose sections are included explicitly
+		for ref := range find.sectionRefs[name] {
+			deps = append(deps, ref[:strings.IndexByte(ref, '#')])
+		}
+		// read in a fixed order so errors are consistent
+		sort.Strings(deps)
+		for _, dep := range deps {
+			if _, ok := from[dep]; !ok {
+				from[dep] = name
+				queue = append(queue, dep)
+			}
+		}
+	}
+	t, _, err := compile(comps, opt)
+	return t, err
+}
+
+// readComponent reads and parses the component in a file.
+func readComponent(name, fpath string, opt Options) (*component, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return nil, errors.Wrap(err, "open file")
+	}
+	defer f.Close()
+	c, err := parseComponent(name, fpath, f, opt)
+	if err != nil {
+		return nil, errors.Wrap(err, fpath)
+	}
+	return c, nil
+}
+
+// deepClone returns a copy of c which shares no memory with it, so adding
+// one to a builder can't affect the other.
+func (c *component) deepClone() *component {
+	cp := c.clone()
+	for k, v := range cp.sections {
+		cp.sections[k] = append([]byte(nil), v...)
+	}
+	return cp
+}
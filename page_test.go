@@ -0,0 +1,47 @@
+package component
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompilePage(t *testing.T) {
+	dir := writeDir(t, map[string]string{
+		"page.tmpl":       `<template>{{ template "./parts/nav" }}</template>`,
+		"parts/nav.tmpl":  `<style>nav { color: red; }</style><template><nav>{{ template "./link" }}</nav></template>`,
+		"parts/link.tmpl": `<template><a href="/">home</a></template>`,
+		// never read, or it would fail the compile
+		"broken.tmpl": `<template>{{ if }}</template>`,
+		"bad.tmpl":    `<template>{{ template "./missing" }}</template>`,
+	})
+	tmpl, err := CompilePage(dir, "page", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := render(t, tmpl, "page", nil)
+	for _, want := range []string{"nav { color: red; }", `<nav><a href="/">home</a></nav>`} {
+		if !strings.Contains(page, want) {
+			t.Errorf("page missing %s:\n%s", want, page)
+		}
+	}
+	for _, name := range []string{"broken", "bad"} {
+		if tmpl.Lookup(name) != nil {
+			t.Errorf("compiled %s, which the page doesn't include", name)
+		}
+	}
+
+	for _, tc := range []struct {
+		page string
+		opts Options
+		want string
+	}{
+		{"bad", Options{}, "bad includes missing, which doesn't exist"},
+		{"gone", Options{}, "page gone doesn't exist"},
+		{"page", Options{NameFunc: pathName}, "CompilePage doesn't support NameFunc"},
+	} {
+		_, err := CompilePage(dir, tc.page, nil, tc.opts)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: err = %v, want %q", tc.page, err, tc.want)
+		}
+	}
+}
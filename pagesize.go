@@ -0,0 +1,124 @@
+package component
+
+import (
+	"html/template"
+	"sort"
+	"strings"
+)
+
+// PageSize is the size in bytes of what a compiled page inlines, for
+// enforcing performance budgets. See Meta.PageSizes.
+//
+// Sizes count the text written in templates, i.e. everything outside
+// actions, once: text repeated by {{ range }} or skipped by {{ if }} counts
+// once, and values output by actions don't count, since they depend on the
+// data.
+type PageSize struct {
+	// CSS, JS, and Markup are the sizes of the page's inline styles and
+	// scripts and of its markup, including every component it includes,
+	// as compiled. Total is their sum.
+	CSS    int
+	JS     int
+	Markup int
+	Total  int
+
+	// RawCSS, RawJS, RawMarkup, and RawTotal are the same sizes with each
+	// component's sections as written, before options and Transforms
+	// rewrote them, e.g. to minify them or collapse whitespace. Comparing
+	// them with the compiled sizes shows what minifying saves.
+	RawCSS    int
+	RawJS     int
+	RawMarkup int
+	RawTotal  int
+
+	// External is the size of the external assets the page references,
+	// which aren't part of Total. See Options.ExternalAssets.
+	External int
+}
+
+// PagesOver returns the pages whose Total size is over budget bytes,
+// sorted, e.g. to fail a build which exceeds a performance budget.
+func (m *Meta) PagesOver(budget int) []string {
+	var pages []string
+	for name, size := range m.PageSizes {
+		if size.Total > budget {
+			pages = append(pages, name)
+		}
+	}
+	sort.Strings(pages)
+	return pages
+}
+
+// pageParts are the templates a page's root includes inline, recorded by
+// compileRoot for measuring the page.
+type pageParts struct {
+	css, js, markup []string
+}
+
+// textSize returns the size of a section as written without its actions,
+// matching how compiled templates are measured.
+func textSize(s string) int {
+	n := len(s)
+	for i := strings.Index(s, "{{"); i >= 0; i = strings.Index(s, "{{") {
+		end := skipAction(s, i)
+		n -= end - i
+		s = s[end:]
+	}
+	return n
+}
+
+// measurePage returns the size of the named page, whose templates are
+// defined in all.
+func (b *builder) measurePage(all *template.Template, name string) PageSize {
+	parts := b.pageParts[name]
+	var size PageSize
+	size.CSS, size.RawCSS = b.templateSize(all, parts.css)
+	size.JS, size.RawJS = b.templateSize(all, parts.js)
+	size.Markup, size.RawMarkup = b.templateSize(all, parts.markup)
+	size.Total = size.CSS + size.JS + size.Markup
+	size.RawTotal = size.RawCSS + size.RawJS + size.RawMarkup
+	for _, a := range b.meta.Pages[name] {
+		size.External += len(a.Content)
+	}
+	return size
+}
+
+// templateSize returns the compiled and raw size of the named templates and
+// every template they render, including children passed to components and
+// those rendered with the include function, each counted once. Local
+// templates are part of their section as written, so they don't add to the
+// raw size, and templates generated while compiling have the same raw and
+// compiled size.
+func (b *builder) templateSize(all *template.Template, names []string) (compiled, raw int) {
+	seen := map[string]bool{}
+	var visit func(name string)
+	visit = func(name string) {
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+		t := all.Lookup(name)
+		if t == nil || t.Tree == nil {
+			return
+		}
+		tns := getTemplateNodes(t)
+		n := 0
+		for _, text := range tns.text {
+			n += len(text.Text)
+		}
+		compiled += n
+		switch written, ok := b.rawSizes[name]; {
+		case ok:
+			raw += written
+		case !strings.Contains(name, "~"):
+			raw += n
+		}
+		for _, ref := range templateRefs(t) {
+			visit(ref)
+		}
+	}
+	for _, name := range names {
+		visit(name)
+	}
+	return compiled, raw
+}
@@ -0,0 +1,89 @@
+package component
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template/parse"
+
+	"github.com/pkg/errors"
+)
+
+// previewRE matches a preview block within a template section.
+var previewRE = regexp.MustCompile(
+	`(?s)\{\{-?\s*/\*\s*preview\s*\*/\s*-?\}\}(.*?)\{\{-?\s*/\*\s*endpreview\s*\*/\s*-?\}\}`)
+
+// extractPreview removes the preview block from a template section,
+// returning the section without it and the block's sample data. The block
+// is replaced by a comment spanning the same lines, so line numbers in
+// errors still match the source.
+func extractPreview(name string, src []byte) ([]byte, []byte, error) {
+	m := previewRE.FindSubmatchIndex(src)
+	if m == nil {
+		return src, nil, nil
+	}
+	data := bytes.TrimSpace(src[m[2]:m[3]])
+	if !json.Valid(data) {
+		return nil, nil, fmt.Errorf("invalid preview data in %s", name)
+	}
+	lines := bytes.Count(src[m[0]:m[1]], []byte{'\n'})
+	out := make([]byte, 0, len(src))
+	out = append(out, src[:m[0]]...)
+	out = append(out, "{{/*"+strings.Repeat("\n", lines)+"*/}}"...)
+	out = append(out, src[m[1]:]...)
+	return out, data, nil
+}
+
+// RenderPreview renders the named component on its own with the sample data
+// it declares in a preview block, which is useful for building a component
+// gallery. The block holds JSON within the component's <template>, e.g.
+//
+//	<template>
+//		{{/* preview */}}
+//		{"Title": "Hello", "Items": ["a", "b"]}
+//		{{/* endpreview */}}
+//		<h1>{{ .Title }}</h1>
+//	</template>
+//
+// The block is removed at compile time, so it never renders. Components
+// without one are rendered with nil data.
+func RenderPreview(w io.Writer, t *template.Template, name string) error {
+	var data interface{}
+	if tt := t.Lookup(name + "#preview"); tt != nil {
+		if err := json.Unmarshal(treeText(tt.Tree), &data); err != nil {
+			return errors.Wrapf(err, "preview data for %s", name)
+		}
+	}
+	return t.ExecuteTemplate(w, name, data)
+}
+
+// PreviewNames returns the sorted names of the components declaring preview
+// data.
+func PreviewNames(t *template.Template) []string {
+	var names []string
+	for _, tt := range t.Templates() {
+		if name := tt.Name(); strings.HasSuffix(name, "#preview") {
+			names = append(names, strings.TrimSuffix(name, "#preview"))
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// treeText returns the text of a parse tree holding only text, such as the
+// templates recording component metadata.
+func treeText(tree *parse.Tree) []byte {
+	if tree == nil || tree.Root == nil || len(tree.Root.Nodes) != 1 {
+		return nil
+	}
+	text, ok := tree.Root.Nodes[0].(*parse.TextNode)
+	if !ok {
+		return nil
+	}
+	return text.Text
+}
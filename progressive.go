@@ -0,0 +1,108 @@
+package component
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template/parse"
+)
+
+// progressivePart returns the name of the template holding part i of a
+// progressive component's markup.
+func progressivePart(name string, i int) string {
+	return name + "#progressive-" + strconv.Itoa(i)
+}
+
+// splitProgressive splits the tree of a progressive component's template
+// section after each of its top-level includes of another component, so
+// each part can be executed and flushed on its own. See ProgressiveRender.
+func splitProgressive(name string, tree *parse.Tree) ([]*parse.Tree, error) {
+	var parts []*parse.Tree
+	var nodes []parse.Node
+	cut := func() {
+		part := tree.Copy()
+		part.Name = progressivePart(name, len(parts))
+		part.Root.Nodes = nodes
+		parts = append(parts, part)
+		nodes = nil
+	}
+	for _, n := range tree.Copy().Root.Nodes {
+		// variables don't carry over from one part to the next
+		if an, ok := n.(*parse.ActionNode); ok && len(an.Pipe.Decl) > 0 {
+			return nil, fmt.Errorf(
+				"progressive %s declares %s, but variables can't be used across flushes",
+				name, an.Pipe.Decl[0])
+		}
+		nodes = append(nodes, n)
+		if tn, ok := n.(*parse.TemplateNode); ok && strings.HasSuffix(tn.Name, "#template") {
+			cut()
+		}
+	}
+	if len(nodes) > 0 {
+		cut()
+	}
+	return parts, nil
+}
+
+// ProgressiveRender renders the named page like ExecuteTemplate, but flushes
+// w after each top-level component the page includes if it's marked
+// <template progressive>, so the browser can show each as soon as it's
+// ready, e.g. the panels of a dashboard which load at different speeds:
+//
+//	// dashboard.tmpl
+//	<template progressive>
+//		<h1>Dashboard</h1>
+//		{{ template "./panels/quick" . }}
+//		{{ template "./panels/slow" . }}
+//	</template>
+//
+// w is flushed only if it implements http.Flusher, such as an
+// http.ResponseWriter. Pages which aren't progressive are rendered in one
+// go. Since the page is executed in parts, a progressive component has a
+// few constraints:
+//
+//   - Only includes at the top level of its template section mark a
+//     flush, not those within an if, range, or with action. Includes
+//     within elements count, e.g. <main>{{ template "./panels/slow" . }}
+//     </main> flushes before the closing tag.
+//   - Each part is escaped on its own, so top-level includes can't appear
+//     within a tag, such as in an attribute.
+//   - It can't declare variables at the top level, since each part is
+//     executed separately, so it can't be combined with
+//     <style scoped instance>.
+//   - It can't be combined with <template setup="...">.
+//   - Once a part is flushed, an error rendering a later one can't change
+//     the response's status, so errors surface as a truncated page.
+func ProgressiveRender(
+	w io.Writer,
+	t *template.Template,
+	name string,
+	data interface{},
+) error {
+	tt := t.Lookup(name + "#progressive")
+	if tt == nil {
+		return t.ExecuteTemplate(w, name, data)
+	}
+	n, err := strconv.Atoi(string(treeText(tt.Tree)))
+	if err != nil {
+		return fmt.Errorf("invalid progressive parts for %s: %v", name, err)
+	}
+	flush := func() {}
+	if f, ok := w.(http.Flusher); ok {
+		flush = f.Flush
+	}
+	if err := t.ExecuteTemplate(w, name+"#progressive-head", data); err != nil {
+		return err
+	}
+	flush()
+	for i := 0; i < n; i++ {
+		if err := t.ExecuteTemplate(w, progressivePart(name, i), data); err != nil {
+			return err
+		}
+		flush()
+	}
+	return t.ExecuteTemplate(w, name+"#progressive-tail", data)
+}
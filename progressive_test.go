@@ -0,0 +1,67 @@
+package component
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// flushRecorder records what was written before each flush.
+type flushRecorder struct {
+	buf     bytes.Buffer
+	flushed []string
+}
+
+func (w *flushRecorder) Write(p []byte) (int, error) { return w.buf.Write(p) }
+
+func (w *flushRecorder) Flush() {
+	w.flushed = append(w.flushed, w.buf.String())
+	w.buf.Reset()
+}
+
+func TestProgressiveRender(t *testing.T) {
+	src := map[string]string{
+		"panels/quick": `<style>.quick { color: red; }</style><template><p>quick</p></template>`,
+		"panels/slow":  `<template><p>slow</p></template>`,
+		"dashboard": `<template progressive>
+<h1>Dashboard</h1>{{ template "./panels/quick" . }}<main>{{ template "./panels/slow" . }}</main>
+</template>`,
+		"plain": `<template>{{ template "./panels/quick" . }}</template>`,
+	}
+	tmpl, _ := compileMap(t, Options{}, src)
+	w := &flushRecorder{}
+	if err := ProgressiveRender(w, tmpl, "dashboard", nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(w.flushed) != 4 {
+		t.Fatalf("%d flushes, want the head, one per include, and the rest:\n%q",
+			len(w.flushed), w.flushed)
+	}
+	if !strings.Contains(w.flushed[0], ".quick { color: red; }") ||
+		strings.Contains(w.flushed[0], "<h1>") {
+		t.Errorf("head %q, want the styles before any markup", w.flushed[0])
+	}
+	for i, want := range []string{
+		"<h1>Dashboard</h1><p>quick</p>",
+		"<main><p>slow</p>",
+		"</main>",
+	} {
+		if got := strings.TrimSpace(w.flushed[i+1]); got != want {
+			t.Errorf("part %d = %q, want %q", i, got, want)
+		}
+	}
+
+	// flushed or not, the page is the same
+	streamed := strings.Join(w.flushed, "") + w.buf.String()
+	if page := render(t, tmpl, "dashboard", nil); streamed != page {
+		t.Errorf("streamed:\n%s\nwant:\n%s", streamed, page)
+	}
+
+	w = &flushRecorder{}
+	if err := ProgressiveRender(w, tmpl, "plain", nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(w.flushed) != 0 || w.buf.String() != render(t, tmpl, "plain", nil) {
+		t.Errorf("plain page flushed %d times", len(w.flushed))
+	}
+}
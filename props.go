@@ -0,0 +1,377 @@
+package component
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"path"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/html"
+)
+
+// propsFunc is the name of the template function building the data passed
+// to a component included with an element, e.g. <component is="...">.
+const propsFunc = "componentProps"
+
+// props returns a map of alternating keys and values.
+func props(pairs ...interface{}) (map[string]interface{}, error) {
+	if len(pairs)%2 != 0 {
+		return nil, fmt.Errorf("odd number of arguments to %s", propsFunc)
+	}
+	m := make(map[string]interface{}, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		k, ok := pairs[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("%s key %v isn't a string", propsFunc, pairs[i])
+		}
+		m[k] = pairs[i+1]
+	}
+	return m, nil
+}
+
+// tagAttr is an attribute of a tag within template section markup, with its
+// value taken from the original markup rather than the masked one.
+type tagAttr struct {
+	name, value string
+	hasValue    bool
+
+	// start and end are the attribute's byte offsets within the tag.
+	start, end int
+}
+
+// slotFunc is the name of the template function rendering the children of
+// a component included with an element, passed to it as its slot.
+const slotFunc = "componentSlot"
+
+// slot renders the named template, holding the children of an element
+// including a component, with the includer's data.
+func (b *builder) slot(name string, data interface{}) (template.HTML, error) {
+	if b.set == nil {
+		return "", fmt.Errorf("%s can't be rendered while compiling", displayName(name))
+	}
+	var buf bytes.Buffer
+	if err := b.set.ExecuteTemplate(&buf, name, data); err != nil {
+		return "", err
+	}
+	return template.HTML(buf.String()), nil
+}
+
+// includeTag is an element within template section markup which includes a
+// component.
+type includeTag struct {
+	// ref is the path of the component, e.g. "./card".
+	ref string
+
+	// attrs are the element's attributes, except for any naming the
+	// component.
+	attrs []tagAttr
+}
+
+// rewriteIncludes rewrites each element including a component within a
+// template section into an include action, passing its attributes as data
+// and rendering its children as the "slot" prop, e.g.
+//
+//	<component is="./card" title="Hi" :user=".User"></component>
+//
+// becomes
+//
+//	{{ template "./card" (componentProps "title" "Hi" "user" (.User)) }}
+//
+// Children are moved into local templates defined at the end of the
+// section, which render with the includer's data.
+func (b *builder) rewriteIncludes(name string, src []byte) ([]byte, error) {
+	var slots []string
+	out, err := b.rewriteMarkup(name, src, &slots)
+	if err != nil {
+		return nil, err
+	}
+	for i, children := range slots {
+		out = append(out, `{{ define "`+slotName(i)+`" }}`...)
+		out = append(out, children...)
+		out = append(out, "{{ end }}"...)
+	}
+	return out, nil
+}
+
+// slotName returns the local name of the template holding the children of
+// the i-th element including a component.
+func slotName(i int) string {
+	return "#slot-" + strconv.Itoa(i)
+}
+
+// rewriteMarkup rewrites the elements including components within src,
+// which may be the children of another such element, appending their
+// children to slots.
+func (b *builder) rewriteMarkup(name string, src []byte, slots *[]string) ([]byte, error) {
+	toks, err := tokenizeMarkup(src)
+	if err != nil {
+		return nil, err
+	}
+	masked := maskActions(src)
+	var out bytes.Buffer
+	last := 0
+	for i := 0; i < len(toks); i++ {
+		t := toks[i]
+		if t.Type != html.StartTagToken && t.Type != html.SelfClosingTagToken {
+			continue
+		}
+		raw := tagName(src[t.start:t.end])
+		tag, ok, err := b.includeTag(name, raw,
+			scanAttrs(masked[t.start:t.end], src[t.start:t.end]))
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		end := t.end
+		var children []byte
+		if t.Type == html.StartTagToken {
+			// find the matching end tag, allowing the element to nest
+			// within itself
+			j, depth := i+1, 0
+			for ; j < len(toks); j++ {
+				tj := toks[j]
+				if tj.Type == html.StartTagToken && tagName(src[tj.start:tj.end]) == raw {
+					depth++
+				} else if tj.Type == html.EndTagToken && tagName(src[tj.start:tj.end]) == raw {
+					if depth == 0 {
+						break
+					}
+					depth--
+				}
+			}
+			if j == len(toks) {
+				return nil, fmt.Errorf("<%s> isn't closed", raw)
+			}
+			children = src[t.end:toks[j].start]
+			end, i = toks[j].end, j
+		}
+		args, err := includeArgs(tag)
+		if err != nil {
+			return nil, errors.Wrapf(err, "<%s>", raw)
+		}
+		if len(bytes.Trim(children, spaceChars)) > 0 {
+			children, err = b.rewriteMarkup(name, children, slots)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, `"slot"`, "("+slotFunc+" "+
+				strconv.Quote(name+"~"+slotName(len(*slots)))+" .)")
+			*slots = append(*slots, string(children))
+		}
+		out.Write(src[last:t.start])
+		out.WriteString("{{ template " + strconv.Quote(tag.ref) +
+			" (" + strings.Join(args, " ") + ") }}")
+		last = end
+	}
+	out.Write(src[last:])
+	return out.Bytes(), nil
+}
+
+// tagName returns the name of a start or end tag as written, e.g. "Card"
+// for "<Card title=...>".
+func tagName(tag []byte) string {
+	tag = bytes.TrimPrefix(bytes.TrimPrefix(tag, []byte("<")), []byte("/"))
+	if i := bytes.IndexAny(tag, spaceChars+"/>"); i >= 0 {
+		tag = tag[:i]
+	}
+	return string(tag)
+}
+
+// includeTag reports whether an element includes a component, and which.
+// Elements include components in one of three ways:
+//
+//   - <component is="./card"> names the component's path, like an include
+//     action.
+//   - A PascalCase element names a component in the same directory, in
+//     kebab-case or as written, e.g. <UserCard> includes "./user-card" or
+//     else "./UserCard". Dots separate directories, e.g. <Forms.TextInput>
+//     includes "./forms/text-input".
+//   - An element prefixed with "c-" names a component in the same
+//     directory, e.g. <c-user-card> includes "./user-card".
+//
+// PascalCase and prefixed elements only include components which exist,
+// since HTML tags are case-insensitive and custom elements may also be
+// prefixed with "c-". Any other element is left as is.
+func (b *builder) includeTag(name, raw string, attrs []tagAttr) (includeTag, bool, error) {
+	if raw == "component" {
+		for i, a := range attrs {
+			if a.name != "is" {
+				continue
+			}
+			if a.value == "" || (a.value[0] != '.' && a.value[0] != '/') {
+				return includeTag{}, false, fmt.Errorf(
+					"<component is=%q> must name a path like ./card", a.value)
+			}
+			rest := append(append([]tagAttr{}, attrs[:i]...), attrs[i+1:]...)
+			return includeTag{ref: a.value, attrs: rest}, true, nil
+		}
+		return includeTag{}, false, errors.New("<component> needs an is attribute")
+	}
+	var candidates []string
+	switch {
+	case raw[0] >= 'A' && raw[0] <= 'Z':
+		parts := strings.Split(raw, ".")
+		kebab := make([]string, len(parts))
+		for i, part := range parts {
+			kebab[i] = kebabCase(part)
+		}
+		candidates = []string{
+			"./" + strings.Join(kebab, "/"),
+			"./" + strings.Join(parts, "/"),
+		}
+	case strings.HasPrefix(raw, "c-") && len(raw) > 2:
+		candidates = []string{"./" + raw[2:]}
+	}
+	dir := path.Dir(name)
+	for _, ref := range candidates {
+		if name := resolveRef(dir, ref); b.known[name] || (b.exists != nil && b.exists(name)) {
+			return includeTag{ref: ref, attrs: attrs}, true, nil
+		}
+	}
+	return includeTag{}, false, nil
+}
+
+// kebabCase converts a PascalCase name to kebab-case, e.g. "UserCard" to
+// "user-card".
+func kebabCase(s string) string {
+	var b strings.Builder
+	for i, r := range s {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('-')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// includeArgs returns the arguments to componentProps passing an element's
+// attributes as data.
+func includeArgs(tag includeTag) ([]string, error) {
+	args := []string{propsFunc}
+	for _, a := range tag.attrs {
+		if strings.Contains(a.name, "{{") {
+			return nil, errors.New("attributes can't be conditional")
+		}
+		if propName(a.name) == "slot" {
+			return nil, errors.New("slot is reserved for the element's children")
+		}
+		arg, err := propArg(a)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, strconv.Quote(propName(a.name)), arg)
+	}
+	return args, nil
+}
+
+// propArg returns the template argument for an attribute's value:
+//
+//   - A bound attribute, e.g. :user=".User", evaluates its value as a
+//     pipeline, after unescaping character references such as &quot;.
+//   - An attribute whose value is a single action, e.g.
+//     title="{{ .Title }}", evaluates the action's pipeline.
+//   - Any other attribute is a string, or true if it has no value.
+func propArg(a tagAttr) (string, error) {
+	if strings.HasPrefix(a.name, ":") {
+		if strings.TrimSpace(a.value) == "" {
+			return "", fmt.Errorf("%s must have a pipeline", a.name)
+		}
+		return "(" + html.UnescapeString(a.value) + ")", nil
+	}
+	if !a.hasValue {
+		return "true", nil
+	}
+	if strings.HasPrefix(a.value, "{{") {
+		if skipAction(a.value, 0) != len(a.value) {
+			return "", fmt.Errorf(
+				"%s mixes text and actions; bind it with :%s instead", a.name, a.name)
+		}
+		pipe := strings.TrimSuffix(strings.TrimPrefix(a.value, "{{"), "}}")
+		pipe = strings.TrimSuffix(strings.TrimPrefix(pipe, "-"), "-")
+		return "(" + pipe + ")", nil
+	}
+	if strings.Contains(a.value, "{{") {
+		return "", fmt.Errorf(
+			"%s mixes text and actions; bind it with :%s instead", a.name, a.name)
+	}
+	return strconv.Quote(html.UnescapeString(a.value)), nil
+}
+
+// propName returns the data key of an attribute. HTML attribute names are
+// case-insensitive, so kebab-case names become camelCase, e.g. "user-name"
+// becomes "userName".
+func propName(attr string) string {
+	parts := strings.Split(strings.TrimPrefix(attr, ":"), "-")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
+
+// scanAttrs returns the attributes of a start tag. It scans the masked tag,
+// so quotes and ">" within actions are ignored, and takes names and values
+// from the original.
+func scanAttrs(masked, orig []byte) []tagAttr {
+	var attrs []tagAttr
+	i := bytes.IndexAny(masked, spaceChars+"/>")
+	if i < 0 {
+		return nil
+	}
+	for i < len(masked) {
+		for i < len(masked) && (isSpace(masked[i]) || masked[i] == '/') {
+			i++
+		}
+		if i >= len(masked) || masked[i] == '>' {
+			break
+		}
+		start := i
+		for i < len(masked) && !isSpace(masked[i]) && !bytes.ContainsAny(masked[i:i+1], "=/>") {
+			i++
+		}
+		a := tagAttr{name: strings.ToLower(string(orig[start:i])), start: start}
+		j := i
+		for j < len(masked) && isSpace(masked[j]) {
+			j++
+		}
+		// an attribute without a value ends at its name
+		if j < len(masked) && masked[j] == '=' {
+			i = j + 1
+			for i < len(masked) && isSpace(masked[i]) {
+				i++
+			}
+			a.hasValue = true
+			if i < len(masked) && (masked[i] == '"' || masked[i] == '\'') {
+				q := masked[i]
+				i++
+				start = i
+				for i < len(masked) && masked[i] != q {
+					i++
+				}
+				a.value = string(orig[start:i])
+				if i < len(masked) {
+					i++
+				}
+			} else {
+				start = i
+				for i < len(masked) && !isSpace(masked[i]) && masked[i] != '>' {
+					i++
+				}
+				a.value = string(orig[start:i])
+			}
+		}
+		a.end = i
+		attrs = append(attrs, a)
+	}
+	return attrs
+}
@@ -0,0 +1,51 @@
+package component
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestComponentProps(t *testing.T) {
+	src := map[string]string{
+		"card": `<template><div title="{{ .title }}">{{ .user.Name }} {{ .userName }} {{ .active }}</div></template>`,
+		"page": `<template><component is="./card" title="Hello" :user=".User" user-name="{{ .Nick }}" active></component></template>`,
+	}
+	tmpl, _ := compileMap(t, Options{}, src)
+	data := map[string]interface{}{
+		"User": map[string]string{"Name": "Ann"},
+		"Nick": "a<b",
+	}
+	page := render(t, tmpl, "page", data)
+	const want = `<div title="Hello">Ann a&lt;b true</div>`
+	if !strings.Contains(page, want) {
+		t.Errorf("page missing %s:\n%s", want, page)
+	}
+	if strings.Contains(page, "<component") {
+		t.Errorf("component element left in page:\n%s", page)
+	}
+}
+
+func TestElementIncludes(t *testing.T) {
+	src := map[string]string{
+		"card":             `<template><div class="card" title="{{ .title }}">{{ .slot }}</div></template>`,
+		"forms/text-input": `<template><input name="{{ .name }}"></template>`,
+		"page": `<template>
+<Card title="a"><b>{{ .Name }}</b></Card>
+<c-card title="b"></c-card>
+<Forms.TextInput name="q"></Forms.TextInput>
+<Unknown></Unknown><my-el></my-el>
+</template>`,
+	}
+	tmpl, _ := compileMap(t, Options{}, src)
+	page := render(t, tmpl, "page", map[string]string{"Name": "Ann"})
+	for _, want := range []string{
+		`<div class="card" title="a"><b>Ann</b></div>`,
+		`<div class="card" title="b"></div>`,
+		`<input name="q">`,
+		`<Unknown></Unknown><my-el></my-el>`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("page missing %s:\n%s", want, page)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package component
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// reloadName is the name of the template holding the script added to pages
+// by Options.DevReload.
+const reloadName = "#dev-reload"
+
+// reloadScript returns the script which reloads the page whenever the
+// server at path sends an event.
+func reloadScript(path string) string {
+	// json.Marshal escapes "<", so the path can't end the script element
+	quoted, _ := json.Marshal(path)
+	return `(function() {
+	var events = new EventSource(` + string(quoted) + `);
+	events.onmessage = function() { location.reload(); };
+})();`
+}
+
+// Reloader notifies the pages of connected browsers to reload, for use
+// during development with Options.DevReload. Serve it at the same path,
+// then call Reload after recompiling, e.g. from Watch:
+//
+//	reloader := component.NewReloader()
+//	http.Handle("/_reload", reloader)
+//	go component.Watch(ctx, "templates", time.Second, func() {
+//		t, err = component.CompileDir("templates", fns, opts)
+//		// ...
+//		reloader.Reload()
+//	})
+//
+// Never serve a Reloader in production.
+type Reloader struct {
+	mu      sync.Mutex
+	clients map[chan struct{}]bool
+}
+
+// NewReloader returns a Reloader without any connected browsers.
+func NewReloader() *Reloader {
+	return &Reloader{clients: map[chan struct{}]bool{}}
+}
+
+// ServeHTTP streams server-sent events to a browser until it disconnects.
+func (r *Reloader) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	ch := make(chan struct{}, 1)
+	r.mu.Lock()
+	r.clients[ch] = true
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		delete(r.clients, ch)
+		r.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-ch:
+			if _, err := fmt.Fprint(w, "data: reload\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// Reload tells every connected browser to reload its page.
+func (r *Reloader) Reload() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for ch := range r.clients {
+		select {
+		case ch <- struct{}{}:
+		default:
+			// a reload is already pending
+		}
+	}
+}
+
+// Watch polls the components in a directory every interval and calls fn
+// whenever one is added, removed, or modified, until ctx is done. It
+// returns ctx.Err() when done, or an error if the directory can't be read.
+func Watch(
+	ctx context.Context,
+	dirname string,
+	interval time.Duration,
+	fn func(),
+) error {
+	last, err := snapshot(dirname)
+	if err != nil {
+		return err
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		cur, err := snapshot(dirname)
+		if err != nil {
+			return err
+		}
+		if cur != last {
+			last = cur
+			fn()
+		}
+	}
+}
+
+// snapshot summarizes the path, size, and modification time of every
+// component in a directory, so any change produces a different summary.
+func snapshot(dirname string) (string, error) {
+	if err := checkDir(dirname); err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	err := fs.WalkDir(os.DirFS(dirname), ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(p, ".tmpl") {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&b, "%s %d %d\n", p, fi.Size(), fi.ModTime().UnixNano())
+		return nil
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "walk directory")
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,114 @@
+package component
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDevReload(t *testing.T) {
+	src := map[string]string{"page": `<template>hi</template>`}
+	tmpl, _ := compileMap(t, Options{DevReload: "/_reload"}, src)
+	if page := render(t, tmpl, "page", nil); !strings.Contains(page, `new EventSource("/_reload")`) {
+		t.Errorf("page missing reload script:\n%s", page)
+	}
+	tmpl, _ = compileMap(t, Options{}, src)
+	if page := render(t, tmpl, "page", nil); strings.Contains(page, "EventSource") {
+		t.Errorf("reload script without DevReload:\n%s", page)
+	}
+}
+
+func TestReloader(t *testing.T) {
+	reloader := NewReloader()
+	srv := httptest.NewServer(reloader)
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type %s", ct)
+	}
+
+	// the browser is connected once the headers arrive
+	reloader.Reload()
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line != "data: reload\n" {
+		t.Errorf("event %q", line)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	dir := writeDir(t, map[string]string{"page.tmpl": "<template>a</template>"})
+	ctx, cancel := context.WithCancel(context.Background())
+	changed := make(chan struct{}, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- Watch(ctx, dir, 5*time.Millisecond, func() {
+			select {
+			case changed <- struct{}{}:
+			default:
+			}
+		})
+	}()
+	wait := func(want bool, what string) {
+		t.Helper()
+		select {
+		case <-changed:
+			if !want {
+				t.Errorf("%s: fn called", what)
+			}
+		case <-time.After(200 * time.Millisecond):
+			if want {
+				t.Errorf("%s: fn not called", what)
+			}
+		}
+	}
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// let Watch take its first snapshot
+	time.Sleep(20 * time.Millisecond)
+	write("notes.txt", "not a component")
+	wait(false, "non-component added")
+	write("page.tmpl", "<template>changed</template>")
+	wait(true, "component modified")
+	write("new.tmpl", "<template>new</template>")
+	wait(true, "component added")
+	if err := os.Remove(filepath.Join(dir, "new.tmpl")); err != nil {
+		t.Fatal(err)
+	}
+	wait(true, "component removed")
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+
+	err := Watch(context.Background(), filepath.Join(dir, "missing"), time.Millisecond, func() {})
+	if err == nil {
+		t.Error("want an error watching a missing directory")
+	}
+}
@@ -0,0 +1,299 @@
+package component
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// RenderWithGlobals renders the named page with data which also carries
+// global data common to every page, such as the current user or a CSRF
+// token, available to templates as .Global. This avoids merging the common
+// data into each page's data at every call site.
+//
+// How global is added depends on the type of data:
+//
+//   - nil becomes a map containing only the "Global" key.
+//   - A map[string]interface{} is copied and the "Global" key is added to
+//     the copy. If data already has a "Global" key, data takes precedence
+//     and global is ignored.
+//   - A struct, or pointer to a struct, must have an exported Global field
+//     of a type global is assignable to. The struct is copied and the
+//     copy's Global field is set, unless it's already non-zero, in which
+//     case data again takes precedence.
+//
+// The caller's data is never modified. Any other type of data is an error.
+func RenderWithGlobals(
+	w io.Writer,
+	t *template.Template,
+	name string,
+	global, data interface{},
+) error {
+	data, err := withGlobals(global, data)
+	if err != nil {
+		return err
+	}
+	return t.ExecuteTemplate(w, name, data)
+}
+
+func withGlobals(global, data interface{}) (interface{}, error) {
+	switch d := data.(type) {
+	case nil:
+		return map[string]interface{}{"Global": global}, nil
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(d)+1)
+		m["Global"] = global
+		for k, v := range d {
+			m[k] = v
+		}
+		return m, nil
+	}
+	v := reflect.ValueOf(data)
+	ptr := v.Kind() == reflect.Ptr
+	if ptr {
+		if v.IsNil() {
+			return nil, fmt.Errorf("nil %T has no Global field", data)
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%T has no Global field", data)
+	}
+	cp := reflect.New(v.Type()).Elem()
+	cp.Set(v)
+	f := cp.FieldByName("Global")
+	if !f.IsValid() || !f.CanSet() {
+		return nil, fmt.Errorf("%T has no exported Global field", data)
+	}
+	if f.IsZero() && global != nil {
+		g := reflect.ValueOf(global)
+		if !g.Type().AssignableTo(f.Type()) {
+			return nil, fmt.Errorf("cannot assign %T to %T.Global", global, data)
+		}
+		f.Set(g)
+	}
+	if ptr {
+		return cp.Addr().Interface(), nil
+	}
+	return cp.Interface(), nil
+}
+
+// CompilePageHTML compiles the components in a directory and renders the
+// named page with data, returning its HTML, e.g. for debugging or for
+// generating a static page in one call. Every component is compiled, so an
+// error in any fails, even one the page doesn't include. Use CompileDir to
+// render more than one page.
+func CompilePageHTML(
+	dirname, name string,
+	fns template.FuncMap,
+	data interface{},
+	opts ...Options,
+) (string, error) {
+	t, err := CompileDir(dirname, fns, opts...)
+	if err != nil {
+		return "", err
+	}
+	if !isPage(name) || t.Lookup(name) == nil {
+		return "", fmt.Errorf("page %s doesn't exist", name)
+	}
+	var buf bytes.Buffer
+	if err := t.ExecuteTemplate(&buf, name, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// defaultPageName is the name of the template recording Options.DefaultPage
+// for RenderPage.
+const defaultPageName = "#default-page"
+
+// RenderPage renders the named page with data, or the page set by
+// Options.DefaultPage, with the same data, if the named page doesn't exist,
+// e.g. rendering a not-found page for any unknown path. Without a default
+// page, a page which doesn't exist is an error as usual.
+func RenderPage(w io.Writer, t *template.Template, name string, data interface{}) error {
+	if !isPage(name) || t.Lookup(name) == nil {
+		d := t.Lookup(defaultPageName)
+		if d == nil {
+			return fmt.Errorf("page %s doesn't exist", name)
+		}
+		name = string(treeText(d.Tree))
+	}
+	return t.ExecuteTemplate(w, name, data)
+}
+
+// RenderContext renders the named template with data like ExecuteTemplate,
+// but returns ctx.Err() as soon as ctx is done, e.g. when a deadline set with
+// context.WithTimeout passes during a slow function call. The output is
+// buffered and written to w only if rendering finishes in time, so w never
+// receives a partial page.
+//
+// html/template execution can't be interrupted, so rendering continues in
+// the background after RenderContext returns until its next write, which
+// fails and stops it, or until it finishes. A function blocking forever
+// leaks the goroutine. To stop slow functions promptly, pass them the same
+// context, e.g. in data, and have them return when it's done.
+func RenderContext(
+	ctx context.Context,
+	w io.Writer,
+	t *template.Template,
+	name string,
+	data interface{},
+) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	cw := &ctxWriter{ctx: ctx}
+	done := make(chan error, 1)
+	go func() {
+		done <- t.ExecuteTemplate(cw, name, data)
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(cw.buf.Bytes())
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ctxWriter buffers output until its context is done, failing every write
+// after.
+type ctxWriter struct {
+	ctx context.Context
+	buf bytes.Buffer
+}
+
+func (w *ctxWriter) Write(p []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return w.buf.Write(p)
+}
+
+// PreWarm renders every page in t, discarding the output, to catch errors
+// which only surface when templates execute, e.g. as a smoke test at
+// startup. Pages are rendered with their data in samples, if any, and with
+// nil data otherwise. Without sample data, a page failing only because its
+// data is nil, e.g. "nil pointer evaluating", is expected and not reported.
+//
+// Since html/template escapes templates on their first execution, PreWarm
+// also moves the cost of escaping from the first request for each page to
+// startup. Templates can't be cloned once executed, so create any Coverage
+// and compare any Diff first.
+func PreWarm(t *template.Template, samples map[string]interface{}) error {
+	failed := map[string]error{}
+	for _, tt := range t.Templates() {
+		name := tt.Name()
+		if tt.Tree == nil || !isPage(name) {
+			continue
+		}
+		data, ok := samples[name]
+		err := t.ExecuteTemplate(io.Discard, name, data)
+		if err == nil || (!ok && isNilDataError(err)) {
+			continue
+		}
+		failed[name] = err
+	}
+	for name := range samples {
+		if tt := t.Lookup(name); tt == nil || !isPage(name) {
+			failed[name] = fmt.Errorf("page %s doesn't exist", name)
+		}
+	}
+	if len(failed) > 0 {
+		return &PreWarmError{Pages: failed}
+	}
+	return nil
+}
+
+// isNilDataError reports whether err is from evaluating a field or key of
+// nil data.
+func isNilDataError(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "nil pointer evaluating") ||
+		strings.Contains(msg, "nil data; no entry for key") ||
+		strings.Contains(msg, "index of untyped nil")
+}
+
+// PreWarmError is returned by PreWarm when any page fails to render.
+type PreWarmError struct {
+	// Pages maps the name of each page which failed to its error.
+	Pages map[string]error
+}
+
+func (e *PreWarmError) Error() string {
+	names := make([]string, 0, len(e.Pages))
+	for name := range e.Pages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	msgs := make([]string, len(names))
+	for i, name := range names {
+		msgs[i] = name + ": " + e.Pages[name].Error()
+	}
+	return fmt.Sprintf("%d pages failed to render: %s", len(names),
+		strings.Join(msgs, "; "))
+}
+
+// PageAssets returns the CSS and JS of the named page, i.e. the styles and
+// scripts of the page and every component it includes, in the order they'd
+// appear in the page. Serving them at separate URLs lets them be cached
+// independently of the HTML. Sections with template actions are executed
+// with nil data. Scripts of components marked <script type="module"> are
+// left out, since they can't run as part of a classic script.
+func PageAssets(t *template.Template, name string) (css, js string, err error) {
+	css, err = executeTrimmed(t, name+"#css", "<style>", "</style>")
+	if err != nil {
+		return "", "", err
+	}
+	js, err = executeTrimmed(t, name+"#js", "<script>", "</script>")
+	if err != nil {
+		return "", "", err
+	}
+	return css, js, nil
+}
+
+// executeTrimmed executes the named template and trims the given prefix and
+// suffix from its output.
+func executeTrimmed(t *template.Template, name, prefix, suffix string) (string, error) {
+	var buf bytes.Buffer
+	if err := t.ExecuteTemplate(&buf, name, nil); err != nil {
+		return "", err
+	}
+	out := strings.TrimPrefix(buf.String(), prefix)
+	return strings.TrimSuffix(out, suffix), nil
+}
+
+// RenderHTML renders the markup of the named component, i.e. its <template>
+// section without the surrounding document, styles, or scripts, for use as
+// data in another render. The result is typed as template.HTML so it's
+// interpolated as-is rather than escaped again.
+//
+// Only pass the result to templates which trust it. It's safe insofar as
+// the component's own output is: html/template escaped data while rendering
+// it, but anything the component emits unescaped, such as other
+// template.HTML values it was given, is passed through unchecked. Since
+// styles and scripts aren't included, the page embedding the result must
+// include them itself, e.g. by including the component elsewhere.
+func RenderHTML(
+	t *template.Template,
+	name string,
+	data interface{},
+) (template.HTML, error) {
+	if t.Lookup(name+"#template") != nil {
+		name += "#template"
+	}
+	var buf bytes.Buffer
+	if err := t.ExecuteTemplate(&buf, name, data); err != nil {
+		return "", err
+	}
+	return template.HTML(buf.String()), nil
+}
@@ -0,0 +1,253 @@
+package component
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPreWarm(t *testing.T) {
+	src := map[string]string{
+		"ok":    `<template>hi</template>`,
+		"field": `<template>{{ .User.Name }}</template>`,
+		"bad":   `<template>{{ index .Items 5 }}</template>`,
+	}
+	tmpl, _ := compileMap(t, Options{}, src)
+	// without sample data, field fails only because its data is nil
+	samples := map[string]interface{}{
+		"bad": map[string][]int{"Items": {1}},
+	}
+	err := PreWarm(tmpl, samples)
+	var pwErr *PreWarmError
+	if !errors.As(err, &pwErr) {
+		t.Fatalf("err = %v, want a *PreWarmError", err)
+	}
+	if len(pwErr.Pages) != 1 || pwErr.Pages["bad"] == nil {
+		t.Errorf("failed pages %v, want only bad", pwErr.Pages)
+	}
+
+	samples = map[string]interface{}{
+		"field":   map[string]interface{}{"User": map[string]string{"Name": "a"}},
+		"missing": nil,
+	}
+	tmpl, _ = compileMap(t, Options{}, map[string]string{
+		"ok":    src["ok"],
+		"field": src["field"],
+	})
+	err = PreWarm(tmpl, samples)
+	if !errors.As(err, &pwErr) || len(pwErr.Pages) != 1 ||
+		!strings.Contains(pwErr.Pages["missing"].Error(), "doesn't exist") {
+		t.Errorf("err = %v, want only a missing page", err)
+	}
+
+	// once warmed, pages still render
+	if got := render(t, tmpl, "field#template", samples["field"]); got != "a" {
+		t.Errorf("render after PreWarm = %q", got)
+	}
+}
+
+func TestRenderWithGlobals(t *testing.T) {
+	tmpl, _ := compileMap(t, Options{}, map[string]string{
+		"page": `<template>{{ .Global }}|{{ .Title }}</template>`,
+	})
+	type pageData struct {
+		Global interface{}
+		Title  string
+	}
+	type typedData struct {
+		Global int
+		Title  string
+	}
+	own := map[string]interface{}{"Global": "own", "Title": "t"}
+	for _, tc := range []struct {
+		name string
+		data interface{}
+		want string
+	}{
+		{"nil", nil, "global|"},
+		{"map", map[string]interface{}{"Title": "t"}, "global|t"},
+		{"map with Global", own, "own|t"},
+		{"struct", pageData{Title: "t"}, "global|t"},
+		{"pointer to struct", &pageData{Title: "t"}, "global|t"},
+		{"struct with Global", pageData{Global: "own", Title: "t"}, "own|t"},
+		{"typed Global set", typedData{Global: 1, Title: "t"}, "1|t"},
+	} {
+		var buf bytes.Buffer
+		if err := RenderWithGlobals(&buf, tmpl, "page#template", "global", tc.data); err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if got := buf.String(); got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+	if own["Global"] != "own" || len(own) != 2 {
+		t.Errorf("caller's map modified: %v", own)
+	}
+	data := &pageData{Title: "t"}
+	if err := RenderWithGlobals(&bytes.Buffer{}, tmpl, "page#template", "global", data); err != nil {
+		t.Fatal(err)
+	}
+	if data.Global != nil {
+		t.Errorf("caller's struct modified: %+v", data)
+	}
+
+	for name, data := range map[string]interface{}{
+		"unassignable Global": typedData{Title: "t"},
+		"no Global field":     struct{ Title string }{"t"},
+		"nil pointer":         (*pageData)(nil),
+		"not a struct":        42,
+	} {
+		err := RenderWithGlobals(&bytes.Buffer{}, tmpl, "page#template", "global", data)
+		if err == nil {
+			t.Errorf("%s: want an error", name)
+		}
+	}
+}
+
+func TestRenderHTML(t *testing.T) {
+	tmpl, _ := compileMap(t, Options{}, map[string]string{
+		"card": `<style>.card { color: red; }</style><script>init();</script>
+<template><div class="card">{{ .Title }}</div></template>`,
+		"page": `<template><main>{{ .Card }}</main></template>`,
+	})
+	card, err := RenderHTML(tmpl, "card", map[string]string{"Title": "<b>&</b>"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<div class="card">&lt;b&gt;&amp;&lt;/b&gt;</div>`
+	if string(card) != want {
+		t.Errorf("RenderHTML = %q, want only the markup %q", card, want)
+	}
+
+	// embedded in another page, it isn't escaped again
+	page := render(t, tmpl, "page#template", map[string]interface{}{"Card": card})
+	if page != "<main>"+want+"</main>" {
+		t.Errorf("page = %q", page)
+	}
+
+	if _, err := RenderHTML(tmpl, "missing", nil); err == nil {
+		t.Error("want an error for a missing component")
+	}
+}
+
+func TestRenderContext(t *testing.T) {
+	release := make(chan struct{})
+	calls := 0
+	opts := Options{Funcs: map[string]interface{}{
+		"slow": func() string {
+			calls++
+			<-release
+			return "done"
+		},
+	}}
+	tmpl, _ := compileMap(t, opts, map[string]string{
+		"fast": `<template>fast</template>`,
+		"slow": `<template>before {{ slow }}</template>`,
+	})
+
+	var buf bytes.Buffer
+	if err := RenderContext(context.Background(), &buf, tmpl, "fast", nil); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "fast") {
+		t.Errorf("output %q", buf.String())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	buf.Reset()
+	err := RenderContext(ctx, &buf, tmpl, "slow", nil)
+	if !errors.Is(err, context.Canceled) || buf.Len() != 0 || calls != 0 {
+		t.Errorf("canceled: err = %v, %d bytes written, %d calls", err, buf.Len(), calls)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err = RenderContext(ctx, &buf, tmpl, "slow", nil)
+	close(release)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want the deadline", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("partial output written: %q", buf.String())
+	}
+}
+
+func TestRenderPage(t *testing.T) {
+	src := map[string]string{
+		"home":      `<template>home {{ . }}</template>`,
+		"not-found": `<template>not found {{ . }}</template>`,
+	}
+	tmpl, _ := compileMap(t, Options{DefaultPage: "not-found"}, src)
+	for name, want := range map[string]string{
+		"home":          "home x",
+		"missing":       "not found x",
+		"home#template": "not found x",
+		"":              "not found x",
+	} {
+		var buf bytes.Buffer
+		if err := RenderPage(&buf, tmpl, name, "x"); err != nil {
+			t.Errorf("%q: %v", name, err)
+			continue
+		}
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("%q rendered %q, want %q", name, buf.String(), want)
+		}
+	}
+
+	tmpl, _ = compileMap(t, Options{}, src)
+	err := RenderPage(&bytes.Buffer{}, tmpl, "missing", nil)
+	if err == nil || !strings.Contains(err.Error(), "page missing doesn't exist") {
+		t.Errorf("err = %v, want the page reported missing", err)
+	}
+
+	for _, page := range []string{"gone", "home#template"} {
+		srcs := map[string][]byte{"home": []byte(src["home"])}
+		if _, _, err := NewCompiler(Options{DefaultPage: page}).Map(srcs); err == nil {
+			t.Errorf("DefaultPage %q compiled", page)
+		}
+	}
+}
+
+func TestCompilePageHTML(t *testing.T) {
+	dir := writeDir(t, map[string]string{
+		"page.tmpl":      `<style>p { color: red; }</style><template><p>{{ .Name }}</p>{{ template "./parts/nav" }}</template>`,
+		"parts/nav.tmpl": `<template><nav></nav></template>`,
+	})
+	html, err := CompilePageHTML(dir, "page", nil, map[string]string{"Name": "Ann"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"<!DOCTYPE html>", "color: red", "<p>Ann</p><nav></nav>"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("page missing %s:\n%s", want, html)
+		}
+	}
+	if html, err := CompilePageHTML(dir, "parts/nav", nil, nil); err != nil ||
+		!strings.Contains(html, "<nav></nav>") {
+		t.Errorf("nested page: %v\n%s", err, html)
+	}
+
+	// sections and missing pages aren't pages
+	for _, name := range []string{"missing", "page#style", "x#style", "page#template"} {
+		_, err := CompilePageHTML(dir, name, nil, nil)
+		if err == nil || err.Error() != "page "+name+" doesn't exist" {
+			t.Errorf("%s: err = %v, want the page reported missing", name, err)
+		}
+	}
+
+	// every component is compiled, even those the page doesn't include
+	if err := os.WriteFile(filepath.Join(dir, "broken.tmpl"),
+		[]byte(`<template>{{ if }}</template>`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CompilePageHTML(dir, "page", nil, nil); err == nil {
+		t.Error("want a broken component to fail the page")
+	}
+}
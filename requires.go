@@ -0,0 +1,113 @@
+package component
+
+import (
+	"fmt"
+	"html/template"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// fieldNameRE matches the names of fields a component may require.
+var fieldNameRE = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// addRequires records the data fields a component marked
+// <template requires="..."> requires, for CheckData.
+func (b *builder) addRequires(c *component) error {
+	fields := strings.Fields(c.attrs["template"]["requires"])
+	for _, f := range fields {
+		if !fieldNameRE.MatchString(f) {
+			return fmt.Errorf("invalid requires directive in %s: %q isn't a field name",
+				c.name, f)
+		}
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	return b.addText(c.name+"#requires", strings.Join(fields, " "))
+}
+
+// RequiredFields returns the data fields the named component declares it
+// requires with <template requires="...">, e.g. ["Title", "Items"] for
+// <template requires="Title Items">.
+func RequiredFields(t *template.Template, name string) []string {
+	tt := t.Lookup(name + "#requires")
+	if tt == nil {
+		return nil
+	}
+	return strings.Fields(string(treeText(tt.Tree)))
+}
+
+// CheckData reports whether data has every field the named component
+// requires, as declared with <template requires="...">, e.g.
+// requires="Title Items", failing with a *MissingFieldError naming the
+// first missing one. Data may be a map with string keys, which must have each field as a key,
+// or a struct or pointer to one, which must have each as an exported field
+// or method. Check a page's data before executing it to catch data which
+// was forgotten, rather than rendering empty values.
+func CheckData(t *template.Template, name string, data interface{}) error {
+	fields := RequiredFields(t, name)
+	if len(fields) == 0 {
+		return nil
+	}
+	v := reflect.ValueOf(data)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			break
+		}
+		v = v.Elem()
+	}
+	for _, field := range fields {
+		if !hasField(v, field) {
+			return &MissingFieldError{Component: name, Field: field}
+		}
+	}
+	return nil
+}
+
+// hasField reports whether a template could evaluate .field on v.
+func hasField(v reflect.Value, field string) bool {
+	switch v.Kind() {
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return false
+		}
+		return v.MapIndex(reflect.ValueOf(field).Convert(v.Type().Key())).IsValid()
+	case reflect.Struct:
+		if f, ok := v.Type().FieldByName(field); ok && f.PkgPath == "" {
+			return true
+		}
+		if v.CanAddr() && v.Addr().MethodByName(field).IsValid() {
+			return true
+		}
+		return v.MethodByName(field).IsValid()
+	}
+	return false
+}
+
+// RenderChecked is like RenderHTML but first checks data has the fields the
+// component requires with CheckData.
+func RenderChecked(
+	t *template.Template,
+	name string,
+	data interface{},
+) (template.HTML, error) {
+	if err := CheckData(t, name, data); err != nil {
+		return "", err
+	}
+	return RenderHTML(t, name, data)
+}
+
+// MissingFieldError is returned by CheckData when data lacks a field the
+// component requires.
+type MissingFieldError struct {
+	// Component is the name of the component requiring the field.
+	Component string
+
+	// Field is the name of the missing field.
+	Field string
+}
+
+func (e *MissingFieldError) Error() string {
+	return fmt.Sprintf("%s requires data field %s", e.Component, e.Field)
+}
@@ -0,0 +1,160 @@
+package component
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// SanitizePolicy restricts the elements and attributes components may use,
+// for compiling components written by untrusted authors. See
+// Options.Sanitizer.
+type SanitizePolicy struct {
+	// Tags are the elements permitted in markup, e.g. "p" and "a". A
+	// component may only have a <style> or <script> section if "style" or
+	// "script" is permitted.
+	Tags []string
+
+	// Attrs are the attributes permitted on any permitted element, e.g.
+	// "class". A name ending in "*" permits every attribute beginning
+	// with the rest, e.g. "data-*".
+	Attrs []string
+
+	// TagAttrs are the attributes permitted on specific elements, e.g.
+	// {"a": {"href"}, "img": {"src", "alt"}}, written like Attrs.
+	TagAttrs map[string][]string
+
+	// Strip removes what isn't permitted rather than failing compilation.
+	// A forbidden element is removed along with its contents.
+	Strip bool
+}
+
+// allowsTag reports whether the policy permits an element.
+func (p *SanitizePolicy) allowsTag(tag string) bool {
+	for _, t := range p.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsAttr reports whether the policy permits an attribute on an element.
+// Event handlers, e.g. onclick, and attributes whose names are written by
+// template actions are never permitted.
+func (p *SanitizePolicy) allowsAttr(tag, attr string) bool {
+	if isHandlerAttr(attr) || strings.Contains(attr, "{{") {
+		return false
+	}
+	match := func(names []string) bool {
+		for _, n := range names {
+			n = strings.ToLower(n)
+			if n == attr || (strings.HasSuffix(n, "*") && strings.HasPrefix(attr, n[:len(n)-1])) {
+				return true
+			}
+		}
+		return false
+	}
+	return match(p.Attrs) || match(p.TagAttrs[tag])
+}
+
+// sanitize enforces the policy on a component, failing with every violation
+// found, or removing them with Strip.
+func sanitize(c *component, p *SanitizePolicy) error {
+	var violations []string
+	for _, section := range []string{"style", "script"} {
+		if len(c.sections[section]) == 0 || p.allowsTag(section) {
+			continue
+		}
+		if p.Strip {
+			delete(c.sections, section)
+		} else {
+			violations = append(violations, section+" section")
+		}
+	}
+	out, found, err := sanitizeMarkup(c.sections["template"], p)
+	if err != nil {
+		return err
+	}
+	if p.Strip {
+		c.sections["template"] = out
+	} else {
+		violations = append(violations, found...)
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s isn't permitted by the sanitizer: %s",
+		c.name, strings.Join(violations, "; "))
+}
+
+// sanitizeMarkup returns template section markup without the elements and
+// attributes the policy forbids, along with a description of each.
+func sanitizeMarkup(src []byte, p *SanitizePolicy) ([]byte, []string, error) {
+	toks, err := tokenizeMarkup(src)
+	if err != nil {
+		return nil, nil, err
+	}
+	masked := maskActions(src)
+	var out bytes.Buffer
+	var violations []string
+	last := 0
+	// skip is the forbidden element being removed, and depth the number of
+	// elements of the same name open within it
+	skip, depth := "", 0
+	for _, t := range toks {
+		switch {
+		case skip != "":
+			switch {
+			case t.Type == html.StartTagToken && t.Data == skip:
+				depth++
+			case t.Type == html.EndTagToken && t.Data == skip:
+				depth--
+			}
+			if depth == 0 {
+				skip, last = "", t.end
+			}
+			continue
+		case t.Type == html.EndTagToken && !p.allowsTag(t.Data):
+			out.Write(src[last:t.start])
+			last = t.end
+			continue
+		case t.Type != html.StartTagToken && t.Type != html.SelfClosingTagToken:
+			continue
+		case !p.allowsTag(t.Data):
+			violations = append(violations, "<"+t.Data+"> element")
+			out.Write(src[last:t.start])
+			last = t.end
+			if t.Type == html.StartTagToken && !voidElements[t.Data] {
+				skip, depth = t.Data, 1
+			}
+			continue
+		}
+		tag := src[t.start:t.end]
+		i := 1 + len(t.Data)
+		stripped := false
+		for _, a := range scanAttrs(masked[t.start:t.end], tag) {
+			if p.allowsAttr(t.Data, a.name) {
+				continue
+			}
+			violations = append(violations, fmt.Sprintf("%s attribute on <%s>",
+				truncate(string(tag[a.start:a.end])), t.Data))
+			if !stripped {
+				out.Write(src[last : t.start+i])
+				stripped = true
+			}
+			out.Write(bytes.TrimRight(tag[i:a.start], spaceChars))
+			i = a.end
+		}
+		if stripped {
+			out.Write(tag[i:])
+			last = t.end
+		}
+	}
+	if skip == "" {
+		out.Write(src[last:])
+	}
+	return out.Bytes(), violations, nil
+}
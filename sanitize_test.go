@@ -0,0 +1,45 @@
+package component
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSanitizer(t *testing.T) {
+	src := map[string][]byte{
+		"page": []byte(`<style>p { color: red; }</style>
+<template><p class="intro" onclick="steal()">Hi {{ .Name }}</p><iframe src="x"><p>inside</p></iframe><a href="/" target="_top">home</a></template>`),
+	}
+	policy := &SanitizePolicy{
+		Tags:     []string{"p", "a"},
+		Attrs:    []string{"class"},
+		TagAttrs: map[string][]string{"a": {"href"}},
+	}
+
+	_, _, err := NewCompiler(Options{Sanitizer: policy}).Map(src)
+	if err == nil {
+		t.Fatal("want an error for forbidden content")
+	}
+	for _, want := range []string{
+		"page isn't permitted by the sanitizer",
+		"style section",
+		`onclick="steal()" attribute on <p>`,
+		"<iframe> element",
+		`target="_top" attribute on <a>`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error missing %s: %v", want, err)
+		}
+	}
+
+	policy.Strip = true
+	tmpl, _, err := NewCompiler(Options{Sanitizer: policy}).Map(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := render(t, tmpl, "page", map[string]string{"Name": "<b>Ann</b>"})
+	want := `<p class="intro">Hi &lt;b&gt;Ann&lt;/b&gt;</p><a href="/">home</a>`
+	if !strings.Contains(page, want) || strings.Contains(page, "color: red") {
+		t.Errorf("page:\n%s\nwant only the permitted markup %s", page, want)
+	}
+}
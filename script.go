@@ -0,0 +1,41 @@
+package component
+
+import (
+	"encoding/json"
+	"html"
+	"html/template"
+)
+
+// guardScript wraps a component's script so it's only executed once per
+// document. See Options.ScriptGuard.
+func guardScript(name string, script []byte) []byte {
+	flag := "window.__c_" + scopeID(name)
+	out := make([]byte, 0, len(script)+64)
+	out = append(out, "if (!"+flag+") {\n"+flag+" = true;\n"...)
+	out = append(out, script...)
+	return append(out, "\n}"...)
+}
+
+// jsonScript returns a JSON data island holding v, i.e. a
+// <script type="application/json"> element with the given ID, for passing
+// server data to scripts:
+//
+//	{{ jsonScript "cart-data" .Cart }}
+//
+// which a script reads with
+//
+//	JSON.parse(document.getElementById("cart-data").textContent)
+//
+// json.Marshal escapes "<", ">", and "&", so the data can never end the
+// element or be read as markup, whatever it contains. html/template can't
+// escape within such an element itself, since it's not JavaScript, so
+// prefer this to writing the element by hand. Use it only where an element
+// may appear, not within an attribute or another script.
+func jsonScript(id string, v interface{}) (template.HTML, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return template.HTML(`<script type="application/json" id="` +
+		html.EscapeString(id) + `">` + string(data) + `</script>`), nil
+}
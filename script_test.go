@@ -0,0 +1,48 @@
+package component
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestScriptGuard(t *testing.T) {
+	src := map[string]string{
+		"a":    `<script>init("a");</script><template>a</template>`,
+		"b":    `<script>init("b");</script><template>b</template>`,
+		"page": `<template>{{ template "./a" }}{{ template "./a" }}{{ template "./b" }}</template>`,
+	}
+	tmpl, _ := compileMap(t, Options{ScriptGuard: true}, src)
+	page := render(t, tmpl, "page", nil)
+	if n := strings.Count(page, `init("a")`); n != 1 {
+		t.Errorf("a's script included %d times:\n%s", n, page)
+	}
+
+	// each script sets its own flag before running
+	guard := regexp.MustCompile(`if \(!(window\.__c_\w+)\) \{\n(window\.__c_\w+) = true;\ninit\("(\w)"\);\n\}`)
+	matches := guard.FindAllStringSubmatch(page, -1)
+	if len(matches) != 2 {
+		t.Fatalf("want 2 guarded scripts:\n%s", page)
+	}
+	flags := map[string]string{}
+	for _, m := range matches {
+		if m[1] != m[2] {
+			t.Errorf("%s's script checks %s but sets %s", m[3], m[1], m[2])
+		}
+		flags[m[3]] = m[1]
+	}
+	if flags["a"] == flags["b"] {
+		t.Errorf("a and b share the flag %s", flags["a"])
+	}
+
+	// a fragment rendered on its own checks the same flag as the page
+	frag := render(t, tmpl, "a", nil)
+	if !strings.Contains(frag, "if (!"+flags["a"]+")") {
+		t.Errorf("fragment doesn't check %s:\n%s", flags["a"], frag)
+	}
+
+	tmpl, _ = compileMap(t, Options{}, src)
+	if page := render(t, tmpl, "page", nil); strings.Contains(page, "window.__c_") {
+		t.Errorf("script guarded without ScriptGuard:\n%s", page)
+	}
+}
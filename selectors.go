@@ -0,0 +1,204 @@
+package component
+
+import (
+	"regexp"
+	"strings"
+)
+
+// SelectorInfo describes a selector defined by a component's style. It
+// marshals to JSON for feeding design-system linters.
+type SelectorInfo struct {
+	// Selector is the selector as written, e.g. ".card > h2".
+	Selector string `json:"selector"`
+
+	// AtRules are the preludes of the group rules the selector is nested
+	// within, outermost first, e.g. "@media (max-width: 600px)".
+	AtRules []string `json:"atRules,omitempty"`
+
+	// Specificity counts the selector's IDs, then classes, attributes,
+	// and pseudo-classes, then types and pseudo-elements, e.g. [0 1 1]
+	// for ".card > h2".
+	Specificity [3]int `json:"specificity"`
+
+	// Important reports whether the selector's rule declares any property
+	// !important.
+	Important bool `json:"important"`
+}
+
+// importantRE matches an !important annotation.
+var importantRE = regexp.MustCompile(`(?i)!\s*important`)
+
+// SelectorReport returns the selectors defined by the style of each
+// component in a directory, in the order they're written, keyed by component
+// name. Components without selectors are omitted. Styles are analyzed as
+// written, before scoping, and selectors containing template actions are
+// reported as is.
+func SelectorReport(dirname string, opts ...Options) (map[string][]SelectorInfo, error) {
+	opt, err := getOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	comps, err := readDir(dirname, opt)
+	if err != nil {
+		return nil, err
+	}
+	if err := requireComponents(dirname, comps); err != nil {
+		return nil, err
+	}
+	report := map[string][]SelectorInfo{}
+	for _, c := range comps {
+		var infos []SelectorInfo
+		var walk func(rules []*cssRule, atRules []string)
+		walk = func(rules []*cssRule, atRules []string) {
+			for _, r := range rules {
+				switch r.kind {
+				case cssAtGroup:
+					walk(r.rules, append(atRules[:len(atRules):len(atRules)], r.prelude))
+				case cssQualified:
+					important := importantRE.MatchString(r.body)
+					for _, sel := range splitSelectors(r.prelude) {
+						if sel == "" {
+							continue
+						}
+						infos = append(infos, SelectorInfo{
+							Selector:    sel,
+							AtRules:     atRules,
+							Specificity: specificity(sel),
+							Important:   important,
+						})
+					}
+				}
+			}
+		}
+		walk(parseCSS(string(c.sections["style"])), nil)
+		if len(infos) > 0 {
+			report[c.name] = infos
+		}
+	}
+	return report, nil
+}
+
+// legacyPseudoElements may be written with a single colon.
+var legacyPseudoElements = map[string]bool{
+	"before":       true,
+	"after":        true,
+	"first-line":   true,
+	"first-letter": true,
+}
+
+// specificity returns the specificity of a single selector. :global(X)
+// counts as X, as when scoping.
+func specificity(sel string) [3]int {
+	var s [3]int
+	sel = unwrapGlobal(sel)
+	for i := 0; i < len(sel); {
+		switch c := sel[i]; {
+		case strings.HasPrefix(sel[i:], "{{"):
+			i = skipAction(sel, i)
+		case c == '"' || c == '\'':
+			i = skipString(sel, i)
+		case c == '#':
+			s[0]++
+			i = skipIdent(sel, i+1)
+		case c == '.':
+			s[1]++
+			i = skipIdent(sel, i+1)
+		case c == '[':
+			s[1]++
+			i = skipArgs(sel, i, '[', ']')
+		case c == ':' && strings.HasPrefix(sel[i:], "::"):
+			s[2]++
+			i = skipIdent(sel, i+2)
+			if i < len(sel) && sel[i] == '(' {
+				i = skipArgs(sel, i, '(', ')')
+			}
+		case c == ':':
+			end := skipIdent(sel, i+1)
+			name := strings.ToLower(sel[i+1 : end])
+			var args string
+			i = end
+			if i < len(sel) && sel[i] == '(' {
+				i = skipArgs(sel, i, '(', ')')
+				args = sel[end+1 : i-1]
+			}
+			switch name {
+			case "where":
+			case "is", "not", "has", "matches":
+				// the most specific selector in the argument counts
+				var max [3]int
+				for _, arg := range splitSelectors(args) {
+					if as := specificity(arg); lessSpecific(max, as) {
+						max = as
+					}
+				}
+				for j := range s {
+					s[j] += max[j]
+				}
+			default:
+				if legacyPseudoElements[name] {
+					s[2]++
+				} else {
+					s[1]++
+				}
+			}
+		case isIdentChar(c):
+			s[2]++
+			i = skipIdent(sel, i)
+		default:
+			i++
+		}
+	}
+	return s
+}
+
+// lessSpecific reports whether specificity a is lower than b.
+func lessSpecific(a, b [3]int) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return false
+}
+
+// isIdentChar reports whether c may appear within a CSS identifier.
+func isIdentChar(c byte) bool {
+	return c == '-' || c == '_' || c == '\\' || c >= 0x80 ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// skipIdent returns the position after the identifier starting at i.
+func skipIdent(s string, i int) int {
+	for i < len(s) && isIdentChar(s[i]) {
+		if s[i] == '\\' {
+			i++
+		}
+		i++
+	}
+	if i > len(s) {
+		return len(s)
+	}
+	return i
+}
+
+// skipArgs returns the position after the bracketed arguments opening at i,
+// accounting for nesting and quoted strings.
+func skipArgs(s string, i int, open, close byte) int {
+	depth := 0
+	for ; i < len(s); i++ {
+		switch s[i] {
+		case '"', '\'':
+			i = skipString(s, i) - 1
+		case '\\':
+			i++
+		case open:
+			depth++
+		case close:
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return len(s)
+}
@@ -0,0 +1,44 @@
+package component
+
+import (
+	"html/template"
+	"text/template/parse"
+
+	"github.com/pkg/errors"
+)
+
+// setupFunc is the name of the template function used to rebind a
+// component's data to the result of its setup pipeline.
+const setupFunc = "componentSetup"
+
+// once returns a slice holding only v, so ranging over it executes the
+// range's body exactly once with v as dot, even when v is empty.
+func once(v interface{}) []interface{} {
+	return []interface{}{v}
+}
+
+// wrapSetup rewrites a template section's tree so it renders with its data
+// passed through a setup pipeline, e.g. "prepareCard", as if it were
+// written as
+//
+//	{{ range componentSetup (prepareCard .) }}...{{ end }}
+//
+// The wrapping happens after parsing because local templates defined in
+// the section can't be nested within a range.
+func wrapSetup(tree *parse.Tree, setup string, fns template.FuncMap) error {
+	w, err := template.New(tree.Name).Funcs(fns).Parse(
+		"{{ range " + setupFunc + " (" + setup + " .) }}{{ end }}")
+	if err != nil {
+		return err
+	}
+	if len(w.Tree.Root.Nodes) != 1 {
+		return errors.New("setup must be a single pipeline")
+	}
+	rn, ok := w.Tree.Root.Nodes[0].(*parse.RangeNode)
+	if !ok {
+		return errors.New("setup must be a single pipeline")
+	}
+	rn.List = tree.Root
+	tree.Root = w.Tree.Root
+	return nil
+}
@@ -0,0 +1,84 @@
+package component
+
+import (
+	"bytes"
+
+	"golang.org/x/net/html"
+)
+
+// svgSymbol splits the template section of an SVG component, i.e. one whose
+// markup is a single static <svg> element, into a <symbol> to define once
+// per page and a lightweight <svg> using it. It reports false for other
+// components. See Options.SVGSymbols.
+func svgSymbol(name string, src []byte) (symbol, use []byte, ok bool, err error) {
+	if bytes.Contains(src, []byte("{{")) {
+		return nil, nil, false, nil
+	}
+	toks, err := tokenizeMarkup(src)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	// trim the whitespace and comments around the root element
+	for len(toks) > 0 && ignorable(toks[0]) {
+		toks = toks[1:]
+	}
+	for len(toks) > 0 && ignorable(toks[len(toks)-1]) {
+		toks = toks[:len(toks)-1]
+	}
+	if len(toks) < 2 {
+		return nil, nil, false, nil
+	}
+	first, last := toks[0], toks[len(toks)-1]
+	if first.Type != html.StartTagToken || first.Data != "svg" ||
+		last.Type != html.EndTagToken || last.Data != "svg" {
+		return nil, nil, false, nil
+	}
+	depth := 0
+	for _, t := range toks[:len(toks)-1] {
+		switch {
+		case t.Type == html.StartTagToken && t.Data == "svg":
+			depth++
+		case t.Type == html.EndTagToken && t.Data == "svg":
+			depth--
+			if depth == 0 {
+				// the root <svg> ends early, so there are siblings
+				return nil, nil, false, nil
+			}
+		}
+	}
+
+	id := elementName(name)
+	var sym bytes.Buffer
+	sym.WriteString(`<symbol id="` + id + `"`)
+	for _, a := range first.Attr {
+		// the tokenizer lowercases attribute names, but SVG's are case
+		// sensitive
+		switch a.Key {
+		case "viewbox":
+			sym.WriteString(` viewBox="` + html.EscapeString(a.Val) + `"`)
+		case "preserveaspectratio":
+			sym.WriteString(` preserveAspectRatio="` +
+				html.EscapeString(a.Val) + `"`)
+		}
+	}
+	sym.WriteString(">")
+	sym.Write(src[first.end:last.start])
+	sym.WriteString("</symbol>")
+
+	var u bytes.Buffer
+	u.Write(src[first.start:first.end])
+	u.WriteString(`<use href="#` + id + `"></use></svg>`)
+	return sym.Bytes(), u.Bytes(), true, nil
+}
+
+// ignorable reports whether a token may be dropped from around an element
+// without changing how it renders.
+func ignorable(t markupToken) bool {
+	switch t.Type {
+	case html.CommentToken:
+		return true
+	case html.TextToken:
+		return len(bytes.Trim([]byte(t.Data), spaceChars)) == 0
+	}
+	return false
+}
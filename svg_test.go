@@ -0,0 +1,40 @@
+package component
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSVGSymbols(t *testing.T) {
+	src := map[string]string{
+		"icons/check": `<template>
+	<svg viewBox="0 0 16 16" width="16" height="16"><path d="M2 8l4 4 8-8"/></svg>
+</template>`,
+		// actions make the markup vary, so it can't be a symbol
+		"icons/dynamic": `<template><svg viewBox="0 0 8 8"><circle r="{{ . }}"/></svg></template>`,
+		"page": `<template>
+	<ul>{{ range . }}<li>{{ template "./icons/check" }} {{ template "./icons/dynamic" 2 }} {{ . }}</li>{{ end }}</ul>
+</template>`,
+	}
+	tmpl, _ := compileMap(t, Options{SVGSymbols: true}, src)
+	page := render(t, tmpl, "page", []string{"a", "b", "c"})
+	if n := strings.Count(page, "M2 8l4 4 8-8"); n != 1 {
+		t.Errorf("path data appears %d times, want once:\n%s", n, page)
+	}
+	if !strings.Contains(page, `<symbol id="c-icons-check" viewBox="0 0 16 16">`) {
+		t.Errorf("page missing symbol:\n%s", page)
+	}
+	use := `<svg viewBox="0 0 16 16" width="16" height="16"><use href="#c-icons-check"></use></svg>`
+	if n := strings.Count(page, use); n != 3 {
+		t.Errorf("use appears %d times, want 3:\n%s", n, page)
+	}
+	if n := strings.Count(page, `<circle r="2"/>`); n != 3 {
+		t.Errorf("dynamic icon rendered %d times, want 3 in full:\n%s", n, page)
+	}
+
+	// the symbol is defined once per page, so pages without the icon
+	// don't have it
+	if other := render(t, tmpl, "icons/dynamic", 1); strings.Contains(other, "<symbol") {
+		t.Errorf("page without the icon has its symbol:\n%s", other)
+	}
+}
@@ -0,0 +1,138 @@
+package component
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// themesName is the name of the template holding the CSS custom properties
+// of Options.Themes.
+const themesName = "#themes"
+
+// Theme is a named set of CSS custom properties, or tokens, which components
+// reference with var(), e.g. "color: var(--fg)". See Options.Themes.
+type Theme struct {
+	// Name selects the theme with a data-theme attribute, e.g.
+	// <body data-theme="dark">, which applies it to the element and its
+	// descendants. The theme without a name is the default, applied to
+	// the whole document.
+	Name string
+
+	// Media optionally also applies a named theme to the whole document
+	// when a media query matches, e.g. "(prefers-color-scheme: dark)". A
+	// data-theme attribute takes precedence.
+	Media string
+
+	// Tokens maps each custom property, without its leading "--", to its
+	// value, e.g. "fg" to "#222".
+	Tokens map[string]string
+}
+
+// tokenNameRE matches the names of custom properties which need no escaping.
+var tokenNameRE = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// themeCSS returns the rules setting the tokens of each theme. The default
+// theme comes first, then those applied by media queries, then those
+// applied by data-theme attributes, so an attribute overrides a media query
+// matching at the same time.
+func themeCSS(themes []Theme) (string, error) {
+	var def, media, named []string
+	seen := map[string]bool{}
+	for _, th := range themes {
+		if seen[th.Name] {
+			return "", fmt.Errorf("theme %q defined twice", th.Name)
+		}
+		seen[th.Name] = true
+		if strings.ContainsAny(th.Name, "\"\\\n<>") ||
+			strings.ContainsAny(th.Media, "{};<>") {
+			return "", fmt.Errorf("invalid theme %q", th.Name)
+		}
+		block, err := tokenBlock(th)
+		if err != nil {
+			return "", err
+		}
+		if th.Name == "" {
+			def = append(def, ":root "+block)
+			continue
+		}
+		if th.Media != "" {
+			media = append(media, "@media "+th.Media+" {\n:root "+block+"\n}")
+		}
+		named = append(named, "[data-theme="+strconv.Quote(th.Name)+"] "+block)
+	}
+	return strings.Join(append(append(def, media...), named...), "\n"), nil
+}
+
+// tokenBlock returns a declaration block setting the tokens of a theme,
+// sorted by name.
+func tokenBlock(th Theme) (string, error) {
+	names := make([]string, 0, len(th.Tokens))
+	for name := range th.Tokens {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	b.WriteString("{\n")
+	for _, name := range names {
+		value := th.Tokens[name]
+		if !tokenNameRE.MatchString(name) || value == "" ||
+			strings.ContainsAny(value, "{};<>") {
+			return "", fmt.Errorf("invalid token %q in theme %q", name, th.Name)
+		}
+		b.WriteString("\t--" + name + ": " + value + ";\n")
+	}
+	b.WriteString("}")
+	return b.String(), nil
+}
+
+var (
+	// tokenUseRE matches references to custom properties, capturing the
+	// name, e.g. "fg" in "var(--fg)".
+	tokenUseRE = regexp.MustCompile(`var\(\s*--([A-Za-z0-9_-]+)`)
+
+	// tokenDeclRE matches declarations of custom properties, capturing the
+	// name, e.g. "fg" in "--fg: #222".
+	tokenDeclRE = regexp.MustCompile(`--([A-Za-z0-9_-]+)\s*:`)
+)
+
+// addThemes defines the template holding the tokens of Options.Themes and
+// reports tokens which components use but neither a theme nor any
+// component's style declares.
+func (b *builder) addThemes() error {
+	css, err := themeCSS(b.opts.Themes)
+	if err != nil {
+		return err
+	}
+	if err := b.addText(themesName, css); err != nil {
+		return err
+	}
+	declared := map[string]bool{}
+	for _, th := range b.opts.Themes {
+		for name := range th.Tokens {
+			declared[name] = true
+		}
+	}
+	for _, c := range b.comps {
+		for _, m := range tokenDeclRE.FindAllStringSubmatch(string(c.sections["style"]), -1) {
+			declared[m[1]] = true
+		}
+	}
+	for _, c := range b.comps {
+		reported := map[string]bool{}
+		for _, m := range tokenUseRE.FindAllStringSubmatch(string(c.sections["style"]), -1) {
+			if declared[m[1]] || reported[m[1]] {
+				continue
+			}
+			reported[m[1]] = true
+			b.meta.Warnings = append(b.meta.Warnings, Warning{
+				Component: c.name,
+				Kind:      WarnUndefinedToken,
+				Message:   fmt.Sprintf("style uses --%s, which no theme defines", m[1]),
+			})
+		}
+	}
+	return nil
+}
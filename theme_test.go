@@ -0,0 +1,62 @@
+package component
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestThemeCSS(t *testing.T) {
+	css, err := themeCSS([]Theme{
+		{Name: "dark", Media: "(prefers-color-scheme: dark)", Tokens: map[string]string{"fg": "#eee"}},
+		{Tokens: map[string]string{"fg": "#222", "bg": "#fff"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The default theme comes first regardless of the order given, and
+	// data-theme attributes after media queries, so they take precedence.
+	const want = `:root {
+	--bg: #fff;
+	--fg: #222;
+}
+@media (prefers-color-scheme: dark) {
+:root {
+	--fg: #eee;
+}
+}
+[data-theme="dark"] {
+	--fg: #eee;
+}`
+	if css != want {
+		t.Errorf("got:\n%s\nwant:\n%s", css, want)
+	}
+
+	for _, themes := range [][]Theme{
+		{{Name: "a"}, {Name: "a"}},
+		{{Name: `a"b`}},
+		{{Media: "all { }"}},
+		{{Tokens: map[string]string{"a b": "1"}}},
+		{{Tokens: map[string]string{"fg": ""}}},
+		{{Tokens: map[string]string{"fg": "red; }"}}},
+	} {
+		if _, err := themeCSS(themes); err == nil {
+			t.Errorf("%+v: want error", themes)
+		}
+	}
+}
+
+func TestThemes(t *testing.T) {
+	opts := Options{Themes: []Theme{{Tokens: map[string]string{"fg": "#222"}}}}
+	tmpl, meta := compileMap(t, opts, map[string]string{
+		"page": `<style>p { color: var(--fg); border-color: var(--missing); --local: 0; margin: var(--local); }</style>
+<template><p>x</p></template>`,
+	})
+	page := render(t, tmpl, "page", nil)
+	if i, j := strings.Index(page, "--fg: #222"), strings.Index(page, "p {"); i < 0 || j < i {
+		t.Errorf("tokens missing or after component styles:\n%s", page)
+	}
+	if len(meta.Warnings) != 1 || meta.Warnings[0].Kind != WarnUndefinedToken ||
+		!strings.Contains(meta.Warnings[0].Message, "--missing") {
+		t.Errorf("warnings %+v, want one for --missing", meta.Warnings)
+	}
+}
@@ -0,0 +1,258 @@
+package component
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// Transform rewrites the content of a component's section at compile time,
+// e.g. compiling SCSS to CSS or minifying a script. See Options.Transforms.
+type Transform func(ctx TransformContext, content []byte) ([]byte, error)
+
+// TransformContext describes the section a Transform is applied to.
+type TransformContext struct {
+	// Component is the name of the component, e.g. "list/item".
+	Component string
+
+	// Section is the name of the section, e.g. "style".
+	Section string
+
+	// Attrs are the attributes of the section's tag, e.g. "lang" for
+	// <style lang="scss">. Don't modify them.
+	Attrs map[string]string
+}
+
+// transformSections maps the media types of Options.Transforms to the
+// sections they apply to, in the order they're transformed.
+var transformSections = []struct{ mediaType, section string }{
+	{"text/html", "template"},
+	{"text/css", "style"},
+	{"application/javascript", "script"},
+	{"application/ld+json", jsonLDSection},
+}
+
+// checkTransforms fails if Options.Transforms has a media type without a
+// section.
+func checkTransforms(transforms map[string][]Transform) error {
+outer:
+	for mediaType := range transforms {
+		for _, ts := range transformSections {
+			if ts.mediaType == mediaType {
+				continue outer
+			}
+		}
+		return fmt.Errorf("Transforms has unknown media type %q", mediaType)
+	}
+	return nil
+}
+
+// transform applies Options.Transforms to each of a component's sections.
+func (b *builder) transform(c *component) error {
+	for _, ts := range transformSections {
+		data, ok := c.sections[ts.section]
+		if !ok {
+			continue
+		}
+		ctx := TransformContext{
+			Component: c.name,
+			Section:   ts.section,
+			Attrs:     c.attrs[ts.section],
+		}
+		for _, fn := range b.opts.Transforms[ts.mediaType] {
+			var err error
+			data, err = fn(ctx, data)
+			if err != nil {
+				return errors.Wrapf(err, "transform %s of %s", ts.mediaType, c.name)
+			}
+		}
+		c.sections[ts.section] = data
+	}
+	return nil
+}
+
+// builtinTransform is a rewrite of a component's sections built into the
+// package, most of them turned on by an option.
+type builtinTransform struct {
+	// enabled reports whether the transform applies to a component. A
+	// nil enabled always applies.
+	enabled func(b *builder, c *component) bool
+
+	// apply rewrites the component's sections, or checks them.
+	apply func(b *builder, c *component) error
+}
+
+// builtinTransforms are applied in order to each component after
+// Options.Transforms, each seeing the sections as the ones before left
+// them. Checks are ordered among them so they see the sections they
+// expect, e.g. accessibility is checked before defaults are added, and
+// scoping comes before whitespace is collapsed so the attributes it adds
+// are collapsed too.
+var builtinTransforms = []builtinTransform{
+	// markup
+	{nil, func(b *builder, c *component) error {
+		var err error
+		c.sections["template"], c.sections["preview"], err = extractPreview(
+			c.name, c.sections["template"])
+		return err
+	}},
+	{nil, func(b *builder, c *component) error {
+		var err error
+		c.sections["template"], err = b.rewriteIncludes(c.name, c.sections["template"])
+		return errors.Wrapf(err, "include %s", c.name)
+	}},
+	{func(b *builder, c *component) bool { return b.opts.StripComments },
+		func(b *builder, c *component) error {
+			var err error
+			c.sections["template"], err = stripComments(c.sections["template"])
+			return errors.Wrapf(err, "strip comments %s", c.name)
+		}},
+	{func(b *builder, c *component) bool { return b.opts.Sanitizer != nil },
+		func(b *builder, c *component) error {
+			return sanitize(c, b.opts.Sanitizer)
+		}},
+	{nil, func(b *builder, c *component) error {
+		return checkA11y(c.name, c.sections["template"], b.opts.A11y)
+	}},
+	{func(b *builder, c *component) bool { return len(b.opts.A11y.Defaults) > 0 },
+		func(b *builder, c *component) error {
+			var err error
+			c.sections["template"], err = defaultAttrs(c.sections["template"], b.opts.A11y.Defaults)
+			return errors.Wrapf(err, "accessibility defaults %s", c.name)
+		}},
+	{func(b *builder, c *component) bool { return b.opts.LazyImages },
+		func(b *builder, c *component) error {
+			var err error
+			c.sections["template"], err = lazyImages(c.sections["template"])
+			return errors.Wrapf(err, "lazy images %s", c.name)
+		}},
+	{func(b *builder, c *component) bool { return b.opts.ExtractInlineHandlers },
+		func(b *builder, c *component) error {
+			markup, script, err := extractHandlers(c.name, c.sections["template"])
+			if err != nil {
+				return errors.Wrapf(err, "extract handlers %s", c.name)
+			}
+			c.sections["template"] = markup
+			if len(script) > 0 && len(c.sections["script"]) > 0 {
+				script = append(append(c.sections["script"], '\n'), script...)
+			}
+			if len(script) > 0 {
+				c.sections["script"] = script
+			}
+			return nil
+		}},
+	{func(b *builder, c *component) bool { return b.opts.StrictHTML },
+		func(b *builder, c *component) error {
+			return checkWellFormed(c)
+		}},
+
+	// styles, and the markup they scope
+	{func(b *builder, c *component) bool {
+		return b.opts.InlineImagesBelow > 0 && c.fsys != nil && len(c.sections["style"]) > 0
+	}, func(b *builder, c *component) error {
+		var err error
+		c.sections["style"], err = inlineImages(c, b.opts.InlineImagesBelow)
+		return errors.Wrapf(err, "inline images %s", c.name)
+	}},
+	{func(b *builder, c *component) bool { return b.opts.EnforceNamespacing },
+		func(b *builder, c *component) error {
+			return checkNamespacing(c, b.scoped(c))
+		}},
+	{func(b *builder, c *component) bool { return b.scoped(c) && !b.webComponent(c) },
+		func(b *builder, c *component) error {
+			var warnings []Warning
+			c.sections["style"], warnings = scopeStyle(c.name, c.sections["style"])
+			b.meta.Warnings = append(b.meta.Warnings, warnings...)
+			attr := scopeAttr(c.name)
+			if c.hasAttr("style", "instance") {
+				attr += " " + instanceAttr + `="{{ $instance }}"`
+			}
+			var err error
+			c.sections["template"], err = scopeMarkup(c.sections["template"], attr)
+			if err != nil {
+				return errors.Wrapf(err, "scope markup %s", c.name)
+			}
+			if c.hasAttr("style", "instance") {
+				c.sections["template"] = instanceMarkup(c.sections["template"])
+			}
+			return nil
+		}},
+	{func(b *builder, c *component) bool { return b.opts.CollapseWhitespace },
+		func(b *builder, c *component) error {
+			var err error
+			c.sections["template"], err = collapseWhitespace(c.sections["template"])
+			return errors.Wrapf(err, "collapse whitespace %s", c.name)
+		}},
+	{func(b *builder, c *component) bool { return b.opts.Pretty },
+		func(b *builder, c *component) error {
+			var err error
+			c.sections["template"], err = prettyMarkup(c.sections["template"])
+			return errors.Wrapf(err, "pretty print %s", c.name)
+		}},
+	{func(b *builder, c *component) bool { return b.webComponent(c) },
+		func(b *builder, c *component) error {
+			if err := b.claimElement(c.name); err != nil {
+				return err
+			}
+			customElement(c)
+			return nil
+		}},
+	{func(b *builder, c *component) bool { return b.opts.SVGSymbols && !b.webComponent(c) },
+		func(b *builder, c *component) error {
+			symbol, use, ok, err := svgSymbol(c.name, c.sections["template"])
+			if err != nil {
+				return errors.Wrapf(err, "svg symbol %s", c.name)
+			}
+			if !ok {
+				return nil
+			}
+			if err := b.claimElement(c.name); err != nil {
+				return err
+			}
+			c.sections["symbol"] = symbol
+			c.sections["template"] = use
+			return nil
+		}},
+	{func(b *builder, c *component) bool {
+		return b.opts.DedupAtRules && len(c.sections["style"]) > 0
+	}, func(b *builder, c *component) error {
+		return b.hoistAtRules(c)
+	}},
+	// a style with a media condition keeps its queries, which can't be
+	// grouped with others
+	{func(b *builder, c *component) bool {
+		return b.opts.GroupMedia && len(c.sections["style"]) > 0 && b.styleMedia[c.name] == ""
+	}, func(b *builder, c *component) error {
+		return b.groupMedia(c)
+	}},
+
+	// scripts and data
+	{func(b *builder, c *component) bool {
+		return b.opts.BundleModules && !b.opts.NoAssetBundling && b.moduleScripts[c.name]
+	}, func(b *builder, c *component) error {
+		return b.bundleModule(c)
+	}},
+	{func(b *builder, c *component) bool {
+		return b.opts.ScriptGuard && len(c.sections["script"]) > 0
+	}, func(b *builder, c *component) error {
+		c.sections["script"] = guardScript(c.name, c.sections["script"])
+		return nil
+	}},
+	{func(b *builder, c *component) bool { return len(c.sections[jsonLDSection]) > 0 },
+		func(b *builder, c *component) error {
+			var err error
+			c.sections[jsonLDSection], err = jsonLDFragment(c.name, c.sections[jsonLDSection])
+			return err
+		}},
+}
+
+// scoped reports whether a component's style is scoped to it.
+func (b *builder) scoped(c *component) bool {
+	return c.hasAttr("style", "scoped") && !b.opts.Unscoped
+}
+
+// webComponent reports whether a component is compiled to a custom element
+// with a shadow root, which scopes its style instead.
+func (b *builder) webComponent(c *component) bool {
+	return b.scoped(c) && b.opts.Mode == ModeWebComponents
+}
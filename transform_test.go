@@ -0,0 +1,54 @@
+package component
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestTransformOrder(t *testing.T) {
+	var seen []string
+	record := func(ctx TransformContext, content []byte) ([]byte, error) {
+		seen = append(seen, ctx.Section+": "+string(content))
+		return bytes.ReplaceAll(content, []byte("$accent"), []byte("red")), nil
+	}
+	opts := Options{
+		Transforms: map[string][]Transform{
+			"text/css":  {record},
+			"text/html": {record},
+		},
+		LazyImages:            true,
+		ExtractInlineHandlers: true,
+		CollapseWhitespace:    true,
+	}
+	tmpl, _ := compileMap(t, opts, map[string]string{
+		"card": `<style scoped>.card { color: $accent; }</style>
+<template>
+	<div class="card">
+		<img src="a.png" onclick="go()">
+	</div>
+</template>`,
+	})
+	// Options.Transforms see sections as written, template first
+	want := []string{
+		"template: <div class=\"card\">\n\t<img src=\"a.png\" onclick=\"go()\">\n</div>",
+		"style: .card { color: $accent; }",
+	}
+	if strings.Join(seen, "\n") != strings.Join(want, "\n") {
+		t.Errorf("transforms saw:\n%s\nwant:\n%s", strings.Join(seen, "\n"), strings.Join(want, "\n"))
+	}
+	// built-in transforms then rewrite their output in order: images are
+	// lazy-loaded and handlers extracted before the markup is scoped,
+	// and whitespace is collapsed last
+	page := render(t, tmpl, "card", nil)
+	attr := scopeAttr("card")
+	for _, want := range []string{
+		"color: red",
+		`<div ` + attr + ` class="card"><img ` + handlerAttr + `="`,
+		`decoding="async" loading="lazy" src="a.png"></div>`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("page missing %s:\n%s", want, page)
+		}
+	}
+}
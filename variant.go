@@ -0,0 +1,125 @@
+package component
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template/parse"
+
+	"github.com/pkg/errors"
+)
+
+// variantFunc is the name of the template function selecting the variant
+// of a component to render.
+const variantFunc = "componentVariant"
+
+// variantPrefix begins the names of local templates holding a component's
+// variants, e.g. {{ define "variant:primary" }}.
+const variantPrefix = "variant:"
+
+// variantOf returns the variant data selects, i.e. its "Variant" key or
+// field, failing if it's not one of variants. Data without a variant
+// selects the default, "".
+func variantOf(name string, data interface{}, variants ...string) (string, error) {
+	var variant string
+	switch d := data.(type) {
+	case map[string]interface{}:
+		variant, _ = d["Variant"].(string)
+	case map[string]string:
+		variant = d["Variant"]
+	default:
+		v := reflect.ValueOf(data)
+		if v.Kind() == reflect.Ptr && !v.IsNil() {
+			v = v.Elem()
+		}
+		if v.Kind() == reflect.Struct {
+			if f := v.FieldByName("Variant"); f.IsValid() && f.Kind() == reflect.String {
+				variant = f.String()
+			}
+		}
+	}
+	if variant == "" {
+		return "", nil
+	}
+	for _, v := range variants {
+		if v == variant {
+			return variant, nil
+		}
+	}
+	return "", fmt.Errorf("%s has no variant %q", name, variant)
+}
+
+// variants returns the sorted names of the variants a component's template
+// section defines, e.g. "primary" for {{ define "variant:primary" }}.
+func variants(name string, t *template.Template) []string {
+	var vs []string
+	prefix := name + "~" + variantPrefix
+	for _, tt := range t.Templates() {
+		if strings.HasPrefix(tt.Tree.Name, prefix) {
+			vs = append(vs, strings.TrimPrefix(tt.Tree.Name, prefix))
+		}
+	}
+	sort.Strings(vs)
+	return vs
+}
+
+// wrapVariants rewrites a template section's tree so it renders the variant
+// its data selects, as if it were written as
+//
+//	{{ if not (componentVariant "button" . "primary") }}
+//		...
+//	{{ else if eq (componentVariant "button" . "primary") "primary" }}
+//		{{ template "variant:primary" . }}
+//	{{ end }}
+//
+// As with setup, the wrapping happens after parsing because local templates
+// defined in the section can't be nested within an if.
+func wrapVariants(tree *parse.Tree, name string, vs []string) error {
+	quoted := make([]string, len(vs))
+	for i, v := range vs {
+		quoted[i] = strconv.Quote(v)
+	}
+	sel := "(" + variantFunc + " " + strconv.Quote(name) + " . " +
+		strings.Join(quoted, " ") + ")"
+	src := "{{ if not " + sel + " }}"
+	for i, v := range vs {
+		src += "{{ else if eq " + sel + " " + quoted[i] + " }}{{ template " +
+			strconv.Quote(name+"~"+variantPrefix+v) + " . }}"
+	}
+	src += "{{ end }}"
+	w, err := template.New(tree.Name).Funcs(template.FuncMap{variantFunc: variantOf}).Parse(src)
+	if err != nil {
+		return errors.Wrap(err, "variants")
+	}
+	w.Tree.Root.Nodes[0].(*parse.IfNode).List = tree.Root
+	tree.Root = w.Tree.Root
+	return nil
+}
+
+// RenderVariant renders the markup of the named variant of a component,
+// e.g. "primary" for one defined by {{ define "variant:primary" }}, like
+// RenderHTML. The empty variant renders the component's default markup.
+// Variants are usually selected by the data instead; see the package
+// documentation.
+func RenderVariant(
+	t *template.Template,
+	name, variant string,
+	data interface{},
+) (template.HTML, error) {
+	if variant == "" {
+		return RenderHTML(t, name, data)
+	}
+	tmpl := name + "~" + variantPrefix + variant
+	if t.Lookup(tmpl) == nil {
+		return "", fmt.Errorf("%s has no variant %q", name, variant)
+	}
+	var buf bytes.Buffer
+	if err := t.ExecuteTemplate(&buf, tmpl, data); err != nil {
+		return "", err
+	}
+	return template.HTML(buf.String()), nil
+}
@@ -0,0 +1,60 @@
+package component
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// elementName returns the custom element name for a component, e.g.
+// "c-list-item" for "list/item". Custom element names must contain a hyphen
+// and may only use lowercase letters, so the "c-" prefix guarantees one and
+// other characters are replaced.
+func elementName(name string) string {
+	return "c-" + strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		}
+		return '-'
+	}, name)
+}
+
+// claimElement reserves the element name derived from a component's name,
+// failing if another component's name maps to the same element, e.g.
+// "widgets/foo" and "widgets-foo".
+func (b *builder) claimElement(name string) error {
+	el := elementName(name)
+	if other, ok := b.elements[el]; ok && other != name {
+		return fmt.Errorf("components %s and %s are both named %s",
+			other, name, el)
+	}
+	b.elements[el] = name
+	return nil
+}
+
+// customElement rewrites a component's sections to render it as a custom
+// element. See ModeWebComponents.
+func customElement(c *component) {
+	el := elementName(c.name)
+	var markup bytes.Buffer
+	markup.WriteString("<" + el + ">")
+	markup.WriteString(`<template shadowrootmode="open">`)
+	if style := c.sections["style"]; len(style) > 0 {
+		markup.WriteString("<style>\n")
+		markup.Write(style)
+		markup.WriteString("\n</style>\n")
+	}
+	markup.Write(c.sections["template"])
+	markup.WriteString("</template></" + el + ">")
+	c.sections["template"] = markup.Bytes()
+	c.sections["style"] = nil
+
+	var script bytes.Buffer
+	script.WriteString(`customElements.define("` + el + `", class extends HTMLElement {` + "\n")
+	script.Write(c.sections["script"])
+	script.WriteString("\n});")
+	c.sections["script"] = script.Bytes()
+}
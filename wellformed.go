@@ -0,0 +1,106 @@
+package component
+
+import (
+	"bytes"
+	"fmt"
+
+	"golang.org/x/net/html"
+)
+
+// closesP are elements whose start tag implicitly closes an open <p>, so a
+// <p> containing one is split by browsers.
+var closesP = map[string]bool{
+	"address":    true,
+	"article":    true,
+	"aside":      true,
+	"blockquote": true,
+	"details":    true,
+	"div":        true,
+	"dl":         true,
+	"fieldset":   true,
+	"figcaption": true,
+	"figure":     true,
+	"footer":     true,
+	"form":       true,
+	"h1":         true,
+	"h2":         true,
+	"h3":         true,
+	"h4":         true,
+	"h5":         true,
+	"h6":         true,
+	"header":     true,
+	"hgroup":     true,
+	"hr":         true,
+	"main":       true,
+	"nav":        true,
+	"ol":         true,
+	"p":          true,
+	"pre":        true,
+	"section":    true,
+	"table":      true,
+	"ul":         true,
+}
+
+// checkWellFormed reports the first problem in template section markup
+// which browsers would silently repair: end tags which don't match the open
+// element, elements left open, non-void elements written as self-closing,
+// and block elements within a <p>. See Options.StrictHTML.
+//
+// Template actions are ignored, so every branch of a conditional must be
+// well-formed on its own.
+func checkWellFormed(c *component) error {
+	src := c.sections["template"]
+	toks, err := tokenizeMarkup(src)
+	if err != nil {
+		return err
+	}
+	line := func(t markupToken) int {
+		return c.offsets["template"] + bytes.Count(src[:t.start], []byte{'\n'}) + 1
+	}
+	fail := func(t markupToken, format string, args ...interface{}) error {
+		return fmt.Errorf("%s:%d: %s", c.file, line(t), fmt.Sprintf(format, args...))
+	}
+	var stack []markupToken
+	foreign := 0 // depth within <svg> or <math>, where XML rules apply
+	for _, t := range toks {
+		switch t.Type {
+		case html.StartTagToken:
+			if voidElements[t.Data] {
+				continue
+			}
+			if len(stack) > 0 && foreign == 0 && closesP[t.Data] &&
+				stack[len(stack)-1].Data == "p" {
+				return fail(t, "<%s> within <p> closes it implicitly", t.Data)
+			}
+			if t.Data == "svg" || t.Data == "math" || foreign > 0 {
+				foreign++
+			}
+			stack = append(stack, t)
+		case html.SelfClosingTagToken:
+			if foreign == 0 && !voidElements[t.Data] {
+				return fail(t, "<%s/> isn't a void element, so it's left open", t.Data)
+			}
+		case html.EndTagToken:
+			if voidElements[t.Data] {
+				return fail(t, "</%s> closes a void element", t.Data)
+			}
+			if len(stack) == 0 {
+				return fail(t, "</%s> has no open element", t.Data)
+			}
+			top := stack[len(stack)-1]
+			if top.Data != t.Data {
+				return fail(t, "</%s> closes <%s> opened on line %d",
+					t.Data, top.Data, line(top))
+			}
+			stack = stack[:len(stack)-1]
+			if foreign > 0 {
+				foreign--
+			}
+		}
+	}
+	if len(stack) > 0 {
+		top := stack[len(stack)-1]
+		return fail(top, "<%s> is never closed", top.Data)
+	}
+	return nil
+}